@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"spchain/chain"
+	"spchain/chainhash"
+	"spchain/mining"
+)
+
+// blockNode A block header in the block index
+type blockNode struct {
+	hash   chainhash.Hash
+	parent *blockNode
+	header chain.BlockHeader
+	height int32
+	// workSum The total work of the chain ending at this block
+	workSum *big.Int
+	status  chain.BlockStatus
+}
+
+// newBlockNode Create a node for header on top of parent
+func newBlockNode(header *chain.BlockHeader, parent *blockNode) *blockNode {
+	node := &blockNode{
+		hash:    header.Hash(),
+		parent:  parent,
+		header:  *header,
+		workSum: mining.CalcWork(uint32(header.DifficultyTarget)),
+	}
+	if parent != nil {
+		node.height = parent.height + 1
+		node.workSum.Add(node.workSum, parent.workSum)
+	}
+	return node
+}
+
+// ancestor The node at height on the branch ending at this node
+func (node *blockNode) ancestor(height int32) *blockNode {
+	if height < 0 || height > node.height {
+		return nil
+	}
+	n := node
+	for n != nil && n.height > height {
+		n = n.parent
+	}
+	return n
+}
+
+// ancestorFunc An AncestorFunc for the branch ending at this node
+func (node *blockNode) ancestorFunc() AncestorFunc {
+	return func(height int32) (*chain.BlockHeader, error) {
+		n := node.ancestor(height)
+		if n == nil {
+			return nil, fmt.Errorf("no ancestor at height %d", height)
+		}
+		return &n.header, nil
+	}
+}
+
+// meta The metadata saved for the node
+func (node *blockNode) meta() *chain.BlockMeta {
+	return &chain.BlockMeta{
+		Header:    node.header,
+		Height:    node.height,
+		Status:    node.status,
+		ChainWork: node.workSum,
+	}
+}
+
+// nodeFromMeta The node saved as meta on top of parent, nil for the
+// genesis block
+func nodeFromMeta(hash chainhash.Hash, meta *chain.BlockMeta, parent *blockNode) *blockNode {
+	return &blockNode{
+		hash:    hash,
+		parent:  parent,
+		header:  meta.Header,
+		height:  meta.Height,
+		workSum: meta.ChainWork,
+		status:  meta.Status,
+	}
+}
+
+// findFork The most recent node which is on the branches of both a and b
+func findFork(a *blockNode, b *blockNode) *blockNode {
+	if a.height > b.height {
+		a = a.ancestor(b.height)
+	} else if b.height > a.height {
+		b = b.ancestor(a.height)
+	}
+	for a != nil && b != nil && a != b {
+		a = a.parent
+		b = b.parent
+	}
+	return a
+}
@@ -0,0 +1,521 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/db"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BlockChain Tracks every block header seen and keeps the utxo set
+// in step with the branch which has the most cumulative work
+type BlockChain struct {
+	params *chaincfg.Params
+	db     db.Interface
+	utxos  *chain.UtxoSet
+
+	mtx   sync.RWMutex
+	index map[chainhash.Hash]*blockNode
+	// mainChain The nodes of the best chain ordered by height
+	mainChain []*blockNode
+
+	notificationsMtx sync.RWMutex
+	notifications    []NotificationCallback
+}
+
+// New Create a block chain backed by database. If the database already
+// holds a best chain it is loaded, otherwise the chain starts from the
+// genesis block of params
+func New(params *chaincfg.Params, database db.Interface) (*BlockChain, error) {
+	b := &BlockChain{
+		params: params,
+		db:     database,
+		utxos:  chain.NewUtxoSet(database),
+		index:  map[chainhash.Hash]*blockNode{},
+	}
+
+	buff, err := database.GetBestBlock()
+	if err == db.ErrNotFound {
+		if _, err := b.ProcessBlock(params.GenesisBlock); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	best, err := chain.DeserialiseBestBlock(buff)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.loadIndex(); err != nil {
+		return nil, err
+	}
+	if err := b.loadMainChain(best); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadIndex Rebuild the block index, side branches and invalid blocks
+// included, from the saved block metadata
+func (b *BlockChain) loadIndex() error {
+	metas := map[chainhash.Hash]*chain.BlockMeta{}
+	err := chain.ForEachBlockMeta(b.db, func(hash chainhash.Hash, meta *chain.BlockMeta) error {
+		if meta.Header.Hash() != hash {
+			return fmt.Errorf("metadata of block %s holds the header of %s", hash, meta.Header.Hash())
+		}
+		metas[hash] = meta
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Parents are added before their children
+	hashes := make([]chainhash.Hash, 0, len(metas))
+	for hash := range metas {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return metas[hashes[i]].Height < metas[hashes[j]].Height
+	})
+
+	for _, hash := range hashes {
+		meta := metas[hash]
+		var parent *blockNode
+		if meta.Height > 0 {
+			var ok bool
+			parent, ok = b.index[meta.Header.PrevBlockHash]
+			if !ok || parent.height != meta.Height-1 {
+				return fmt.Errorf("block %s at height %d has no parent in the index", hash, meta.Height)
+			}
+		} else if hash != b.params.GenesisHash {
+			return fmt.Errorf("database genesis block %s does not match %s", hash, b.params.Name)
+		}
+		b.index[hash] = nodeFromMeta(hash, meta, parent)
+	}
+	return nil
+}
+
+// loadMainChain Rebuild the best chain from the height index and the
+// block index
+func (b *BlockChain) loadMainChain(best chain.BestBlock) error {
+	var parent *blockNode
+	for height := int32(0); height <= best.Height; height++ {
+		hash, err := b.db.GetBlockHashByHeight(height)
+		if err != nil {
+			return fmt.Errorf("unable to load the block at height %d: %s", height, err)
+		}
+		node, ok := b.index[hash]
+		if !ok || node.parent != parent {
+			return fmt.Errorf("block %s at height %d does not extend the best chain", hash, height)
+		}
+		b.mainChain = append(b.mainChain, node)
+		parent = node
+	}
+
+	if parent.hash != best.Hash {
+		return fmt.Errorf("best block %s does not match the height index", best.Hash)
+	}
+	return nil
+}
+
+// Params The parameters of the network the chain is on
+func (b *BlockChain) Params() *chaincfg.Params {
+	return b.params
+}
+
+// UtxoSet The utxo set of the best chain
+func (b *BlockChain) UtxoSet() *chain.UtxoSet {
+	return b.utxos
+}
+
+// tip The last node of the best chain
+func (b *BlockChain) tip() *blockNode {
+	if len(b.mainChain) == 0 {
+		return nil
+	}
+	return b.mainChain[len(b.mainChain)-1]
+}
+
+// BestHash The hash of the tip of the best chain
+func (b *BlockChain) BestHash() chainhash.Hash {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if tip := b.tip(); tip != nil {
+		return tip.hash
+	}
+	return chainhash.Hash{}
+}
+
+// BestHeight The height of the tip of the best chain. -1 when
+// there are no blocks
+func (b *BlockChain) BestHeight() int32 {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	return int32(len(b.mainChain)) - 1
+}
+
+// BestChainWork The cumulative work of the best chain
+func (b *BlockChain) BestChainWork() *big.Int {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if tip := b.tip(); tip != nil {
+		return new(big.Int).Set(tip.workSum)
+	}
+	return big.NewInt(0)
+}
+
+// HaveBlock True if the block is in the block index
+func (b *BlockChain) HaveBlock(hash chainhash.Hash) bool {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	_, ok := b.index[hash]
+	return ok
+}
+
+// IsMainChain True if the block is part of the best chain
+func (b *BlockChain) IsMainChain(hash chainhash.Hash) bool {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	node, ok := b.index[hash]
+	return ok && b.isMainChain(node)
+}
+
+func (b *BlockChain) isMainChain(node *blockNode) bool {
+	return node.height < int32(len(b.mainChain)) && b.mainChain[node.height] == node
+}
+
+// HeaderByHeight The header at height on the best chain
+func (b *BlockChain) HeaderByHeight(height int32) (*chain.BlockHeader, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if height < 0 || height >= int32(len(b.mainChain)) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	header := b.mainChain[height].header
+	return &header, nil
+}
+
+// MedianTimePast The median time past of the tip of the best chain,
+// which lock times in the next block are checked against
+func (b *BlockChain) MedianTimePast() (int64, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	tip := b.tip()
+	if tip == nil {
+		return 0, fmt.Errorf("no best chain")
+	}
+	return CalcPastMedianTime(&tip.header, tip.height, tip.ancestorFunc())
+}
+
+// LookupUtxo Implements UtxoViewer over the utxo set of the best chain
+func (b *BlockChain) LookupUtxo(outPoint chainhash.OutPoint) (*chain.Utxo, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	return b.utxos.LookupUtxo(outPoint)
+}
+
+// NextRequiredDifficulty The DifficultyTarget a block built on prevHash
+// must have
+func (b *BlockChain) NextRequiredDifficulty(prevHash chainhash.Hash) (uint32, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	prev, ok := b.index[prevHash]
+	if !ok {
+		return 0, ruleError(ErrMissingParent, fmt.Sprintf("Unknown block %s", prevHash))
+	}
+	return CalcNextRequiredDifficulty(b.params, &prev.header, prev.height, prev.ancestorFunc())
+}
+
+// ProcessBlock Validate a block, save it and add it to the block index.
+// If the block gives its branch more work than the best chain the node
+// reorganises onto that branch, disconnecting blocks back to the fork
+// point and connecting the new branch.
+// Returns true if the block is now on the best chain
+func (b *BlockChain) ProcessBlock(block *chain.Block) (bool, error) {
+	b.mtx.Lock()
+	isMain, notifications, err := b.processBlock(block)
+	b.mtx.Unlock()
+
+	b.sendNotifications(notifications)
+	return isMain, err
+}
+
+// processBlock ProcessBlock with the chain lock held. Returns the
+// changes to the best chain for the subscribers
+func (b *BlockChain) processBlock(block *chain.Block) (bool, []*Notification, error) {
+	hash := block.Hash()
+	if _, ok := b.index[hash]; ok {
+		return false, nil, ruleError(ErrDuplicateBlock, fmt.Sprintf("Already have block %s", hash))
+	}
+
+	var parent *blockNode
+	ctx := BlockContext{Now: time.Now()}
+	if len(b.index) == 0 && !block.Header.PrevBlockHash.IsZero() {
+		return false, nil, ruleError(
+			ErrMissingParent,
+			fmt.Sprintf("The first block %s must be a genesis block", hash),
+		)
+	}
+	if len(b.index) > 0 {
+		var ok bool
+		parent, ok = b.index[block.Header.PrevBlockHash]
+		if !ok {
+			return false, nil, ruleError(
+				ErrMissingParent,
+				fmt.Sprintf("Parent %s of block %s is not known", block.Header.PrevBlockHash, hash),
+			)
+		}
+		if parent.status == chain.BlockStatusInvalid {
+			return false, nil, ruleError(
+				ErrInvalidAncestor,
+				fmt.Sprintf("Block %s extends invalid block %s", hash, parent.hash),
+			)
+		}
+		ctx.Height = parent.height + 1
+		ctx.Prev = &parent.header
+		ctx.Ancestor = parent.ancestorFunc()
+	}
+
+	if err := ValidateBlock(block, b.params, ctx); err != nil {
+		return false, nil, err
+	}
+
+	node := newBlockNode(&block.Header, parent)
+	if err := chain.SaveBlockWithMeta(block, node.meta(), b.db); err != nil {
+		return false, nil, err
+	}
+	b.index[hash] = node
+
+	tip := b.tip()
+	if tip != nil && node.workSum.Cmp(tip.workSum) <= 0 {
+		return false, nil, nil
+	}
+
+	notifications, err := b.reorganise(node)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, notifications, nil
+}
+
+// reorganise Make newTip the tip of the best chain. Blocks are
+// disconnected back to the fork point then the new branch is connected.
+// If a block on the new branch fails validation it is marked invalid
+// and the old best chain is restored.
+// Returns the notifications for the blocks disconnected and connected
+func (b *BlockChain) reorganise(newTip *blockNode) ([]*Notification, error) {
+	oldTip := b.tip()
+
+	var fork *blockNode
+	if oldTip != nil {
+		fork = findFork(oldTip, newTip)
+	}
+
+	// Blocks to detach, from the old tip down to the fork
+	detach := []*blockNode{}
+	for n := oldTip; n != nil && n != fork; n = n.parent {
+		detach = append(detach, n)
+	}
+
+	// Blocks to attach, from the fork up to the new tip
+	attach := []*blockNode{}
+	for n := newTip; n != nil && n != fork; n = n.parent {
+		attach = append([]*blockNode{n}, attach...)
+	}
+
+	notifications := []*Notification{}
+	for _, node := range detach {
+		block, err := b.disconnectNode(node)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications,
+			&Notification{Type: NTBlockDisconnected, Block: block, Height: node.height})
+	}
+
+	for i, node := range attach {
+		block, err := b.connectNode(node)
+		if err == nil {
+			notifications = append(notifications,
+				&Notification{Type: NTBlockConnected, Block: block, Height: node.height})
+			continue
+		}
+
+		// The failed block and everything built on it are invalid
+		if _, ok := err.(*RuleError); ok {
+			for _, invalid := range attach[i:] {
+				if markErr := b.markInvalid(invalid); markErr != nil {
+					return nil, markErr
+				}
+			}
+		}
+
+		// Put the old best chain back. The best chain is unchanged
+		// so there is nothing to notify
+		for j := i - 1; j >= 0; j-- {
+			if _, rollbackErr := b.disconnectNode(attach[j]); rollbackErr != nil {
+				return nil, rollbackErr
+			}
+		}
+		for j := len(detach) - 1; j >= 0; j-- {
+			if _, rollbackErr := b.connectNode(detach[j]); rollbackErr != nil {
+				return nil, rollbackErr
+			}
+		}
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// markInvalid Flag node as invalid in the index and its saved metadata
+func (b *BlockChain) markInvalid(node *blockNode) error {
+	node.status = chain.BlockStatusInvalid
+	meta, err := chain.GetBlockMeta(node.hash, b.db)
+	if err != nil {
+		return err
+	}
+	meta.Status = chain.BlockStatusInvalid
+	return chain.SaveBlockMeta(node.hash, &meta, b.db)
+}
+
+// loadBlock Read a block from the database
+func (b *BlockChain) loadBlock(node *blockNode) (chain.Block, error) {
+	return chain.GetBlock(node.hash, b.db)
+}
+
+// connectNode Validate the transactions of the block against the utxo
+// set, then update the utxo set and append the block to the main chain.
+// Returns the connected block
+func (b *BlockChain) connectNode(node *blockNode) (*chain.Block, error) {
+	block, err := b.loadBlock(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.checkConnectBlock(&block, node); err != nil {
+		return nil, err
+	}
+
+	if err := b.utxos.ConnectBlock(&block, node.height); err != nil {
+		return nil, err
+	}
+
+	b.mainChain = append(b.mainChain[:node.height], node)
+	return &block, nil
+}
+
+// disconnectNode Remove the tip block from the main chain and
+// restore the utxos it spent. Returns the disconnected block
+func (b *BlockChain) disconnectNode(node *blockNode) (*chain.Block, error) {
+	block, err := b.loadBlock(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.utxos.DisconnectBlock(&block, node.height); err != nil {
+		return nil, err
+	}
+
+	b.mainChain = b.mainChain[:node.height]
+	return &block, nil
+}
+
+// checkConnectBlock Validate every non coinbase transaction of a block
+// against the utxo set it will be connected to, including the relative
+// lock times of their inputs, then check the coinbase claims no more
+// than the subsidy plus the fees of the block
+func (b *BlockChain) checkConnectBlock(block *chain.Block, node *blockNode) error {
+	// Relative lock times are checked against the median time past
+	// of the parent. The genesis block only has its coinbase
+	var medianTime int64
+	ancestor := node.ancestorFunc()
+	if node.parent != nil {
+		var err error
+		medianTime, err = CalcPastMedianTime(&node.parent.header, node.parent.height, ancestor)
+		if err != nil {
+			return err
+		}
+	}
+
+	view := newBlockUtxoView(b.utxos)
+	var totalFees int64
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if !tx.IsCoinBase() {
+			fee, err := ValidateTx(tx, view, node.height, b.params)
+			if err != nil {
+				return err
+			}
+			totalFees += fee
+			if totalFees > chain.MaxMoney {
+				return ruleError(
+					ErrBadTxOutValue,
+					fmt.Sprintf("Total fees %d are more than the maximum %d", totalFees, int64(chain.MaxMoney)),
+				)
+			}
+
+			if err := CheckSequenceLocks(tx, view, node.height, medianTime, ancestor); err != nil {
+				return err
+			}
+		}
+		view.applyTx(tx, node.height)
+	}
+	return CheckCoinbaseValue(&block.Transactions[0], node.height, totalFees, b.params)
+}
+
+// blockUtxoView A UtxoViewer over the utxo set which also sees the
+// outputs created and spent by the transactions of a block so far
+type blockUtxoView struct {
+	utxos   UtxoViewer
+	created map[chainhash.OutPoint]chain.Utxo
+	spent   map[chainhash.OutPoint]bool
+}
+
+func newBlockUtxoView(utxos UtxoViewer) *blockUtxoView {
+	return &blockUtxoView{
+		utxos:   utxos,
+		created: map[chainhash.OutPoint]chain.Utxo{},
+		spent:   map[chainhash.OutPoint]bool{},
+	}
+}
+
+// LookupUtxo Implements UtxoViewer
+func (v *blockUtxoView) LookupUtxo(outPoint chainhash.OutPoint) (*chain.Utxo, error) {
+	if v.spent[outPoint] {
+		return nil, nil
+	}
+	if utxo, ok := v.created[outPoint]; ok {
+		return &utxo, nil
+	}
+	return v.utxos.LookupUtxo(outPoint)
+}
+
+// applyTx Spend the inputs of tx and add its outputs, created at
+// height, to the view
+func (v *blockUtxoView) applyTx(tx *chain.Tx, height int32) {
+	if !tx.IsCoinBase() {
+		for i := range tx.Vin {
+			v.spent[tx.Vin[i].PreviousOutPoint()] = true
+		}
+	}
+	hash := tx.Hash()
+	for index, out := range tx.Vout {
+		op := chainhash.OutPoint{Hash: hash, Index: int32(index)}
+		v.created[op] = chain.Utxo{
+			Value:        out.Value,
+			ScriptPubKey: append([]byte{}, out.ScriptPubKey...),
+			Height:       height,
+			IsCoinBase:   tx.IsCoinBase(),
+		}
+	}
+}
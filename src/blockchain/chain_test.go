@@ -0,0 +1,464 @@
+package blockchain
+
+import (
+	"io/ioutil"
+	"os"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/key"
+	"spchain/leveldb"
+	"testing"
+	"time"
+)
+
+// chainTestHarness A BlockChain on a temporary database
+type chainTestHarness struct {
+	t      *testing.T
+	chain  *BlockChain
+	params chaincfg.Params
+	dir    string
+	ldb    leveldb.LevelDb
+	key    key.Key
+}
+
+func newChainTestHarness(t *testing.T) *chainTestHarness {
+	dir, err := ioutil.TempDir("", "spchain-blockchain")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	ldb, err := leveldb.InitDatabaseAtPath(dir)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+
+	h := &chainTestHarness{
+		t:      t,
+		params: chaincfg.RegressionNetParams,
+		dir:    dir,
+		ldb:    ldb,
+		key:    testKey(),
+	}
+
+	// Use a genesis block which pays the harness key so it can be spent
+	genesis := h.mineBlock(nil, []chain.Tx{h.coinbase(0, 0)})
+	h.params.GenesisBlock = &genesis
+	h.params.GenesisHash = genesis.Hash()
+	// Let the tests spend the genesis coinbase from the next block
+	h.params.CoinbaseMaturity = 1
+
+	h.chain, err = New(&h.params, &h.ldb)
+	if err != nil {
+		t.Fatalf("Unable to create chain %s", err)
+	}
+	return h
+}
+
+func (h *chainTestHarness) close() {
+	h.ldb.Db.Close()
+	os.RemoveAll(h.dir)
+}
+
+// coinbase A coinbase unique to height and branch paying to the harness key
+func (h *chainTestHarness) coinbase(height int32, branch byte) chain.Tx {
+	return h.coinbaseWithValue(height, branch, 5000)
+}
+
+func (h *chainTestHarness) coinbaseWithValue(height int32, branch byte, value int64) chain.Tx {
+	return chain.NewCoinBaseTx(height, uint64(branch), value, p2pkhOutput(value, h.key).ScriptPubKey)
+}
+
+// spend A signed transaction spending output index of prev
+func (h *chainTestHarness) spend(prev *chain.Tx, index int32, value int64) chain.Tx {
+	prevHash := prev.Hash()
+	tx := chain.Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin:     []chain.InputTx{{Txid: prevHash, OutInx: index}},
+		Vout:    []chain.OutputTx{p2pkhOutput(value, h.key)},
+	}
+	view := mapUtxoView{}
+	view.add(prevHash, index, prev.Vout[index])
+	signTx(&tx, h.key, view)
+	return tx
+}
+
+// mineBlock Create a mined block on top of parent, nil for genesis
+func (h *chainTestHarness) mineBlock(parent *chain.Block, txs []chain.Tx) chain.Block {
+	block := chain.Block{
+		Header: chain.BlockHeader{
+			Version:          1,
+			TimeStamp:        time.Now().Add(-time.Hour).Unix(),
+			DifficultyTarget: int32(h.params.PowLimitBits),
+		},
+		Transactions: txs,
+	}
+	if parent != nil {
+		prevHash := parent.Hash()
+		block.Header.PrevBlockHash = prevHash
+		block.Header.TimeStamp = parent.Header.TimeStamp + 1
+		bits, err := h.chain.NextRequiredDifficulty(prevHash)
+		if err != nil {
+			h.t.Fatalf("Unable to get difficulty %s", err)
+		}
+		block.Header.DifficultyTarget = int32(bits)
+	}
+	finaliseBlock(h.t, &block)
+	return block
+}
+
+// extend Mine count coinbase only blocks on top of parent
+func (h *chainTestHarness) extend(parent chain.Block, height int32, count int, branch byte) []chain.Block {
+	blocks := []chain.Block{}
+	for i := 0; i < count; i++ {
+		height++
+		block := h.mineBlock(&parent, []chain.Tx{h.coinbase(height, branch)})
+		h.process(&block)
+		blocks = append(blocks, block)
+		parent = block
+	}
+	return blocks
+}
+
+func (h *chainTestHarness) process(block *chain.Block) bool {
+	isMain, err := h.chain.ProcessBlock(block)
+	if err != nil {
+		h.t.Fatalf("Unexpected error processing block %s", err)
+	}
+	return isMain
+}
+
+func (h *chainTestHarness) hasUtxo(tx *chain.Tx, index int32) bool {
+	utxo, err := h.chain.UtxoSet().Get(chainhash.OutPoint{Hash: tx.Hash(), Index: index})
+	if err != nil {
+		h.t.Fatalf("Unexpected error %s", err)
+	}
+	return utxo != nil
+}
+
+func (h *chainTestHarness) genesis() chain.Block {
+	return *h.params.GenesisBlock
+}
+
+func TestProcessBlockExtendsChain(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	genesis := h.genesis()
+	blocks := h.extend(genesis, 0, 3, 0)
+
+	if h.chain.BestHeight() != 3 {
+		t.Errorf("Expected height 3, got %d", h.chain.BestHeight())
+	}
+	if h.chain.BestHash() != blocks[2].Hash() {
+		t.Errorf("Expected the last block to be the tip")
+	}
+	header, err := h.chain.HeaderByHeight(1)
+	if err != nil || header.Hash() != blocks[0].Hash() {
+		t.Errorf("Expected block 1 at height 1")
+	}
+	if !h.hasUtxo(&blocks[2].Transactions[0], 0) {
+		t.Errorf("Expected the coinbase of the tip in the utxo set")
+	}
+}
+
+func TestProcessBlockRejects(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	orphan := h.mineBlock(nil, []chain.Tx{h.coinbase(1, 0)})
+	orphan.Header.PrevBlockHash = chainhash.Hash{1}
+	finaliseBlock(t, &orphan)
+	_, err := h.chain.ProcessBlock(&orphan)
+	expectRuleError(t, err, ErrMissingParent)
+
+	genesis := h.genesis()
+	_, err = h.chain.ProcessBlock(&genesis)
+	expectRuleError(t, err, ErrDuplicateBlock)
+}
+
+func TestNewFromGenesis(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "spchain-blockchain")
+	defer os.RemoveAll(dir)
+	ldb, err := leveldb.InitDatabaseAtPath(dir)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer ldb.Db.Close()
+
+	for _, params := range []*chaincfg.Params{&chaincfg.RegressionNetParams, &chaincfg.TestNetParams, &chaincfg.MainNetParams} {
+		if err := ValidateBlock(params.GenesisBlock, params, BlockContext{}); err != nil {
+			t.Errorf("%s: genesis block is invalid %s", params.Name, err)
+		}
+	}
+
+	bc, err := New(&chaincfg.RegressionNetParams, &ldb)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if bc.BestHeight() != 0 || bc.BestHash() != chaincfg.RegressionNetParams.GenesisHash {
+		t.Errorf("Expected the genesis block to be the tip")
+	}
+}
+
+func TestReorganise(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	genesis := h.genesis()
+	mainBranch := h.extend(genesis, 0, 2, 'a')
+
+	// A transaction on the main branch spending the genesis coinbase
+	spend := h.spend(&genesis.Transactions[0], 0, 4000)
+	withSpend := h.mineBlock(&mainBranch[1], []chain.Tx{h.coinbase(3, 'a'), spend})
+	if !h.process(&withSpend) {
+		t.Fatalf("Expected block to extend the main chain")
+	}
+	if h.hasUtxo(&genesis.Transactions[0], 0) || !h.hasUtxo(&spend, 0) {
+		t.Fatalf("Expected the genesis coinbase to be spent")
+	}
+
+	// A competing branch from block 1 with equal work does not reorganise
+	sideBranch := h.extend(mainBranch[0], 1, 2, 'b')
+	if h.chain.BestHash() != withSpend.Hash() {
+		t.Errorf("Expected the first seen branch to stay the tip")
+	}
+	if h.chain.IsMainChain(sideBranch[1].Hash()) {
+		t.Errorf("Expected the side branch not to be the main chain")
+	}
+
+	// One more block gives the side branch more work
+	more := h.extend(sideBranch[1], 3, 1, 'b')
+	if h.chain.BestHash() != more[0].Hash() || h.chain.BestHeight() != 4 {
+		t.Fatalf("Expected the side branch to become the tip")
+	}
+	if h.chain.IsMainChain(withSpend.Hash()) || h.chain.IsMainChain(mainBranch[1].Hash()) {
+		t.Errorf("Expected the old branch to be disconnected")
+	}
+
+	// The utxo set follows the new branch
+	if !h.hasUtxo(&genesis.Transactions[0], 0) {
+		t.Errorf("Expected the genesis coinbase to be restored")
+	}
+	if h.hasUtxo(&spend, 0) || h.hasUtxo(&mainBranch[1].Transactions[0], 0) {
+		t.Errorf("Expected outputs of the old branch to be removed")
+	}
+	if !h.hasUtxo(&more[0].Transactions[0], 0) || !h.hasUtxo(&sideBranch[0].Transactions[0], 0) {
+		t.Errorf("Expected outputs of the new branch to be added")
+	}
+	header, _ := h.chain.HeaderByHeight(2)
+	if header.Hash() != sideBranch[0].Hash() {
+		t.Errorf("Expected height 2 to be on the side branch")
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	genesis := h.genesis()
+	mainBranch := h.extend(genesis, 0, 2, 'a')
+
+	received := []*Notification{}
+	h.chain.Subscribe(func(n *Notification) {
+		// The chain lock is released before subscribers are called
+		h.chain.BestHeight()
+		received = append(received, n)
+	})
+
+	sideBranch := h.extend(genesis, 0, 3, 'b')
+	expected := []struct {
+		notificationType NotificationType
+		block            chain.Block
+		height           int32
+	}{
+		{NTBlockDisconnected, mainBranch[1], 2},
+		{NTBlockDisconnected, mainBranch[0], 1},
+		{NTBlockConnected, sideBranch[0], 1},
+		{NTBlockConnected, sideBranch[1], 2},
+		{NTBlockConnected, sideBranch[2], 3},
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("Expected %d notifications, got %d", len(expected), len(received))
+	}
+	for i, want := range expected {
+		n := received[i]
+		if n.Type != want.notificationType || n.Height != want.height || n.Block.Hash() != want.block.Hash() {
+			t.Errorf("Notification %d: expected %s at height %d, got %s at height %d",
+				i, want.notificationType, want.height, n.Type, n.Height)
+		}
+	}
+}
+
+func TestReorganiseToInvalidBranch(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	genesis := h.genesis()
+	mainBranch := h.extend(genesis, 0, 1, 'a')
+
+	// The side branch spends an output which doesn't exist. The block
+	// is fine on its own so is accepted into the index
+	side1 := h.mineBlock(&genesis, []chain.Tx{h.coinbase(1, 'b')})
+	h.process(&side1)
+	missing := mainBranch[0].Transactions[0]
+	badSpend := h.spend(&missing, 0, 10)
+	side2 := h.mineBlock(&side1, []chain.Tx{h.coinbase(2, 'b'), badSpend})
+
+	_, err := h.chain.ProcessBlock(&side2)
+	expectRuleError(t, err, ErrMissingTxOut)
+
+	if h.chain.BestHash() != mainBranch[0].Hash() {
+		t.Errorf("Expected the original tip to be restored")
+	}
+	if !h.hasUtxo(&mainBranch[0].Transactions[0], 0) || h.hasUtxo(&side1.Transactions[0], 0) {
+		t.Errorf("Expected the utxo set of the original chain")
+	}
+
+	meta, err := chain.GetBlockMeta(side2.Hash(), &h.ldb)
+	if err != nil || meta.Status != chain.BlockStatusInvalid || meta.Height != 2 {
+		t.Errorf("Expected the saved metadata to mark the block invalid, got %#v %v", meta, err)
+	}
+
+	side3 := h.mineBlock(&side2, []chain.Tx{h.coinbase(3, 'b')})
+	_, err = h.chain.ProcessBlock(&side3)
+	expectRuleError(t, err, ErrInvalidAncestor)
+}
+
+func TestCoinbaseValue(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	genesis := h.genesis()
+	subsidy := CalcBlockSubsidy(1, &h.params)
+
+	tooMuch := h.mineBlock(&genesis, []chain.Tx{h.coinbaseWithValue(1, 0, subsidy+1)})
+	_, err := h.chain.ProcessBlock(&tooMuch)
+	expectRuleError(t, err, ErrBadCoinbaseValue)
+
+	// The coinbase may also claim the fee of the spend
+	spend := h.spend(&genesis.Transactions[0], 0, 4000)
+	withFees := h.mineBlock(&genesis, []chain.Tx{h.coinbaseWithValue(1, 1, subsidy+1000), spend})
+	if !h.process(&withFees) {
+		t.Errorf("Expected the coinbase to claim subsidy plus fees")
+	}
+}
+
+func TestSequenceLockedSpend(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	// Spend the genesis coinbase no sooner than three blocks after it
+	genesis := h.genesis()
+	locked := h.spend(&genesis.Transactions[0], 0, 5000)
+	locked.Version = chain.TxVersionSequenceLock
+	locked.Vin[0].Sequence = 3
+	view := mapUtxoView{}
+	view.add(locked.Vin[0].Txid, 0, genesis.Transactions[0].Vout[0])
+	signTx(&locked, h.key, view)
+
+	early := h.mineBlock(&genesis, []chain.Tx{h.coinbase(1, 1), locked})
+	_, err := h.chain.ProcessBlock(&early)
+	expectRuleError(t, err, ErrSequenceLockNotMet)
+
+	blocks := h.extend(genesis, 0, 2, 0)
+	onTime := h.mineBlock(&blocks[1], []chain.Tx{h.coinbase(3, 0), locked})
+	if !h.process(&onTime) {
+		t.Errorf("Expected the spend to be accepted three blocks after its input")
+	}
+}
+
+func TestImmatureCoinbaseSpend(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+	h.params.CoinbaseMaturity = 3
+
+	genesis := h.genesis()
+	spend := h.spend(&genesis.Transactions[0], 0, 4000)
+	blocks := h.extend(genesis, 0, 1, 0)
+	early := h.mineBlock(&blocks[0], []chain.Tx{h.coinbase(2, 0), spend})
+	_, err := h.chain.ProcessBlock(&early)
+	expectRuleError(t, err, ErrImmatureSpend)
+
+	blocks = h.extend(blocks[0], 1, 1, 1)
+	mature := h.mineBlock(&blocks[0], []chain.Tx{h.coinbase(3, 0), spend})
+	if !h.process(&mature) {
+		t.Errorf("Expected the coinbase to be spendable %d blocks after it", h.params.CoinbaseMaturity)
+	}
+}
+
+func TestNewFromDatabase(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	blocks := h.extend(h.genesis(), 0, 3, 0)
+
+	reopened, err := New(&h.params, &h.ldb)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if reopened.BestHeight() != 3 || reopened.BestHash() != blocks[2].Hash() {
+		t.Errorf("Expected the saved best chain to be loaded")
+	}
+	if reopened.BestChainWork().Cmp(h.chain.BestChainWork()) != 0 {
+		t.Errorf("Expected chain work %s, got %s", h.chain.BestChainWork(), reopened.BestChainWork())
+	}
+
+	block, err := chain.GetBlockByHeight(2, &h.ldb)
+	if err != nil || block.Hash() != blocks[1].Hash() {
+		t.Errorf("Expected block 2 from the height index, got %v", err)
+	}
+
+	// A block extending the loaded tip connects
+	next := h.mineBlock(&blocks[2], []chain.Tx{h.coinbase(4, 0)})
+	if isMain, err := reopened.ProcessBlock(&next); err != nil || !isMain {
+		t.Errorf("Expected the block to extend the loaded chain, got %v", err)
+	}
+
+	other := chaincfg.RegressionNetParams
+	if _, err := New(&other, &h.ldb); err == nil {
+		t.Errorf("Expected an error loading a database for a different genesis block")
+	}
+}
+
+func TestNewFromDatabaseSideBranches(t *testing.T) {
+	h := newChainTestHarness(t)
+	defer h.close()
+
+	// A side branch of one valid and one invalid block beside the tip
+	genesis := h.genesis()
+	mainBranch := h.extend(genesis, 0, 1, 'a')
+	side1 := h.mineBlock(&genesis, []chain.Tx{h.coinbase(1, 'b')})
+	h.process(&side1)
+	missing := mainBranch[0].Transactions[0]
+	side2 := h.mineBlock(&side1, []chain.Tx{h.coinbase(2, 'b'), h.spend(&missing, 0, 10)})
+	if _, err := h.chain.ProcessBlock(&side2); err == nil {
+		t.Fatalf("Expected the side branch to be invalid")
+	}
+
+	reopened, err := New(&h.params, &h.ldb)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if reopened.BestHash() != mainBranch[0].Hash() {
+		t.Errorf("Expected the saved best chain to be loaded")
+	}
+	if !reopened.HaveBlock(side1.Hash()) || !reopened.HaveBlock(side2.Hash()) {
+		t.Fatalf("Expected the side branch in the index")
+	}
+
+	// The invalid block is still known to be invalid
+	side3 := h.mineBlock(&side2, []chain.Tx{h.coinbase(3, 'b')})
+	_, err = reopened.ProcessBlock(&side3)
+	expectRuleError(t, err, ErrInvalidAncestor)
+
+	// The valid side block can still be built on
+	other2 := h.mineBlock(&side1, []chain.Tx{h.coinbase(2, 'c')})
+	if isMain, err := reopened.ProcessBlock(&other2); err != nil || !isMain {
+		t.Fatalf("Expected the side branch to become the best chain, got %v", err)
+	}
+	if reopened.BestHeight() != 2 || reopened.IsMainChain(mainBranch[0].Hash()) {
+		t.Errorf("Expected a reorganisation onto the loaded side branch")
+	}
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/mining"
+)
+
+// AncestorFunc Return the header at height on the branch being
+// extended by a new block
+type AncestorFunc func(height int32) (*chain.BlockHeader, error)
+
+// CalcNextRequiredDifficulty Calculate the DifficultyTarget required for
+// the block following prev, which is at prevHeight.
+// Every params.RetargetInterval blocks the target is scaled by the time the
+// last window of blocks actually took versus the time it should have taken.
+// The scaling is clamped to params.RetargetAdjustmentFactor and the target
+// is never allowed above params.PowLimit.
+// Between adjustments the target of prev is carried forward
+func CalcNextRequiredDifficulty(params *chaincfg.Params, prev *chain.BlockHeader, prevHeight int32, ancestor AncestorFunc) (uint32, error) {
+	// The genesis block has no parent so uses the easiest target
+	if prev == nil {
+		return params.PowLimitBits, nil
+	}
+
+	height := prevHeight + 1
+	if params.RetargetInterval <= 0 || height%params.RetargetInterval != 0 {
+		return uint32(prev.DifficultyTarget), nil
+	}
+
+	firstHeight := prevHeight - params.RetargetInterval
+	if firstHeight < 0 {
+		firstHeight = 0
+	}
+	first, err := ancestor(firstHeight)
+	if err != nil || first == nil {
+		return 0, ruleError(
+			ErrMissingAncestor,
+			fmt.Sprintf("Unable to find ancestor at height %d for retarget: %v", firstHeight, err),
+		)
+	}
+
+	targetTimePerBlock := int64(params.TargetTimePerBlock.Seconds())
+	expectedTimespan := targetTimePerBlock * int64(prevHeight-firstHeight)
+	if expectedTimespan <= 0 {
+		return uint32(prev.DifficultyTarget), nil
+	}
+
+	// Limit the adjustment in either direction
+	actualTimespan := prev.TimeStamp - first.TimeStamp
+	minTimespan := expectedTimespan / params.RetargetAdjustmentFactor
+	maxTimespan := expectedTimespan * params.RetargetAdjustmentFactor
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+
+	// newTarget = oldTarget * actualTimespan / expectedTimespan
+	newTarget := mining.CompactToBig(uint32(prev.DifficultyTarget))
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(expectedTimespan))
+
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget.Set(params.PowLimit)
+	}
+
+	return mining.BigToCompact(newTarget), nil
+}
+
+// CheckHeaderDifficulty Check the DifficultyTarget of header, which is
+// at prevHeight+1, is exactly the one required by the retargeting rules
+func CheckHeaderDifficulty(params *chaincfg.Params, header *chain.BlockHeader, prev *chain.BlockHeader, prevHeight int32, ancestor AncestorFunc) error {
+	required, err := CalcNextRequiredDifficulty(params, prev, prevHeight, ancestor)
+	if err != nil {
+		return err
+	}
+
+	if uint32(header.DifficultyTarget) != required {
+		return ruleError(
+			ErrUnexpectedDifficulty,
+			fmt.Sprintf("Block difficulty %#08x does not match the required difficulty %#08x",
+				uint32(header.DifficultyTarget), required),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/mining"
+	"testing"
+	"time"
+)
+
+func difficultyTestParams() chaincfg.Params {
+	params := chaincfg.MainNetParams
+	params.TargetTimePerBlock = 10 * time.Second
+	params.RetargetInterval = 10
+	return params
+}
+
+// headerChain Create headers at heights 0..count-1 spaced by spacing seconds
+func headerChain(count int, spacing int64, bits uint32) []chain.BlockHeader {
+	headers := []chain.BlockHeader{}
+	for i := 0; i < count; i++ {
+		headers = append(headers, chain.BlockHeader{
+			Version:          1,
+			TimeStamp:        1550000000 + int64(i)*spacing,
+			DifficultyTarget: int32(bits),
+		})
+	}
+	return headers
+}
+
+func ancestorFromSlice(headers []chain.BlockHeader) AncestorFunc {
+	return func(height int32) (*chain.BlockHeader, error) {
+		if height < 0 || int(height) >= len(headers) {
+			return nil, errors.New("no such height")
+		}
+		return &headers[height], nil
+	}
+}
+
+func TestDifficultyCarriedBetweenRetargets(t *testing.T) {
+	params := difficultyTestParams()
+	headers := headerChain(5, 1, 0x1c0ffff0)
+
+	bits, err := CalcNextRequiredDifficulty(&params, &headers[4], 4, ancestorFromSlice(headers))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if bits != 0x1c0ffff0 {
+		t.Errorf("Expected %#x, got %#x", 0x1c0ffff0, bits)
+	}
+}
+
+func TestDifficultyGenesis(t *testing.T) {
+	params := difficultyTestParams()
+	bits, err := CalcNextRequiredDifficulty(&params, nil, -1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if bits != params.PowLimitBits {
+		t.Errorf("Expected %#x, got %#x", params.PowLimitBits, bits)
+	}
+}
+
+func TestDifficultyOnSchedule(t *testing.T) {
+	params := difficultyTestParams()
+	headers := headerChain(10, 10, 0x1c0ffff0)
+
+	bits, err := CalcNextRequiredDifficulty(&params, &headers[9], 9, ancestorFromSlice(headers))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if bits != 0x1c0ffff0 {
+		t.Errorf("Expected unchanged target %#x, got %#x", 0x1c0ffff0, bits)
+	}
+}
+
+func TestDifficultyAdjustment(t *testing.T) {
+	params := difficultyTestParams()
+	oldTarget := mining.CompactToBig(0x1c0ffff0)
+
+	tests := []struct {
+		name     string
+		spacing  int64
+		timespan int64
+	}{
+		// Twice as slow as expected, so the target doubles
+		{"slow", 20, 180},
+		// Blocks every second would be a 10x increase, clamped to 4x
+		{"clamped fast", 1, 90 / 4},
+		// Blocks every 100 seconds would be a 10x decrease, clamped to 4x
+		{"clamped slow", 100, 90 * 4},
+	}
+
+	for _, test := range tests {
+		headers := headerChain(10, test.spacing, 0x1c0ffff0)
+		bits, err := CalcNextRequiredDifficulty(&params, &headers[9], 9, ancestorFromSlice(headers))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", test.name, err)
+		}
+
+		expected := new(big.Int).Mul(oldTarget, big.NewInt(test.timespan))
+		expected.Div(expected, big.NewInt(90))
+		if bits != mining.BigToCompact(expected) {
+			t.Errorf("%s: expected %#x, got %#x", test.name, mining.BigToCompact(expected), bits)
+		}
+	}
+}
+
+func TestDifficultyPowLimit(t *testing.T) {
+	params := difficultyTestParams()
+	headers := headerChain(10, 1000, params.PowLimitBits)
+
+	bits, err := CalcNextRequiredDifficulty(&params, &headers[9], 9, ancestorFromSlice(headers))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if bits != params.PowLimitBits {
+		t.Errorf("Expected target capped at %#x, got %#x", params.PowLimitBits, bits)
+	}
+}
+
+func TestCheckHeaderDifficulty(t *testing.T) {
+	params := difficultyTestParams()
+	headers := headerChain(10, 20, 0x1c0ffff0)
+	ancestor := ancestorFromSlice(headers)
+
+	required, _ := CalcNextRequiredDifficulty(&params, &headers[9], 9, ancestor)
+	next := headers[9]
+	next.DifficultyTarget = int32(required)
+	if err := CheckHeaderDifficulty(&params, &next, &headers[9], 9, ancestor); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	next.DifficultyTarget = 0x1c0ffff0
+	err := CheckHeaderDifficulty(&params, &next, &headers[9], 9, ancestor)
+	ruleErr, ok := err.(*RuleError)
+	if !ok || ruleErr.Code != ErrUnexpectedDifficulty {
+		t.Errorf("Expected %s, got %v", ErrUnexpectedDifficulty, err)
+	}
+}
+
+func TestDifficultyMissingAncestor(t *testing.T) {
+	params := difficultyTestParams()
+	headers := headerChain(10, 10, 0x1c0ffff0)
+
+	_, err := CalcNextRequiredDifficulty(&params, &headers[9], 9, ancestorFromSlice(nil))
+	ruleErr, ok := err.(*RuleError)
+	if !ok || ruleErr.Code != ErrMissingAncestor {
+		t.Errorf("Expected %s, got %v", ErrMissingAncestor, err)
+	}
+}
@@ -0,0 +1,187 @@
+package blockchain
+
+// ErrorCode Identifies which consensus rule was broken
+type ErrorCode int
+
+const (
+	// ErrUnexpectedDifficulty The header DifficultyTarget does not
+	// match the target required by the retargeting rules
+	ErrUnexpectedDifficulty ErrorCode = iota
+
+	// ErrMissingAncestor A header needed to validate a block
+	// could not be found
+	ErrMissingAncestor
+
+	// ErrHighHash The block hash is above its target
+	ErrHighHash
+
+	// ErrDifficultyAboveLimit The block target is easier than the
+	// network proof of work limit
+	ErrDifficultyAboveLimit
+
+	// ErrBadMerkleRoot The header MerkleRoot does not match the
+	// transactions in the block
+	ErrBadMerkleRoot
+
+	// ErrBadTxCount TxCount does not match the number of transactions
+	ErrBadTxCount
+
+	// ErrBadBlockSize The Size field does not match the serialised size
+	ErrBadBlockSize
+
+	// ErrBlockTooBig The serialised block is larger than MaxBlockSize
+	ErrBlockTooBig
+
+	// ErrNoTransactions The block has no transactions
+	ErrNoTransactions
+
+	// ErrFirstTxNotCoinbase The first transaction is not a coinbase
+	ErrFirstTxNotCoinbase
+
+	// ErrMultipleCoinbases A transaction other than the first is a coinbase
+	ErrMultipleCoinbases
+
+	// ErrDuplicateTx The same transaction appears twice in the block
+	ErrDuplicateTx
+
+	// ErrTimeTooOld The block timestamp is not after the median time
+	// of the previous blocks
+	ErrTimeTooOld
+
+	// ErrTimeTooNew The block timestamp is too far in the future
+	ErrTimeTooNew
+
+	// ErrBadPrevBlock The header PrevBlockHash is not the hash of
+	// the parent block
+	ErrBadPrevBlock
+
+	// ErrNoTxInputs The transaction has no inputs
+	ErrNoTxInputs
+
+	// ErrNoTxOutputs The transaction has no outputs
+	ErrNoTxOutputs
+
+	// ErrBadTxInOutCount TxInNo or TxOutNo does not match the number
+	// of inputs or outputs
+	ErrBadTxInOutCount
+
+	// ErrBadTxOutValue An output value is negative, more than MaxMoney
+	// or the outputs sum to more than MaxMoney
+	ErrBadTxOutValue
+
+	// ErrBadTxInput A non coinbase transaction spends the null
+	// outpoint
+	ErrBadTxInput
+
+	// ErrDoubleSpend The same output is spent more than once
+	ErrDoubleSpend
+
+	// ErrUnexpectedCoinbase A coinbase was given where a normal
+	// transaction was expected
+	ErrUnexpectedCoinbase
+
+	// ErrMissingTxOut An input spends an output which doesn't exist
+	// or has already been spent
+	ErrMissingTxOut
+
+	// ErrSpendTooHigh The outputs are worth more than the inputs
+	ErrSpendTooHigh
+
+	// ErrScriptValidation The input ScriptSig does not unlock the
+	// ScriptPubKey it spends
+	ErrScriptValidation
+
+	// ErrDuplicateBlock The block is already in the block index
+	ErrDuplicateBlock
+
+	// ErrMissingParent The parent of the block is not known
+	ErrMissingParent
+
+	// ErrInvalidAncestor The block extends a block which failed validation
+	ErrInvalidAncestor
+
+	// ErrBadCoinbaseValue The coinbase pays out more than the block
+	// subsidy plus the fees of the block
+	ErrBadCoinbaseValue
+
+	// ErrUnfinalizedTx A transaction LockTime has not been reached
+	// by the block
+	ErrUnfinalizedTx
+
+	// ErrSequenceLockNotMet The relative lock time of a transaction
+	// input has not been reached by the block
+	ErrSequenceLockNotMet
+
+	// ErrImmatureSpend A transaction spends a coinbase output before
+	// it is CoinbaseMaturity blocks deep
+	ErrImmatureSpend
+
+	// ErrScriptTooLong A script of a transaction before
+	// TxVersionCompactSize is longer than its single length byte allows
+	ErrScriptTooLong
+
+	// ErrBadCoinbaseHeight The coinbase ScriptSig does not start with
+	// the height of the block
+	ErrBadCoinbaseHeight
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrUnexpectedDifficulty: "ErrUnexpectedDifficulty",
+	ErrMissingAncestor:      "ErrMissingAncestor",
+	ErrHighHash:             "ErrHighHash",
+	ErrDifficultyAboveLimit: "ErrDifficultyAboveLimit",
+	ErrBadMerkleRoot:        "ErrBadMerkleRoot",
+	ErrBadTxCount:           "ErrBadTxCount",
+	ErrBadBlockSize:         "ErrBadBlockSize",
+	ErrBlockTooBig:          "ErrBlockTooBig",
+	ErrNoTransactions:       "ErrNoTransactions",
+	ErrFirstTxNotCoinbase:   "ErrFirstTxNotCoinbase",
+	ErrMultipleCoinbases:    "ErrMultipleCoinbases",
+	ErrDuplicateTx:          "ErrDuplicateTx",
+	ErrTimeTooOld:           "ErrTimeTooOld",
+	ErrTimeTooNew:           "ErrTimeTooNew",
+	ErrBadPrevBlock:         "ErrBadPrevBlock",
+	ErrNoTxInputs:           "ErrNoTxInputs",
+	ErrNoTxOutputs:          "ErrNoTxOutputs",
+	ErrBadTxInOutCount:      "ErrBadTxInOutCount",
+	ErrBadTxOutValue:        "ErrBadTxOutValue",
+	ErrBadTxInput:           "ErrBadTxInput",
+	ErrDoubleSpend:          "ErrDoubleSpend",
+	ErrUnexpectedCoinbase:   "ErrUnexpectedCoinbase",
+	ErrMissingTxOut:         "ErrMissingTxOut",
+	ErrSpendTooHigh:         "ErrSpendTooHigh",
+	ErrScriptValidation:     "ErrScriptValidation",
+	ErrDuplicateBlock:       "ErrDuplicateBlock",
+	ErrMissingParent:        "ErrMissingParent",
+	ErrInvalidAncestor:      "ErrInvalidAncestor",
+	ErrBadCoinbaseValue:     "ErrBadCoinbaseValue",
+	ErrUnfinalizedTx:        "ErrUnfinalizedTx",
+	ErrSequenceLockNotMet:   "ErrSequenceLockNotMet",
+	ErrImmatureSpend:        "ErrImmatureSpend",
+	ErrScriptTooLong:        "ErrScriptTooLong",
+	ErrBadCoinbaseHeight:    "ErrBadCoinbaseHeight",
+}
+
+// String The name of the error code
+func (e ErrorCode) String() string {
+	if s, ok := errorCodeStrings[e]; ok {
+		return s
+	}
+	return "Unknown ErrorCode"
+}
+
+// RuleError A block or transaction broke a consensus rule.
+// Code says which rule failed and Msg gives the details
+type RuleError struct {
+	Code ErrorCode
+	Msg  string
+}
+
+func (e *RuleError) Error() string {
+	return e.Msg
+}
+
+// ruleError Create a RuleError
+func ruleError(code ErrorCode, msg string) *RuleError {
+	return &RuleError{Code: code, Msg: msg}
+}
@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"fmt"
+	"spchain/chain"
+)
+
+// SequenceLock The last block height and median time past at which a
+// transaction is still locked by the relative lock times of its
+// inputs. -1 when there is no lock
+type SequenceLock struct {
+	Height int32
+	Time   int64
+}
+
+// CalcSequenceLock The SequenceLock of tx. The outputs it spends are
+// looked up in view, and ancestor must find the blocks before the
+// heights they were created at
+func CalcSequenceLock(tx *chain.Tx, view UtxoViewer, ancestor AncestorFunc) (SequenceLock, error) {
+	lock := SequenceLock{Height: -1, Time: -1}
+	if tx.IsCoinBase() || tx.Version < chain.TxVersionSequenceLock {
+		return lock, nil
+	}
+
+	for i := range tx.Vin {
+		in := &tx.Vin[i]
+		sequence := uint32(in.Sequence)
+		if sequence&chain.SequenceLockTimeDisabled != 0 {
+			continue
+		}
+
+		utxo, err := view.LookupUtxo(in.PreviousOutPoint())
+		if err != nil {
+			return lock, err
+		}
+		if utxo == nil {
+			return lock, ruleError(
+				ErrMissingTxOut,
+				fmt.Sprintf("Input %d spends %s which does not exist or is already spent", i, in.PreviousOutPoint()),
+			)
+		}
+
+		relative := int64(sequence & chain.SequenceLockTimeMask)
+		if sequence&chain.SequenceLockTimeIsSeconds == 0 {
+			height := utxo.Height + int32(relative) - 1
+			if height > lock.Height {
+				lock.Height = height
+			}
+			continue
+		}
+
+		// Time locks start from the median time past of the block
+		// before the one which created the output
+		prevHeight := utxo.Height - 1
+		if prevHeight < 0 {
+			prevHeight = 0
+		}
+		prev, err := ancestor(prevHeight)
+		if err != nil || prev == nil {
+			return lock, ruleError(
+				ErrMissingAncestor,
+				fmt.Sprintf("Unable to find ancestor at height %d for a relative lock time: %v", prevHeight, err),
+			)
+		}
+		medianTime, err := CalcPastMedianTime(prev, prevHeight, ancestor)
+		if err != nil {
+			return lock, err
+		}
+		lockTime := medianTime + relative<<chain.SequenceLockTimeGranularity - 1
+		if lockTime > lock.Time {
+			lock.Time = lockTime
+		}
+	}
+	return lock, nil
+}
+
+// SequenceLockActive True if lock still locks a transaction in a block
+// at height whose parent has the median time past medianTime
+func SequenceLockActive(lock SequenceLock, height int32, medianTime int64) bool {
+	return lock.Height >= height || lock.Time >= medianTime
+}
+
+// CheckSequenceLocks Check the relative lock times of the inputs of tx
+// allow it in a block at height whose parent has the median time past
+// medianTime
+func CheckSequenceLocks(tx *chain.Tx, view UtxoViewer, height int32, medianTime int64, ancestor AncestorFunc) error {
+	lock, err := CalcSequenceLock(tx, view, ancestor)
+	if err != nil {
+		return err
+	}
+	if SequenceLockActive(lock, height, medianTime) {
+		return ruleError(
+			ErrSequenceLockNotMet,
+			fmt.Sprintf("Transaction is locked until after height %d and time %d, block is at height %d and time %d",
+				lock.Height, lock.Time, height, medianTime),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"spchain/chain"
+	"testing"
+)
+
+// lockTimeHeaders count headers one hundred seconds apart from time 1000
+func lockTimeHeaders(count int) []chain.BlockHeader {
+	headers := []chain.BlockHeader{}
+	for i := 0; i < count; i++ {
+		headers = append(headers, chain.BlockHeader{TimeStamp: int64(1000 + 100*i)})
+	}
+	return headers
+}
+
+// sequenceLockTestTx A version 2 transaction spending one output
+// created at height 5 and one at height 12
+func sequenceLockTestTx(first uint32, second uint32) (chain.Tx, mapUtxoView) {
+	view := mapUtxoView{}
+	view.addAt(fundingTxid(1), 0, p2pkhOutput(1000, testKey()), 5)
+	view.addAt(fundingTxid(2), 0, p2pkhOutput(1000, testKey()), 12)
+	tx := chain.Tx{
+		Version: chain.TxVersionSequenceLock,
+		TxInNo:  2,
+		TxOutNo: 1,
+		Vin: []chain.InputTx{
+			{Txid: fundingTxid(1), OutInx: 0, Sequence: int32(first)},
+			{Txid: fundingTxid(2), OutInx: 0, Sequence: int32(second)},
+		},
+		Vout: []chain.OutputTx{p2pkhOutput(1500, testKey())},
+	}
+	return tx, view
+}
+
+func TestCalcSequenceLock(t *testing.T) {
+	ancestor := ancestorFromSlice(lockTimeHeaders(20))
+	seconds := chain.SequenceLockTimeIsSeconds
+	disabled := chain.SequenceLockTimeDisabled
+
+	tests := []struct {
+		name    string
+		first   uint32
+		second  uint32
+		version int32
+		want    SequenceLock
+	}{
+		{"blocks", 10, 2, chain.TxVersionSequenceLock, SequenceLock{Height: 14, Time: -1}},
+		// The median time past of heights 1 to 11 is 1600
+		{"time", disabled, seconds | 2, chain.TxVersionSequenceLock, SequenceLock{Height: -1, Time: 1600 + 1024 - 1}},
+		{"blocks and time", 3, seconds | 1, chain.TxVersionSequenceLock, SequenceLock{Height: 7, Time: 1600 + 512 - 1}},
+		{"disabled", disabled | 10, disabled, chain.TxVersionSequenceLock, SequenceLock{Height: -1, Time: -1}},
+		{"final inputs", chain.MaxTxInSequenceNum, chain.MaxTxInSequenceNum, chain.TxVersionSequenceLock,
+			SequenceLock{Height: -1, Time: -1}},
+		{"old version", 10, 2, 1, SequenceLock{Height: -1, Time: -1}},
+	}
+	for _, test := range tests {
+		tx, view := sequenceLockTestTx(test.first, test.second)
+		tx.Version = test.version
+		lock, err := CalcSequenceLock(&tx, view, ancestor)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+		if lock != test.want {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, lock)
+		}
+	}
+
+	tx, view := sequenceLockTestTx(10, 2)
+	delete(view, tx.Vin[1].PreviousOutPoint())
+	_, err := CalcSequenceLock(&tx, view, ancestor)
+	expectRuleError(t, err, ErrMissingTxOut)
+}
+
+func TestSequenceLockActive(t *testing.T) {
+	lock := SequenceLock{Height: 14, Time: 2000}
+	if !SequenceLockActive(lock, 14, 2001) {
+		t.Errorf("Expected the lock to hold at its height")
+	}
+	if !SequenceLockActive(lock, 15, 2000) {
+		t.Errorf("Expected the lock to hold at its time")
+	}
+	if SequenceLockActive(lock, 15, 2001) {
+		t.Errorf("Expected the lock to be released")
+	}
+	if SequenceLockActive(SequenceLock{Height: -1, Time: -1}, 0, 0) {
+		t.Errorf("Expected no lock")
+	}
+}
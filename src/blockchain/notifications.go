@@ -0,0 +1,61 @@
+package blockchain
+
+import (
+	"spchain/chain"
+)
+
+// NotificationType What happened to the best chain
+type NotificationType int
+
+const (
+	// NTBlockConnected A block was added to the tip of the best chain
+	NTBlockConnected NotificationType = iota
+
+	// NTBlockDisconnected A block was removed from the tip of the best
+	// chain during a reorganisation
+	NTBlockDisconnected
+)
+
+var notificationTypeStrings = map[NotificationType]string{
+	NTBlockConnected:    "NTBlockConnected",
+	NTBlockDisconnected: "NTBlockDisconnected",
+}
+
+// String The name of the notification type
+func (n NotificationType) String() string {
+	if s, ok := notificationTypeStrings[n]; ok {
+		return s
+	}
+	return "Unknown NotificationType"
+}
+
+// Notification A change to the best chain
+type Notification struct {
+	Type   NotificationType
+	Block  *chain.Block
+	Height int32
+}
+
+// NotificationCallback Receives the changes to the best chain
+type NotificationCallback func(*Notification)
+
+// Subscribe Call callback with every change to the best chain.
+// Callbacks run after ProcessBlock releases the chain lock, in the
+// order the blocks were disconnected and connected, so they may call
+// back into the chain
+func (b *BlockChain) Subscribe(callback NotificationCallback) {
+	b.notificationsMtx.Lock()
+	defer b.notificationsMtx.Unlock()
+	b.notifications = append(b.notifications, callback)
+}
+
+// sendNotifications Pass each notification to every subscriber
+func (b *BlockChain) sendNotifications(notifications []*Notification) {
+	b.notificationsMtx.RLock()
+	defer b.notificationsMtx.RUnlock()
+	for _, n := range notifications {
+		for _, callback := range b.notifications {
+			callback(n)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"fmt"
+	"spchain/chain"
+	"spchain/chaincfg"
+)
+
+// CalcBlockSubsidy The new coins the coinbase of the block at height may
+// create. The subsidy starts at params.BaseSubsidy and halves every
+// params.SubsidyHalvingInterval blocks until it reaches zero
+func CalcBlockSubsidy(height int32, params *chaincfg.Params) int64 {
+	if params.SubsidyHalvingInterval <= 0 {
+		return params.BaseSubsidy
+	}
+
+	halvings := uint(height / params.SubsidyHalvingInterval)
+	// Shifting an int64 right by 63 or more always leaves nothing
+	if halvings >= 63 {
+		return 0
+	}
+	return params.BaseSubsidy >> halvings
+}
+
+// CheckCoinbaseValue Check the coinbase of the block at height pays out
+// no more than the subsidy plus fees, the fees paid by the other
+// transactions of the block
+func CheckCoinbaseValue(coinbase *chain.Tx, height int32, fees int64, params *chaincfg.Params) error {
+	var totalOut int64
+	for _, out := range coinbase.Vout {
+		totalOut += out.Value
+	}
+
+	maxOut := CalcBlockSubsidy(height, params) + fees
+	if totalOut > maxOut {
+		return ruleError(
+			ErrBadCoinbaseValue,
+			fmt.Sprintf("Coinbase pays %d which is more than the subsidy plus fees of %d", totalOut, maxOut),
+		)
+	}
+	return nil
+}
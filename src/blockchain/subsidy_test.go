@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"spchain/chain"
+	"spchain/chaincfg"
+	"testing"
+)
+
+func TestCalcBlockSubsidy(t *testing.T) {
+	params := chaincfg.MainNetParams
+	base := params.BaseSubsidy
+	tests := []struct {
+		height int32
+		want   int64
+	}{
+		{0, base},
+		{209999, base},
+		{210000, base / 2},
+		{420000, base / 4},
+		{210000 * 33, 0},
+		{210000 * 64, 0},
+	}
+	for _, test := range tests {
+		if got := CalcBlockSubsidy(test.height, &params); got != test.want {
+			t.Errorf("Height %d: expected subsidy %d, got %d", test.height, test.want, got)
+		}
+	}
+
+	regtest := chaincfg.RegressionNetParams
+	if got := CalcBlockSubsidy(150, &regtest); got != base/2 {
+		t.Errorf("Expected regtest to halve at 150, got %d", got)
+	}
+}
+
+func TestCheckCoinbaseValue(t *testing.T) {
+	params := chaincfg.MainNetParams
+	subsidy := CalcBlockSubsidy(1, &params)
+
+	exact := chain.NewCoinBaseTx(1, 0, subsidy+10, []byte{0x01})
+	if err := CheckCoinbaseValue(&exact, 1, 10, &params); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	tooMuch := chain.NewCoinBaseTx(1, 0, subsidy+11, []byte{0x01})
+	expectRuleError(t, CheckCoinbaseValue(&tooMuch, 1, 10, &params), ErrBadCoinbaseValue)
+}
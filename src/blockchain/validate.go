@@ -0,0 +1,244 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/mining"
+	"time"
+)
+
+const (
+	// MaxBlockSize The largest serialised block allowed
+	MaxBlockSize = 1000000
+
+	// MaxTimeOffset How far ahead of the local clock a block
+	// timestamp may be
+	MaxTimeOffset = 2 * time.Hour
+
+	// medianTimeBlocks The number of previous blocks used to
+	// calculate the median time past
+	medianTimeBlocks = 11
+)
+
+// BlockContext Where the block being validated sits in the chain
+type BlockContext struct {
+	// Height The height of the block being validated
+	Height int32
+	// Prev The header of the parent block. Nil for the genesis block
+	Prev *chain.BlockHeader
+	// Ancestor Looks up earlier headers on the branch Prev is on
+	Ancestor AncestorFunc
+	// Now The current time. Defaults to time.Now()
+	Now time.Time
+}
+
+// CheckProofOfWork Check the header target is within the network
+// limit and the header hash meets the target
+func CheckProofOfWork(header *chain.BlockHeader, powLimit uint32) error {
+	target := mining.HeaderTarget(header)
+	if target.Sign() <= 0 {
+		return ruleError(
+			ErrDifficultyAboveLimit,
+			fmt.Sprintf("Block target %#08x is not positive", uint32(header.DifficultyTarget)),
+		)
+	}
+
+	if target.Cmp(mining.CompactToBig(powLimit)) > 0 {
+		return ruleError(
+			ErrDifficultyAboveLimit,
+			fmt.Sprintf("Block target %#08x is above the limit %#08x", uint32(header.DifficultyTarget), powLimit),
+		)
+	}
+
+	if !mining.CheckProofOfWork(header) {
+		return ruleError(
+			ErrHighHash,
+			fmt.Sprintf("Block hash %s is above the target %#08x", header.Hash(), uint32(header.DifficultyTarget)),
+		)
+	}
+	return nil
+}
+
+// CheckBlockSanity Checks on a block which don't depend on the
+// rest of the chain
+func CheckBlockSanity(block *chain.Block, params *chaincfg.Params, now time.Time) error {
+	size := block.SerSize()
+	if size > MaxBlockSize {
+		return ruleError(
+			ErrBlockTooBig,
+			fmt.Sprintf("Block size %d is larger than the maximum %d", size, MaxBlockSize),
+		)
+	}
+
+	if block.Size != size {
+		return ruleError(
+			ErrBadBlockSize,
+			fmt.Sprintf("Block Size %d does not match the serialised size %d", block.Size, size),
+		)
+	}
+
+	if block.TxCount != int64(len(block.Transactions)) {
+		return ruleError(
+			ErrBadTxCount,
+			fmt.Sprintf("Block TxCount %d does not match %d transactions", block.TxCount, len(block.Transactions)),
+		)
+	}
+
+	if len(block.Transactions) == 0 {
+		return ruleError(ErrNoTransactions, "Block has no transactions")
+	}
+
+	if !block.Transactions[0].IsCoinBase() {
+		return ruleError(ErrFirstTxNotCoinbase, "The first transaction in the block is not a coinbase")
+	}
+
+	seen := map[chainhash.Hash]bool{}
+	spent := map[chainhash.OutPoint]bool{}
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if i > 0 && tx.IsCoinBase() {
+			return ruleError(
+				ErrMultipleCoinbases,
+				fmt.Sprintf("Transaction %d in the block is a second coinbase", i),
+			)
+		}
+
+		hash := tx.Hash()
+		if seen[hash] {
+			return ruleError(
+				ErrDuplicateTx,
+				fmt.Sprintf("Transaction %s appears more than once", hash),
+			)
+		}
+		seen[hash] = true
+
+		if err := CheckTransactionSanity(tx); err != nil {
+			return err
+		}
+
+		// An output may only be spent once in the whole block
+		if !tx.IsCoinBase() {
+			for j := range tx.Vin {
+				op := tx.Vin[j].PreviousOutPoint()
+				if spent[op] {
+					return ruleError(
+						ErrDoubleSpend,
+						fmt.Sprintf("Transaction %d spends %s which is already spent in the block", i, op),
+					)
+				}
+				spent[op] = true
+			}
+		}
+	}
+
+	merkle := block.CalcMerkle()
+	if merkle.Root != block.Header.MerkleRoot {
+		return ruleError(
+			ErrBadMerkleRoot,
+			fmt.Sprintf("Header MerkleRoot %s does not match the calculated root %s", block.Header.MerkleRoot, merkle.Root),
+		)
+	}
+
+	if err := CheckProofOfWork(&block.Header, params.PowLimitBits); err != nil {
+		return err
+	}
+
+	maxTime := now.Add(MaxTimeOffset).Unix()
+	if block.Header.TimeStamp > maxTime {
+		return ruleError(
+			ErrTimeTooNew,
+			fmt.Sprintf("Block timestamp %d is after the maximum allowed %d", block.Header.TimeStamp, maxTime),
+		)
+	}
+
+	return nil
+}
+
+// CalcPastMedianTime The median timestamp of prev and the blocks before
+// it, up to medianTimeBlocks blocks in total
+func CalcPastMedianTime(prev *chain.BlockHeader, prevHeight int32, ancestor AncestorFunc) (int64, error) {
+	timestamps := []int64{prev.TimeStamp}
+	for height := prevHeight - 1; height >= 0 && len(timestamps) < medianTimeBlocks; height-- {
+		header, err := ancestor(height)
+		if err != nil || header == nil {
+			return 0, ruleError(
+				ErrMissingAncestor,
+				fmt.Sprintf("Unable to find ancestor at height %d for median time: %v", height, err),
+			)
+		}
+		timestamps = append(timestamps, header.TimeStamp)
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2], nil
+}
+
+// ValidateBlock Check a block obeys every consensus rule before it is
+// saved. Returns a *RuleError saying which rule failed
+func ValidateBlock(block *chain.Block, params *chaincfg.Params, ctx BlockContext) error {
+	now := ctx.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if err := CheckBlockSanity(block, params, now); err != nil {
+		return err
+	}
+
+	// The genesis block has nothing before it to check against
+	if ctx.Prev == nil {
+		return CheckHeaderDifficulty(params, &block.Header, nil, -1, ctx.Ancestor)
+	}
+
+	prevHash := ctx.Prev.Hash()
+	if prevHash != block.Header.PrevBlockHash {
+		return ruleError(
+			ErrBadPrevBlock,
+			fmt.Sprintf("PrevBlockHash %s is not the parent hash %s", block.Header.PrevBlockHash, prevHash),
+		)
+	}
+
+	// The height makes the coinbase, and so its outputs, different
+	// in every block
+	coinbase := &block.Transactions[0]
+	if height, ok := chain.CoinBaseHeight(coinbase.Vin[0].ScriptSig); !ok || height != ctx.Height {
+		return ruleError(
+			ErrBadCoinbaseHeight,
+			fmt.Sprintf("Coinbase ScriptSig does not start with the block height %d", ctx.Height),
+		)
+	}
+
+	prevHeight := ctx.Height - 1
+	if err := CheckHeaderDifficulty(params, &block.Header, ctx.Prev, prevHeight, ctx.Ancestor); err != nil {
+		return err
+	}
+
+	medianTime, err := CalcPastMedianTime(ctx.Prev, prevHeight, ctx.Ancestor)
+	if err != nil {
+		return err
+	}
+	if block.Header.TimeStamp <= medianTime {
+		return ruleError(
+			ErrTimeTooOld,
+			fmt.Sprintf("Block timestamp %d is not after the median time past %d", block.Header.TimeStamp, medianTime),
+		)
+	}
+
+	// Lock times are compared to the median time past instead of the
+	// block timestamp, which the miner chooses
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if !tx.IsFinal(ctx.Height, medianTime) {
+			return ruleError(
+				ErrUnfinalizedTx,
+				fmt.Sprintf("Transaction %d has LockTime %d which is not reached at height %d and median time %d",
+					i, uint32(tx.LockTime), ctx.Height, medianTime),
+			)
+		}
+	}
+
+	return nil
+}
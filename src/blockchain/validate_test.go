@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"context"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/mining"
+	"testing"
+	"time"
+)
+
+var testTime = time.Unix(1550000000, 0)
+
+func coinbaseTx(extra byte) chain.Tx {
+	return chain.Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin: []chain.InputTx{{
+			OutInx:    -1,
+			ScriptSig: []byte{extra},
+		}},
+		Vout: []chain.OutputTx{{Value: 5000, ScriptPubKey: []byte{0x01}}},
+	}
+}
+
+func spendTx(value int64) chain.Tx {
+	return chain.Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin:     []chain.InputTx{{Txid: chainhash.Hash{0x01}, OutInx: 0, ScriptSig: []byte{0x02}}},
+		Vout:    []chain.OutputTx{{Value: value, ScriptPubKey: []byte{0x03}}},
+	}
+}
+
+// finaliseBlock Fill in the header and size fields then mine the block
+func finaliseBlock(t *testing.T, block *chain.Block) {
+	block.TxCount = int64(len(block.Transactions))
+	block.Header.MerkleRoot = block.CalcMerkle().Root
+	block.Size = block.SerSize()
+
+	miner := mining.NewMiner(mining.Config{Workers: 2})
+	if err := miner.Solve(context.Background(), &block.Header, nil); err != nil {
+		t.Fatalf("Unable to mine block %s", err)
+	}
+}
+
+// setMerkleRoot Update the header and size after changing transactions
+func setMerkleRoot(block *chain.Block) {
+	block.Header.MerkleRoot = block.CalcMerkle().Root
+	block.Size = block.SerSize()
+}
+
+func testGenesisHeader() chain.BlockHeader {
+	return chain.BlockHeader{
+		Version:          1,
+		TimeStamp:        testTime.Unix() - 600,
+		DifficultyTarget: int32(chaincfg.RegressionNetParams.PowLimitBits),
+	}
+}
+
+// validTestBlock A mined block which extends testGenesisHeader
+func validTestBlock(t *testing.T) chain.Block {
+	genesis := testGenesisHeader()
+	block := chain.Block{
+		Header: chain.BlockHeader{
+			Version:          1,
+			PrevBlockHash:    genesis.Hash(),
+			TimeStamp:        testTime.Unix(),
+			DifficultyTarget: genesis.DifficultyTarget,
+		},
+		Transactions: []chain.Tx{chain.NewCoinBaseTx(1, 0, 5000, []byte{0x01}), spendTx(100)},
+	}
+	finaliseBlock(t, &block)
+	return block
+}
+
+func testBlockContext() BlockContext {
+	genesis := testGenesisHeader()
+	return BlockContext{
+		Height:   1,
+		Prev:     &genesis,
+		Ancestor: ancestorFromSlice([]chain.BlockHeader{genesis}),
+		Now:      testTime,
+	}
+}
+
+func expectRuleError(t *testing.T, err error, code ErrorCode) {
+	t.Helper()
+	ruleErr, ok := err.(*RuleError)
+	if !ok {
+		t.Errorf("Expected %s, got %v", code, err)
+		return
+	}
+	if ruleErr.Code != code {
+		t.Errorf("Expected %s, got %s: %s", code, ruleErr.Code, ruleErr.Msg)
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	block := validTestBlock(t)
+	params := chaincfg.RegressionNetParams
+	if err := ValidateBlock(&block, &params, testBlockContext()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestValidateBlockRules(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+
+	tests := []struct {
+		name   string
+		code   ErrorCode
+		modify func(*chain.Block)
+	}{
+		{"bad merkle root", ErrBadMerkleRoot, func(b *chain.Block) {
+			b.Transactions[1] = spendTx(200)
+			b.Size = b.SerSize()
+		}},
+		{"bad tx count", ErrBadTxCount, func(b *chain.Block) {
+			b.TxCount = 3
+		}},
+		{"bad size", ErrBadBlockSize, func(b *chain.Block) {
+			b.Size = b.Size + 1
+		}},
+		{"no transactions", ErrNoTransactions, func(b *chain.Block) {
+			b.Transactions = nil
+			b.TxCount = 0
+			b.Size = b.SerSize()
+		}},
+		{"first not coinbase", ErrFirstTxNotCoinbase, func(b *chain.Block) {
+			b.Transactions = []chain.Tx{spendTx(100)}
+			b.TxCount = 1
+			b.Size = b.SerSize()
+		}},
+		{"two coinbases", ErrMultipleCoinbases, func(b *chain.Block) {
+			b.Transactions[1] = coinbaseTx(1)
+			b.Size = b.SerSize()
+		}},
+		{"duplicate tx", ErrDuplicateTx, func(b *chain.Block) {
+			b.Transactions = append(b.Transactions, spendTx(100))
+			b.TxCount = 3
+			b.Size = b.SerSize()
+		}},
+		{"double spend", ErrDoubleSpend, func(b *chain.Block) {
+			tx := spendTx(50)
+			tx.Vout[0].ScriptPubKey = []byte{0x04}
+			b.Transactions = append(b.Transactions, tx)
+			b.TxCount = 3
+			b.Size = b.SerSize()
+		}},
+		{"bad transaction", ErrNoTxOutputs, func(b *chain.Block) {
+			b.Transactions[1].Vout = nil
+			b.Transactions[1].TxOutNo = 0
+			b.Size = b.SerSize()
+		}},
+		{"too big", ErrBlockTooBig, func(b *chain.Block) {
+			tx := spendTx(100)
+			tx.Vout[0].ScriptPubKey = make([]byte, 200)
+			for i := 0; i < MaxBlockSize/200; i++ {
+				tx.Vout[0].Value = int64(i)
+				b.Transactions = append(b.Transactions, tx)
+			}
+			b.TxCount = int64(len(b.Transactions))
+		}},
+		{"lock time height not reached", ErrUnfinalizedTx, func(b *chain.Block) {
+			b.Transactions[1].LockTime = 1
+			setMerkleRoot(b)
+		}},
+		{"lock time not reached", ErrUnfinalizedTx, func(b *chain.Block) {
+			// Compared to the median time past, not the block time
+			b.Transactions[1].LockTime = int32(testTime.Unix() - 600)
+			setMerkleRoot(b)
+		}},
+		{"coinbase without height", ErrBadCoinbaseHeight, func(b *chain.Block) {
+			b.Transactions[0] = coinbaseTx(0)
+			setMerkleRoot(b)
+		}},
+		{"coinbase at another height", ErrBadCoinbaseHeight, func(b *chain.Block) {
+			b.Transactions[0] = chain.NewCoinBaseTx(2, 0, 5000, []byte{0x01})
+			setMerkleRoot(b)
+		}},
+		{"time too new", ErrTimeTooNew, func(b *chain.Block) {
+			b.Header.TimeStamp = testTime.Add(3 * time.Hour).Unix()
+		}},
+		{"time too old", ErrTimeTooOld, func(b *chain.Block) {
+			b.Header.TimeStamp = testTime.Unix() - 600
+		}},
+		{"bad prev block", ErrBadPrevBlock, func(b *chain.Block) {
+			b.Header.PrevBlockHash = chainhash.Hash{}
+		}},
+		{"target above limit", ErrDifficultyAboveLimit, func(b *chain.Block) {
+			b.Header.DifficultyTarget = 0x2100ffff
+		}},
+		{"unexpected difficulty", ErrUnexpectedDifficulty, func(b *chain.Block) {
+			b.Header.DifficultyTarget = 0x2000ffff
+		}},
+	}
+
+	for _, test := range tests {
+		block := validTestBlock(t)
+		test.modify(&block)
+
+		// Re-mine so only the rule under test fails, except where the
+		// test breaks the header itself
+		if test.code != ErrDifficultyAboveLimit && test.code != ErrBadMerkleRoot {
+			miner := mining.NewMiner(mining.Config{Workers: 2})
+			miner.Solve(context.Background(), &block.Header, nil)
+		}
+
+		err := ValidateBlock(&block, &params, testBlockContext())
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		expectRuleError(t, err, test.code)
+	}
+}
+
+func TestValidateBlockHighHash(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	block := validTestBlock(t)
+
+	// Bump the nonce until the hash no longer meets the target
+	for mining.CheckProofOfWork(&block.Header) {
+		block.Header.Nonce++
+	}
+
+	expectRuleError(t, ValidateBlock(&block, &params, testBlockContext()), ErrHighHash)
+}
+
+func TestCalcPastMedianTime(t *testing.T) {
+	headers := headerChain(15, 10, 0x207fffff)
+	// Make the timestamps out of order
+	headers[13].TimeStamp = headers[4].TimeStamp
+
+	median, err := CalcPastMedianTime(&headers[14], 14, ancestorFromSlice(headers))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	// Heights 4 to 14 are used, with height 13 moved back to height 4
+	if expected := headers[8].TimeStamp; median != expected {
+		t.Errorf("Expected %d, got %d", expected, median)
+	}
+}
@@ -0,0 +1,237 @@
+package blockchain
+
+import (
+	"fmt"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/script"
+)
+
+// UtxoViewer Looks up the unspent output an input refers to.
+// Returns nil, nil when the output does not exist or is already spent
+type UtxoViewer interface {
+	LookupUtxo(outPoint chainhash.OutPoint) (*chain.Utxo, error)
+}
+
+// CheckTransactionSanity Checks on a transaction which don't need
+// the outputs it spends
+func CheckTransactionSanity(tx *chain.Tx) error {
+	if len(tx.Vin) == 0 {
+		return ruleError(ErrNoTxInputs, "Transaction has no inputs")
+	}
+	if len(tx.Vout) == 0 {
+		return ruleError(ErrNoTxOutputs, "Transaction has no outputs")
+	}
+	if tx.TxInNo != int64(len(tx.Vin)) || tx.TxOutNo != int64(len(tx.Vout)) {
+		return ruleError(
+			ErrBadTxInOutCount,
+			fmt.Sprintf("TxInNo %d and TxOutNo %d do not match %d inputs and %d outputs",
+				tx.TxInNo, tx.TxOutNo, len(tx.Vin), len(tx.Vout)),
+		)
+	}
+	if err := checkScriptLengths(tx); err != nil {
+		return err
+	}
+
+	// Check each output and the running total are within range.
+	// MaxMoney is far below the int64 limit so the sum can't overflow
+	// before it is checked
+	var totalOut int64
+	for i, out := range tx.Vout {
+		if out.Value < 0 {
+			return ruleError(
+				ErrBadTxOutValue,
+				fmt.Sprintf("Output %d has negative value %d", i, out.Value),
+			)
+		}
+		if out.Value > chain.MaxMoney {
+			return ruleError(
+				ErrBadTxOutValue,
+				fmt.Sprintf("Output %d value %d is more than the maximum %d", i, out.Value, int64(chain.MaxMoney)),
+			)
+		}
+		totalOut += out.Value
+		if totalOut > chain.MaxMoney {
+			return ruleError(
+				ErrBadTxOutValue,
+				fmt.Sprintf("Total output value %d is more than the maximum %d", totalOut, int64(chain.MaxMoney)),
+			)
+		}
+	}
+
+	if tx.IsCoinBase() {
+		return nil
+	}
+
+	seen := map[chainhash.OutPoint]bool{}
+	for i := range tx.Vin {
+		in := &tx.Vin[i]
+		if in.OutInx == -1 && in.Txid.IsZero() {
+			return ruleError(
+				ErrBadTxInput,
+				fmt.Sprintf("Input %d spends the null outpoint", i),
+			)
+		}
+
+		op := in.PreviousOutPoint()
+		if seen[op] {
+			return ruleError(
+				ErrDoubleSpend,
+				fmt.Sprintf("Input %d spends %s which is already spent by the transaction", i, op),
+			)
+		}
+		seen[op] = true
+	}
+
+	return nil
+}
+
+// checkScriptLengths Check the scripts of a transaction which writes
+// script lengths as a single byte fit in it
+func checkScriptLengths(tx *chain.Tx) error {
+	if tx.Version >= chain.TxVersionCompactSize {
+		return nil
+	}
+	for i := range tx.Vin {
+		if n := tx.Vin[i].ScriptSigLen(); n > chain.MaxOneByteScriptLen {
+			return ruleError(
+				ErrScriptTooLong,
+				fmt.Sprintf("Input %d ScriptSig of %d bytes is too long for version %d", i, n, tx.Version),
+			)
+		}
+	}
+	for i := range tx.Vout {
+		if n := tx.Vout[i].ScriptPubLen(); n > chain.MaxOneByteScriptLen {
+			return ruleError(
+				ErrScriptTooLong,
+				fmt.Sprintf("Output %d ScriptPubKey of %d bytes is too long for version %d", i, n, tx.Version),
+			)
+		}
+	}
+	return nil
+}
+
+// ValidateTx Check a transaction in a block at spendHeight can spend
+// the outputs it refers to. Each input is resolved through view, a
+// coinbase output must be params.CoinbaseMaturity blocks deep, the
+// ScriptSig is run followed by the ScriptPubKey of the spent output,
+// and the inputs must be worth at least as much as the outputs.
+// Returns the fee paid by the transaction
+func ValidateTx(tx *chain.Tx, view UtxoViewer, spendHeight int32, params *chaincfg.Params) (int64, error) {
+	if err := CheckTransactionSanity(tx); err != nil {
+		return 0, err
+	}
+
+	if tx.IsCoinBase() {
+		return 0, ruleError(
+			ErrUnexpectedCoinbase,
+			"Coinbase transactions can only be validated as part of their block",
+		)
+	}
+
+	var totalIn int64
+	for i := range tx.Vin {
+		in := &tx.Vin[i]
+		utxo, err := view.LookupUtxo(in.PreviousOutPoint())
+		if err != nil {
+			return 0, err
+		}
+		if utxo == nil {
+			return 0, ruleError(
+				ErrMissingTxOut,
+				fmt.Sprintf("Input %d spends %s which does not exist or is already spent", i, in.PreviousOutPoint()),
+			)
+		}
+
+		if err := checkCoinbaseMaturity(i, in.PreviousOutPoint(), utxo, spendHeight, params); err != nil {
+			return 0, err
+		}
+
+		prevOut := utxo.Output()
+		if prevOut.Value < 0 || prevOut.Value > chain.MaxMoney {
+			return 0, ruleError(
+				ErrBadTxOutValue,
+				fmt.Sprintf("Input %d spends an output with invalid value %d", i, prevOut.Value),
+			)
+		}
+		totalIn += prevOut.Value
+		if totalIn > chain.MaxMoney {
+			return 0, ruleError(
+				ErrBadTxOutValue,
+				fmt.Sprintf("Total input value %d is more than the maximum %d", totalIn, int64(chain.MaxMoney)),
+			)
+		}
+
+		if err := runScripts(&chain.SigContext{Tx: tx, InputIndex: i, PrevOut: &prevOut}, in.ScriptSig, prevOut.ScriptPubKey); err != nil {
+			return 0, ruleError(
+				ErrScriptValidation,
+				fmt.Sprintf("Input %d failed script validation: %s", i, err.Error()),
+			)
+		}
+	}
+
+	var totalOut int64
+	for _, out := range tx.Vout {
+		totalOut += out.Value
+	}
+
+	if totalIn < totalOut {
+		return 0, ruleError(
+			ErrSpendTooHigh,
+			fmt.Sprintf("Outputs worth %d are more than the inputs worth %d", totalOut, totalIn),
+		)
+	}
+
+	return totalIn - totalOut, nil
+}
+
+// checkCoinbaseMaturity Error if utxo, spent by input i of a transaction
+// in a block at spendHeight, is a coinbase output which is not yet
+// params.CoinbaseMaturity blocks deep
+func checkCoinbaseMaturity(i int, outPoint chainhash.OutPoint, utxo *chain.Utxo, spendHeight int32, params *chaincfg.Params) error {
+	if !utxo.IsCoinBase {
+		return nil
+	}
+	if depth := spendHeight - utxo.Height; depth < params.CoinbaseMaturity {
+		return ruleError(
+			ErrImmatureSpend,
+			fmt.Sprintf("Input %d spends coinbase output %s from height %d which can't be spent until height %d",
+				i, outPoint, utxo.Height, utxo.Height+params.CoinbaseMaturity),
+		)
+	}
+	return nil
+}
+
+// CheckCoinbaseMaturity Check every coinbase output tx spends, looked
+// up in view, is params.CoinbaseMaturity blocks deep at spendHeight.
+// Inputs whose outputs are not in view are skipped
+func CheckCoinbaseMaturity(tx *chain.Tx, view UtxoViewer, spendHeight int32, params *chaincfg.Params) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+	for i := range tx.Vin {
+		outPoint := tx.Vin[i].PreviousOutPoint()
+		utxo, err := view.LookupUtxo(outPoint)
+		if err != nil {
+			return err
+		}
+		if utxo == nil {
+			continue
+		}
+		if err := checkCoinbaseMaturity(i, outPoint, utxo, spendHeight, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runScripts Run the unlocking script followed by the locking script
+// of the input in ctx
+func runScripts(ctx *chain.SigContext, scriptSig []byte, scriptPubKey []byte) error {
+	engine, err := script.NewEngine(ctx, scriptSig, scriptPubKey)
+	if err != nil {
+		return err
+	}
+	return engine.Execute()
+}
@@ -0,0 +1,256 @@
+package blockchain
+
+import (
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/key"
+	"spchain/script"
+	"testing"
+)
+
+// mapUtxoView An in memory UtxoViewer for tests
+type mapUtxoView map[chainhash.OutPoint]chain.Utxo
+
+func (m mapUtxoView) LookupUtxo(outPoint chainhash.OutPoint) (*chain.Utxo, error) {
+	utxo, ok := m[outPoint]
+	if !ok {
+		return nil, nil
+	}
+	return &utxo, nil
+}
+
+func (m mapUtxoView) add(txid chainhash.Hash, outInx int32, out chain.OutputTx) {
+	m.addAt(txid, outInx, out, 0)
+}
+
+// addAt Add out as created by a block at height
+func (m mapUtxoView) addAt(txid chainhash.Hash, outInx int32, out chain.OutputTx, height int32) {
+	m[chainhash.OutPoint{Hash: txid, Index: outInx}] = chain.Utxo{
+		Value:        out.Value,
+		ScriptPubKey: out.ScriptPubKey,
+		Height:       height,
+	}
+}
+
+// testSpendHeight The height of the block the test transactions are in
+const testSpendHeight = 100
+
+// markCoinbase Make the output at outPoint a coinbase output created by
+// the block at height
+func (m mapUtxoView) markCoinbase(outPoint chainhash.OutPoint, height int32) {
+	utxo := m[outPoint]
+	utxo.IsCoinBase = true
+	utxo.Height = height
+	m[outPoint] = utxo
+}
+
+func testKey() key.Key {
+	return key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725")
+}
+
+// p2pkhOutput An output locked to the public key hash of k
+func p2pkhOutput(value int64, k key.Key) chain.OutputTx {
+	lock := script.Stack{
+		Contents: []script.Operand{
+			script.OP_DUP{},
+			script.OP_HASH_160{},
+			script.PUB_KEY_V1{Key: k.PublicKeyHash},
+			script.OP_EQUALVERIFY{},
+			script.OP_CHECKSIG{},
+		},
+	}
+	return chain.OutputTx{Value: value, ScriptPubKey: lock.Ser().Bytes()}
+}
+
+// signTx Set the ScriptSig of every input to a SIGHASH_ALL signature by k.
+// The spent outputs are looked up in view
+func signTx(tx *chain.Tx, k key.Key, view UtxoViewer) {
+	signTxWithType(tx, k, view, chain.SigHashAll)
+}
+
+// signTxWithType Set the ScriptSig of every input to a signature of
+// hashType by k
+func signTxWithType(tx *chain.Tx, k key.Key, view UtxoViewer, hashType chain.SigHashType) {
+	for i := range tx.Vin {
+		prevOut := chain.OutputTx{}
+		if utxo, _ := view.LookupUtxo(tx.Vin[i].PreviousOutPoint()); utxo != nil {
+			prevOut = utxo.Output()
+		}
+		sig, _ := tx.SignInputWithType(i, k.PrivateKey, &prevOut, hashType)
+		unlock := script.Stack{
+			Contents: []script.Operand{
+				script.SIG{Sig: sig},
+				script.PUB_KEY_V1{Key: k.PublicKey.SerializeCompressed()},
+			},
+		}
+		tx.Vin[i].ScriptSig = unlock.Ser().Bytes()
+	}
+}
+
+func fundingTxid(b byte) chainhash.Hash {
+	return chainhash.Hash{b}
+}
+
+// spendingTestTx A signed transaction spending two outputs worth 3000
+// to a single output worth value
+func spendingTestTx(value int64) (chain.Tx, mapUtxoView) {
+	k := testKey()
+	view := mapUtxoView{}
+	view.add(fundingTxid(1), 0, p2pkhOutput(1000, k))
+	view.add(fundingTxid(2), 3, p2pkhOutput(2000, k))
+
+	tx := chain.Tx{
+		Version: 1,
+		TxInNo:  2,
+		TxOutNo: 1,
+		Vin: []chain.InputTx{
+			{Txid: fundingTxid(1), OutInx: 0},
+			{Txid: fundingTxid(2), OutInx: 3},
+		},
+		Vout: []chain.OutputTx{p2pkhOutput(value, k)},
+	}
+	signTx(&tx, k, view)
+	return tx, view
+}
+
+func TestValidateTx(t *testing.T) {
+	tx, view := spendingTestTx(2500)
+
+	fee, err := ValidateTx(&tx, view, testSpendHeight, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if fee != 500 {
+		t.Errorf("Expected fee %d, got %d", 500, fee)
+	}
+}
+
+func TestValidateTxCoinbaseMaturity(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	tx, view := spendingTestTx(2500)
+	outPoint := tx.Vin[1].PreviousOutPoint()
+
+	view.markCoinbase(outPoint, testSpendHeight-params.CoinbaseMaturity+1)
+	_, err := ValidateTx(&tx, view, testSpendHeight, params)
+	expectRuleError(t, err, ErrImmatureSpend)
+	expectRuleError(t, CheckCoinbaseMaturity(&tx, view, testSpendHeight, params), ErrImmatureSpend)
+
+	view.markCoinbase(outPoint, testSpendHeight-params.CoinbaseMaturity)
+	if _, err := ValidateTx(&tx, view, testSpendHeight, params); err != nil {
+		t.Errorf("Unexpected error spending a mature coinbase %s", err)
+	}
+	if err := CheckCoinbaseMaturity(&tx, view, testSpendHeight, params); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestValidateTxSigHashTypes(t *testing.T) {
+	types := []chain.SigHashType{chain.SigHashAll, chain.SigHashNone, chain.SigHashSingle}
+	for _, base := range types {
+		for _, hashType := range []chain.SigHashType{base, base | chain.SigHashAnyOneCanPay} {
+			tx, view := spendingTestTx(1000)
+			// SIGHASH_SINGLE needs an output for each input
+			tx.Vout = append(tx.Vout, p2pkhOutput(1000, testKey()))
+			tx.TxOutNo = 2
+			signTxWithType(&tx, testKey(), view, hashType)
+
+			if _, err := ValidateTx(&tx, view, testSpendHeight, &chaincfg.RegressionNetParams); err != nil {
+				t.Errorf("Sighash type 0x%02x: unexpected error %s", byte(hashType), err)
+			}
+		}
+	}
+
+	// Without a matching output SIGHASH_SINGLE can't be signed or verified
+	tx, view := spendingTestTx(1000)
+	signTxWithType(&tx, testKey(), view, chain.SigHashSingle)
+	_, err := ValidateTx(&tx, view, testSpendHeight, &chaincfg.RegressionNetParams)
+	expectRuleError(t, err, ErrScriptValidation)
+}
+
+func TestValidateTxRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   ErrorCode
+		modify func(*chain.Tx, mapUtxoView)
+	}{
+		{"missing input", ErrMissingTxOut, func(tx *chain.Tx, view mapUtxoView) {
+			delete(view, tx.Vin[1].PreviousOutPoint())
+		}},
+		{"spend too high", ErrSpendTooHigh, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vout[0].Value = 3001
+			signTx(tx, testKey(), view)
+		}},
+		{"negative output", ErrBadTxOutValue, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vout[0].Value = -1
+		}},
+		{"output above max money", ErrBadTxOutValue, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vout[0].Value = chain.MaxMoney + 1
+		}},
+		{"outputs overflow", ErrBadTxOutValue, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vout = []chain.OutputTx{
+				{Value: chain.MaxMoney, ScriptPubKey: tx.Vout[0].ScriptPubKey},
+				{Value: chain.MaxMoney, ScriptPubKey: tx.Vout[0].ScriptPubKey},
+			}
+			tx.TxOutNo = 2
+		}},
+		{"inputs overflow", ErrBadTxOutValue, func(tx *chain.Tx, view mapUtxoView) {
+			view.add(fundingTxid(1), 0, p2pkhOutput(chain.MaxMoney, testKey()))
+			view.add(fundingTxid(2), 3, p2pkhOutput(chain.MaxMoney, testKey()))
+			signTx(tx, testKey(), view)
+		}},
+		{"duplicate input", ErrDoubleSpend, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vin[1] = tx.Vin[0]
+		}},
+		{"null outpoint", ErrBadTxInput, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vin[1].Txid = chainhash.Hash{}
+			tx.Vin[1].OutInx = -1
+		}},
+		{"no inputs", ErrNoTxInputs, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vin = nil
+			tx.TxInNo = 0
+		}},
+		{"bad input count", ErrBadTxInOutCount, func(tx *chain.Tx, view mapUtxoView) {
+			tx.TxInNo = 3
+		}},
+		{"signed by another key", ErrScriptValidation, func(tx *chain.Tx, view mapUtxoView) {
+			signTx(tx, key.NewKey(), view)
+		}},
+		{"tampered after signing", ErrScriptValidation, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vout[0].Value = 2000
+		}},
+		{"signature replayed on another input", ErrScriptValidation, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vin[1].ScriptSig = tx.Vin[0].ScriptSig
+		}},
+		{"signed for another amount", ErrScriptValidation, func(tx *chain.Tx, view mapUtxoView) {
+			view.add(fundingTxid(2), 3, p2pkhOutput(2500, testKey()))
+		}},
+		{"garbage script sig", ErrScriptValidation, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vin[0].ScriptSig = []byte{0x76, 0x00}
+		}},
+		{"long version 1 script", ErrScriptTooLong, func(tx *chain.Tx, view mapUtxoView) {
+			tx.Vout[0].ScriptPubKey = make([]byte, chain.MaxOneByteScriptLen+1)
+		}},
+		{"coinbase", ErrUnexpectedCoinbase, func(tx *chain.Tx, view mapUtxoView) {
+			*tx = coinbaseTx(0)
+		}},
+		{"immature coinbase", ErrImmatureSpend, func(tx *chain.Tx, view mapUtxoView) {
+			view.markCoinbase(tx.Vin[0].PreviousOutPoint(), testSpendHeight-1)
+		}},
+	}
+
+	for _, test := range tests {
+		tx, view := spendingTestTx(2500)
+		test.modify(&tx, view)
+
+		_, err := ValidateTx(&tx, view, testSpendHeight, &chaincfg.RegressionNetParams)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		ruleErr, ok := err.(*RuleError)
+		if !ok || ruleErr.Code != test.code {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package blocktemplate
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"spchain/blockchain"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/mempool"
+	"time"
+)
+
+/*
+  A block template is the next block for the best chain filled with
+  transactions from the pool, ready for the miner to solve.
+
+  Transactions are picked by the fee rate of their ancestor package: the
+  transaction together with the ancestors in the pool not yet in the
+  block, since a child can only be mined with its parents. The package
+  with the highest fee rate is added next, parents first, until no
+  package fits in the block. Including a package lowers the package of
+  each of its descendants, so their fee rates are updated as it goes and
+  they are pushed again on the heap of packages.
+*/
+
+const (
+	// coinbaseReserve Room kept for the TxCount to grow as transactions
+	// are added. A CompactSize is at most 9 bytes
+	coinbaseReserve = 9
+)
+
+// BlockTemplate A block to mine on top of the best chain. The header
+// Nonce is left for the miner
+type BlockTemplate struct {
+	Block *chain.Block
+	// Height The height the block will have
+	Height int32
+	// Fees The fee paid by each transaction in the block. The coinbase
+	// is 0
+	Fees []int64
+	// TotalFees The fees the coinbase collects
+	TotalFees int64
+
+	subsidy      int64
+	payoutScript []byte
+}
+
+// UpdateExtraNonce Rebuild the coinbase with extraNonce and update the
+// header MerkleRoot. The block size does not change.
+// Returns the new MerkleRoot, so it can be given to the miner as a
+// mining.ExtraNonceFunc
+func (bt *BlockTemplate) UpdateExtraNonce(extraNonce uint64) chainhash.Hash {
+	bt.Block.Transactions[0] = chain.NewCoinBaseTx(bt.Height, extraNonce, bt.subsidy+bt.TotalFees, bt.payoutScript)
+	bt.Block.Header.MerkleRoot = bt.Block.CalcMerkle().Root
+	return bt.Block.Header.MerkleRoot
+}
+
+// txPrioItem A pool transaction with its ancestor package
+type txPrioItem struct {
+	desc     *mempool.MiningDesc
+	parents  []*txPrioItem
+	children []*txPrioItem
+	// ancestors Every in-pool ancestor of the transaction
+	ancestors map[chainhash.Hash]*txPrioItem
+
+	// packageFee and packageSize The fee and size of the transaction
+	// and the ancestors not yet in the block
+	packageFee  int64
+	packageSize int64
+
+	included bool
+	skipped  bool
+}
+
+// collectAncestors Add every ancestor of item to ancestors
+func collectAncestors(item *txPrioItem, ancestors map[chainhash.Hash]*txPrioItem) {
+	for _, parent := range item.parents {
+		if _, ok := ancestors[parent.desc.Hash]; ok {
+			continue
+		}
+		ancestors[parent.desc.Hash] = parent
+		collectAncestors(parent, ancestors)
+	}
+}
+
+// collectDescendants Add every descendant of item to descendants
+func collectDescendants(item *txPrioItem, descendants map[chainhash.Hash]*txPrioItem) {
+	for _, child := range item.children {
+		if _, ok := descendants[child.desc.Hash]; ok {
+			continue
+		}
+		descendants[child.desc.Hash] = child
+		collectDescendants(child, descendants)
+	}
+}
+
+// newPrioItems The package of each transaction in descs
+func newPrioItems(descs []*mempool.MiningDesc) []*txPrioItem {
+	items := make(map[chainhash.Hash]*txPrioItem, len(descs))
+	ret := make([]*txPrioItem, 0, len(descs))
+	for _, desc := range descs {
+		item := &txPrioItem{desc: desc}
+		items[desc.Hash] = item
+		ret = append(ret, item)
+	}
+	for _, item := range ret {
+		for _, hash := range item.desc.Parents {
+			if parent, ok := items[hash]; ok {
+				item.parents = append(item.parents, parent)
+				parent.children = append(parent.children, item)
+			}
+		}
+	}
+	for _, item := range ret {
+		item.ancestors = map[chainhash.Hash]*txPrioItem{}
+		collectAncestors(item, item.ancestors)
+		item.packageFee = item.desc.Fee
+		item.packageSize = item.desc.Size
+		for _, ancestor := range item.ancestors {
+			item.packageFee += ancestor.desc.Fee
+			item.packageSize += ancestor.desc.Size
+		}
+	}
+	return ret
+}
+
+// prioEntry The package of item when it was pushed
+type prioEntry struct {
+	item *txPrioItem
+	fee  int64
+	size int64
+}
+
+// prioHeap A heap of packages, highest fee rate first. Ties go to the
+// smaller package, then the lower hash so the selection does not depend
+// on the order of the pool. A package which changes is pushed again, so
+// entries which no longer match their item are stale
+type prioHeap []prioEntry
+
+func (h prioHeap) Len() int { return len(h) }
+
+func (h prioHeap) Less(i, j int) bool {
+	ri := feeRate(h[i].fee, h[i].size)
+	rj := feeRate(h[j].fee, h[j].size)
+	switch {
+	case ri != rj:
+		return ri > rj
+	case h[i].size != h[j].size:
+		return h[i].size < h[j].size
+	default:
+		return lessHash(h[i].item.desc.Hash, h[j].item.desc.Hash)
+	}
+}
+
+func (h prioHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *prioHeap) Push(x interface{}) { *h = append(*h, x.(prioEntry)) }
+
+func (h *prioHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// push Add the current package of item
+func (h *prioHeap) push(item *txPrioItem) {
+	heap.Push(h, prioEntry{item, item.packageFee, item.packageSize})
+}
+
+// nextPackage The package with the highest fee rate still to consider,
+// skipping stale entries. nil when there are none left
+func (h *prioHeap) nextPackage() *txPrioItem {
+	for h.Len() > 0 {
+		entry := heap.Pop(h).(prioEntry)
+		item := entry.item
+		if item.included || item.skipped {
+			continue
+		}
+		if entry.fee == item.packageFee && entry.size == item.packageSize {
+			return item
+		}
+	}
+	return nil
+}
+
+// feeRate The fee per 1000 bytes of size
+func feeRate(fee int64, size int64) int64 {
+	if size == 0 {
+		return 0
+	}
+	return fee * 1000 / size
+}
+
+func lessHash(a chainhash.Hash, b chainhash.Hash) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// packageTxs The transactions of the package of item not yet in the
+// block, parents before children
+func packageTxs(item *txPrioItem) []*txPrioItem {
+	ret := []*txPrioItem{}
+	for _, ancestor := range item.ancestors {
+		if !ancestor.included {
+			ret = append(ret, ancestor)
+		}
+	}
+	// An ancestor has fewer ancestors than any of its descendants
+	sort.Slice(ret, func(i, j int) bool {
+		if len(ret[i].ancestors) != len(ret[j].ancestors) {
+			return len(ret[i].ancestors) < len(ret[j].ancestors)
+		}
+		return lessHash(ret[i].desc.Hash, ret[j].desc.Hash)
+	})
+	return append(ret, item)
+}
+
+// include Mark item as in the block and take it out of the packages
+// of its descendants, pushing their new packages on packages
+func include(item *txPrioItem, packages *prioHeap) {
+	item.included = true
+	descendants := map[chainhash.Hash]*txPrioItem{}
+	collectDescendants(item, descendants)
+	for _, descendant := range descendants {
+		descendant.packageFee -= item.desc.Fee
+		descendant.packageSize -= item.desc.Size
+		if !descendant.included && !descendant.skipped {
+			packages.push(descendant)
+		}
+	}
+}
+
+// selectTxs Pick transactions from descs by package fee rate until
+// no package fits in space bytes. Returns them in block order
+func selectTxs(descs []*mempool.MiningDesc, space int64) []*mempool.MiningDesc {
+	ret := []*mempool.MiningDesc{}
+	items := newPrioItems(descs)
+	if len(items) == 0 {
+		return ret
+	}
+
+	packages := make(prioHeap, 0, len(items))
+	smallest := items[0].desc.Size
+	for _, item := range items {
+		packages = append(packages, prioEntry{item, item.packageFee, item.packageSize})
+		if item.desc.Size < smallest {
+			smallest = item.desc.Size
+		}
+	}
+	heap.Init(&packages)
+
+	// Once the smallest transaction doesn't fit, nothing else will
+	for space >= smallest {
+		item := packages.nextPackage()
+		if item == nil {
+			break
+		}
+		if item.packageSize > space {
+			item.skipped = true
+			continue
+		}
+		for _, tx := range packageTxs(item) {
+			ret = append(ret, tx.desc)
+			space -= tx.desc.Size
+			include(tx, &packages)
+		}
+	}
+	return ret
+}
+
+// NewBlockTemplate A block extending the best chain of the pool, paying
+// the subsidy and the fees of the transactions picked from the pool to
+// payoutScript
+func NewBlockTemplate(pool *mempool.TxPool, params *chaincfg.Params, payoutScript []byte) (*BlockTemplate, error) {
+	best := pool.Chain()
+	prevHash := best.BestHash()
+	height := best.BestHeight() + 1
+
+	bits, err := best.NextRequiredDifficulty(prevHash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the difficulty of block %d: %v", height, err)
+	}
+	medianTime, err := best.MedianTimePast()
+	if err != nil {
+		return nil, err
+	}
+
+	// The timestamp must be after the median time past of the parent
+	timeStamp := time.Now().Unix()
+	if timeStamp <= medianTime {
+		timeStamp = medianTime + 1
+	}
+
+	subsidy := blockchain.CalcBlockSubsidy(height, params)
+	block := &chain.Block{
+		Header: chain.BlockHeader{
+			Version:          chain.BlockVersionCompactSize,
+			PrevBlockHash:    prevHash,
+			TimeStamp:        timeStamp,
+			DifficultyTarget: int32(bits),
+		},
+		Transactions: []chain.Tx{chain.NewCoinBaseTx(height, 0, subsidy, payoutScript)},
+		TxCount:      1,
+	}
+	blockSize := int64(block.SerSize()) + coinbaseReserve
+
+	fees := []int64{0}
+	var totalFees int64
+	for _, desc := range selectTxs(pool.MiningDescs(), blockchain.MaxBlockSize-blockSize) {
+		block.Transactions = append(block.Transactions, desc.Tx)
+		fees = append(fees, desc.Fee)
+		totalFees += desc.Fee
+	}
+
+	template := &BlockTemplate{
+		Block:        block,
+		Height:       height,
+		Fees:         fees,
+		TotalFees:    totalFees,
+		subsidy:      subsidy,
+		payoutScript: append([]byte{}, payoutScript...),
+	}
+	block.TxCount = int64(len(block.Transactions))
+	template.UpdateExtraNonce(0)
+	block.Size = block.SerSize()
+	return template, nil
+}
@@ -0,0 +1,295 @@
+package blocktemplate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"spchain/blockchain"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/key"
+	"spchain/leveldb"
+	"spchain/mempool"
+	"spchain/mining"
+	"spchain/script"
+	"testing"
+	"time"
+)
+
+// testDesc A pool transaction for selection tests. Hashes only need to
+// be unique
+func testDesc(id byte, fee int64, size int64, parents ...*mempool.MiningDesc) *mempool.MiningDesc {
+	desc := &mempool.MiningDesc{TxDesc: &mempool.TxDesc{Fee: fee, Size: size}}
+	desc.Hash[0] = id
+	for _, parent := range parents {
+		desc.Parents = append(desc.Parents, parent.Hash)
+	}
+	return desc
+}
+
+func selectedIds(descs []*mempool.MiningDesc) []byte {
+	ret := []byte{}
+	for _, desc := range descs {
+		ret = append(ret, desc.Hash[0])
+	}
+	return ret
+}
+
+func expectIds(t *testing.T, got []byte, expected ...byte) {
+	t.Helper()
+	if string(got) != string(expected) {
+		t.Errorf("Expected transactions %v, got %v", expected, got)
+	}
+}
+
+func TestSelectTxsByPackageFeeRate(t *testing.T) {
+	// The parent alone pays less than the independent transaction,
+	// but with its child the package pays more
+	parent := testDesc(1, 100, 200)
+	child := testDesc(2, 5000, 200, parent)
+	other := testDesc(3, 2000, 200)
+
+	selected := selectTxs([]*mempool.MiningDesc{child, other, parent}, 1000)
+	expectIds(t, selectedIds(selected), 1, 2, 3)
+}
+
+func TestSelectTxsUpdatesPackages(t *testing.T) {
+	// Once the parent is in the block through its first child, the
+	// second child is worth more than the independent transaction
+	parent := testDesc(1, 100, 200)
+	child := testDesc(2, 9000, 200, parent)
+	sibling := testDesc(3, 3000, 200, parent)
+	other := testDesc(4, 2000, 200)
+
+	selected := selectTxs([]*mempool.MiningDesc{other, sibling, child, parent}, 1000)
+	expectIds(t, selectedIds(selected), 1, 2, 3, 4)
+}
+
+func TestSelectTxsParentsFirst(t *testing.T) {
+	grandparent := testDesc(1, 10, 100)
+	parent := testDesc(2, 10, 100, grandparent)
+	child := testDesc(3, 10000, 100, parent, grandparent)
+
+	selected := selectTxs([]*mempool.MiningDesc{child, parent, grandparent}, 1000)
+	expectIds(t, selectedIds(selected), 1, 2, 3)
+}
+
+func TestSelectTxsSize(t *testing.T) {
+	// The best package does not fit, so the smaller ones are taken.
+	// After the small transaction the package of the child no longer
+	// fits but the parent alone does
+	big := testDesc(1, 10000, 600)
+	small := testDesc(2, 1000, 300)
+	parent := testDesc(3, 100, 200)
+	child := testDesc(4, 1000, 200, parent)
+
+	selected := selectTxs([]*mempool.MiningDesc{big, small, parent, child}, 500)
+	expectIds(t, selectedIds(selected), 2, 3)
+
+	selected = selectTxs([]*mempool.MiningDesc{big, small, parent, child}, 700)
+	expectIds(t, selectedIds(selected), 1)
+}
+
+func TestSelectTxsChain(t *testing.T) {
+	// Every inclusion pushes the packages of the rest of the chain
+	// again, each transaction must still be selected once in order
+	descs := []*mempool.MiningDesc{testDesc(0, 100, 100)}
+	expected := []byte{0}
+	for id := byte(1); id < 50; id++ {
+		descs = append(descs, testDesc(id, int64(id)*100, 100, descs[len(descs)-1]))
+		expected = append(expected, id)
+	}
+
+	selected := selectTxs(descs, 100000)
+	expectIds(t, selectedIds(selected), expected...)
+
+	selected = selectTxs(descs, 1050)
+	expectIds(t, selectedIds(selected), expected[:10]...)
+}
+
+// templateTestHarness A chain and pool on a temporary database
+type templateTestHarness struct {
+	t      *testing.T
+	params chaincfg.Params
+	dir    string
+	ldb    leveldb.LevelDb
+	chain  *blockchain.BlockChain
+	pool   *mempool.TxPool
+	key    key.Key
+	funds  *chain.Tx
+}
+
+func p2pkhScript(k key.Key) []byte {
+	lock := script.Stack{
+		Contents: []script.Operand{
+			script.OP_DUP{},
+			script.OP_HASH_160{},
+			script.PUB_KEY_V1{Key: k.PublicKeyHash},
+			script.OP_EQUALVERIFY{},
+			script.OP_CHECKSIG{},
+		},
+	}
+	return lock.Ser().Bytes()
+}
+
+func newTemplateTestHarness(t *testing.T) *templateTestHarness {
+	dir, err := ioutil.TempDir("", "spchain-blocktemplate")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	ldb, err := leveldb.InitDatabaseAtPath(dir)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	h := &templateTestHarness{
+		t:      t,
+		params: chaincfg.RegressionNetParams,
+		dir:    dir,
+		ldb:    ldb,
+		key:    key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"),
+	}
+
+	// A genesis block with three outputs paying the harness key
+	coinbase := chain.NewCoinBaseTx(0, 0, 10000, p2pkhScript(h.key))
+	for i := 0; i < 2; i++ {
+		coinbase.Vout = append(coinbase.Vout, coinbase.Vout[0])
+	}
+	coinbase.TxOutNo = int64(len(coinbase.Vout))
+	genesis := chain.Block{
+		Header: chain.BlockHeader{
+			Version:          1,
+			TimeStamp:        time.Now().Add(-time.Hour).Unix(),
+			DifficultyTarget: int32(h.params.PowLimitBits),
+		},
+		TxCount:      1,
+		Transactions: []chain.Tx{coinbase},
+	}
+	genesis.Header.MerkleRoot = genesis.CalcMerkle().Root
+	genesis.Size = genesis.SerSize()
+	miner := mining.NewMiner(mining.Config{Workers: 2})
+	if err := miner.Solve(context.Background(), &genesis.Header, nil); err != nil {
+		t.Fatalf("Unable to mine genesis %s", err)
+	}
+	h.params.GenesisBlock = &genesis
+	h.params.GenesisHash = genesis.Hash()
+	// The pool spends the genesis coinbase in the next block
+	h.params.CoinbaseMaturity = 1
+	h.funds = &genesis.Transactions[0]
+
+	h.chain, err = blockchain.New(&h.params, &h.ldb)
+	if err != nil {
+		t.Fatalf("Unable to create chain %s", err)
+	}
+	h.pool = mempool.New(&mempool.Config{Chain: h.chain})
+	h.chain.Subscribe(h.pool.ChainNotification)
+	return h
+}
+
+func (h *templateTestHarness) close() {
+	h.ldb.Db.Close()
+	os.RemoveAll(h.dir)
+}
+
+// spend Add a transaction spending output index of prev to the pool
+func (h *templateTestHarness) spend(prev *chain.Tx, index int32, value int64) chain.Tx {
+	tx := chain.Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin:     []chain.InputTx{{Txid: prev.Hash(), OutInx: index, Sequence: -1}},
+		Vout:    []chain.OutputTx{{Value: value, ScriptPubKey: p2pkhScript(h.key)}},
+	}
+	sig, err := tx.SignInput(0, h.key.PrivateKey, &prev.Vout[index])
+	if err != nil {
+		h.t.Fatalf("Unable to sign %s", err)
+	}
+	unlock := script.Stack{
+		Contents: []script.Operand{
+			script.SIG{Sig: sig},
+			script.PUB_KEY_V1{Key: h.key.PublicKey.SerializeCompressed()},
+		},
+	}
+	tx.Vin[0].ScriptSig = unlock.Ser().Bytes()
+	if _, err := h.pool.ProcessTransaction(&tx); err != nil {
+		h.t.Fatalf("Unexpected error adding to the pool %s", err)
+	}
+	return tx
+}
+
+func TestNewBlockTemplate(t *testing.T) {
+	h := newTemplateTestHarness(t)
+	defer h.close()
+
+	parent := h.spend(h.funds, 0, 9900)
+	child := h.spend(&parent, 0, 4900)
+	other := h.spend(h.funds, 1, 8000)
+
+	payout := p2pkhScript(h.key)
+	template, err := NewBlockTemplate(h.pool, &h.params, payout)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	block := template.Block
+	if template.Height != 1 {
+		t.Errorf("Expected height 1, got %d", template.Height)
+	}
+	expected := []chainhash.Hash{parent.Hash(), child.Hash(), other.Hash()}
+	if len(block.Transactions) != len(expected)+1 {
+		t.Fatalf("Expected %d transactions, got %d", len(expected)+1, len(block.Transactions))
+	}
+	for i, hash := range expected {
+		if block.Transactions[i+1].Hash() != hash {
+			t.Errorf("Transaction %d is not the expected one", i+1)
+		}
+	}
+	if template.TotalFees != 7100 {
+		t.Errorf("Expected fees 7100, got %d", template.TotalFees)
+	}
+	subsidy := blockchain.CalcBlockSubsidy(1, &h.params)
+	if value := block.Transactions[0].Vout[0].Value; value != subsidy+7100 {
+		t.Errorf("Expected the coinbase to pay %d, got %d", subsidy+7100, value)
+	}
+	if block.Header.PrevBlockHash != h.chain.BestHash() {
+		t.Errorf("Block does not build on the best chain")
+	}
+	if block.Size != block.SerSize() || block.TxCount != 4 {
+		t.Errorf("Block Size %d or TxCount %d not filled in", block.Size, block.TxCount)
+	}
+
+	miner := mining.NewMiner(mining.Config{Workers: 2})
+	if err := miner.Solve(context.Background(), &block.Header, template.UpdateExtraNonce); err != nil {
+		t.Fatalf("Unable to mine block %s", err)
+	}
+	isMain, err := h.chain.ProcessBlock(block)
+	if err != nil {
+		t.Fatalf("Unexpected error processing the template %s", err)
+	}
+	if !isMain {
+		t.Errorf("Expected the template to extend the best chain")
+	}
+	if h.pool.Count() != 0 {
+		t.Errorf("Expected the mined transactions to leave the pool, %d left", h.pool.Count())
+	}
+}
+
+func TestUpdateExtraNonce(t *testing.T) {
+	h := newTemplateTestHarness(t)
+	defer h.close()
+
+	h.spend(h.funds, 0, 9000)
+	template, err := NewBlockTemplate(h.pool, &h.params, p2pkhScript(h.key))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	size := template.Block.Size
+	before := template.Block.Header.MerkleRoot
+	root := template.UpdateExtraNonce(7)
+	if root == before || root != template.Block.Header.MerkleRoot {
+		t.Errorf("Expected a new MerkleRoot in the header")
+	}
+	if template.Block.SerSize() != size {
+		t.Errorf("Expected the block size to stay %d, got %d", size, template.Block.SerSize())
+	}
+}
@@ -2,11 +2,9 @@ package chain
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
-	"encoding/hex"
+	"spchain/chainhash"
 	"spchain/db"
-	"spchain/util"
 )
 
 // Block An sp-chain transaction
@@ -23,63 +21,68 @@ func (b *Block) Ser() *bytes.Buffer {
 	binary.Write(&ret, littleEndian, b.Size)
 	headerSer := b.Header.Ser()
 	binary.Write(&ret, littleEndian, headerSer.Bytes())
-	binary.Write(&ret, littleEndian, b.TxCount)
+	writeCount(&ret, b.TxCount, b.Header.Version >= BlockVersionCompactSize)
 	for _, tx := range b.Transactions {
 		binary.Write(&ret, littleEndian, tx.Serialise().Bytes())
 	}
 	return &ret
 }
 
-// Hash The block hash is the double SHA256 hash of the block
-func (b *Block) Hash() [32]byte {
-	ser := b.Ser().Bytes()
-	sha1 := sha256.Sum256(ser)
-	sha2 := sha256.Sum256(sha1[:])
-	return sha2
+// Hash The block hash is the double SHA256 hash of the block header.
+// The header commits to the transactions through the MerkleRoot
+// and this is the hash the proof of work is done on
+func (b *Block) Hash() chainhash.Hash {
+	return b.Header.Hash()
 }
 
-// HashString The block hash as a hex encoded string
-func (b *Block) HashString() string {
-	hash := b.Hash()
-	return hex.EncodeToString(hash[:])
+// SerSize The number of bytes in the serialised block
+func (b *Block) SerSize() int32 {
+	return int32(b.Ser().Len())
 }
 
 type MerkelResult struct {
-	Root [32]byte
-	Path [][32]byte
+	Root chainhash.Hash
+	Path []chainhash.Hash
+}
+
+// merkleParent The hash of a node in the merkle tree from its children
+func merkleParent(left chainhash.Hash, right chainhash.Hash) chainhash.Hash {
+	combined := []byte{}
+	combined = append(combined, left[:]...)
+	combined = append(combined, right[:]...)
+	return chainhash.HashH(combined)
 }
 
 // Calculate the merkleRoot for a block
 // The last value in the linear merkleRoot representation will
-// be the merkleRoot
+// be the merkleRoot. A block without transactions has a zero root
 func (b *Block) CalcMerkle() MerkelResult {
-	ret := [][32]byte{}
-	workingSet := [][32]byte{}
+	ret := []chainhash.Hash{}
+	workingSet := []chainhash.Hash{}
 
 	// Create array of transaction hashes in order
 	for _, tx := range b.Transactions {
 		workingSet = append(workingSet, tx.Hash())
 	}
 
-	// If not even add 0 hash to the end
-	if len(workingSet)%2 != 0 {
-		workingSet = append(workingSet, util.Init32byteArray(0x00))
+	if len(workingSet) == 0 {
+		return MerkelResult{Path: ret, Root: chainhash.Hash{}}
 	}
 
-	for len(workingSet) > 1 {
-		copiedSet := [][32]byte{}
+	for len(workingSet) > 1 || len(ret) == 0 {
+		// If not even add 0 hash to the end
+		if len(workingSet)%2 != 0 {
+			workingSet = append(workingSet, chainhash.Hash{})
+		}
+
+		copiedSet := []chainhash.Hash{}
 		for _, hash := range workingSet {
 			copiedSet = append(copiedSet, hash)
 		}
-		workingSet = [][32]byte{}
-
-		for i := 0; i < len(copiedSet); i = +2 {
-			hash1 := copiedSet[i]
-			hash2 := copiedSet[i+1]
-			combined := []byte{}
-			combined = append(combined, hash1[:]...)
-			combined = append(combined, hash2[:]...)
-			combinedHash := sha256.Sum256(combined)
+		workingSet = []chainhash.Hash{}
+
+		for i := 0; i < len(copiedSet); i += 2 {
+			combinedHash := merkleParent(copiedSet[i], copiedSet[i+1])
 			workingSet = append(workingSet, combinedHash)
 			ret = append(ret, combinedHash)
 		}
@@ -90,33 +93,38 @@ func (b *Block) CalcMerkle() MerkelResult {
 	}
 }
 
-// DeserialiseBlock Deserialise a block
-func DeserialiseBlock(buff *bytes.Buffer) Block {
+// DeserialiseBlock Deserialise a block. Every byte of buff must be used
+func DeserialiseBlock(buff *bytes.Buffer) (Block, error) {
 	var ret Block
+	r := newReader(buff)
 
-	binary.Read(buff, littleEndian, &ret.Size)
-	ret.Header = DeserialiseBlockHeader(buff)
-	binary.Read(buff, littleEndian, &ret.TxCount)
-	for txCount := int64(0); txCount < ret.TxCount; txCount++ {
-		tx := DeserialiseTx(buff)
+	r.read("block Size", &ret.Size)
+	ret.Header = readBlockHeader(r)
+	ret.TxCount = r.readCount("TxCount", ret.Header.Version >= BlockVersionCompactSize, minTxSize)
+	for txCount := int64(0); txCount < ret.TxCount && r.err == nil; txCount++ {
+		tx := readTx(r)
 		ret.Transactions = append(ret.Transactions, tx)
 	}
 
-	return ret
+	if err := r.end("block"); err != nil {
+		return Block{}, err
+	}
+	return ret, nil
 }
 
 // GetBlock
-func GetBlock(hash string, db db.Interface) (Block, error) {
+func GetBlock(hash chainhash.Hash, db db.Interface) (Block, error) {
 	buff, err := db.GetBlock(hash)
 	if err != nil {
 		return Block{}, err
 	}
 
-	return DeserialiseBlock(buff), nil
+	return DeserialiseBlock(buff)
 }
 
 // Save this block into the database
+// The block is not checked, callers should validate it with
+// blockchain.ValidateBlock first
 func (b* Block) Save(db db.Interface) error {
-	hashStr := b.HashString()
-	return db.SaveBlock(hashStr, b.Ser())
+	return db.SaveBlock(b.Hash(), b.Ser())
 }
@@ -3,6 +3,7 @@ package chain
 import (
 	"github.com/davecgh/go-spew/spew"
 	"bytes"
+	"spchain/chainhash"
 	"spchain/key"
 	"spchain/script"
 	"spchain/util"
@@ -31,9 +32,9 @@ func createTxOutputBlockTest() OutputTx {
 }
 
 func createTxInputBlockTestNoSig() InputTx {
-	txid32 := util.Init32byteArray(0x01)
+	txid32 := chainhash.Hash(util.Init32byteArray(0x01))
 	return InputTx{
-		Txid:      txid32[:],
+		Txid:      txid32,
 		OutInx:    1,
 		ScriptSig: []byte{},
 		Sequence:  20,
@@ -55,12 +56,12 @@ func createTxBlockTest() Tx {
 	privKeyHexString := "18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"
 	key := key.ImportFromPrivKeyHexString(privKeyHexString)
 
-	txHash := tx.SerialiseForSign().Bytes()
-	sig, _ := key.PrivateKey.Sign(txHash)
+	prevOut := createTxOutputBlockTest()
+	sig, _ := tx.SignInput(0, key.PrivateKey, &prevOut)
 
 	script := script.Stack{
 		Contents: []script.Operand{
-			script.SIG{Sig: sig.Serialize()},
+			script.SIG{Sig: sig},
 			script.PUB_KEY_V1{Key: key.PublicKey.SerializeCompressed()},
 		},
 	}
@@ -81,6 +82,47 @@ func TestMerkle(t *testing.T) {
 	block.CalcMerkle()
 }
 
+func TestMerkleManyTransactions(t *testing.T) {
+	txs := []Tx{}
+	roots := map[chainhash.Hash]bool{}
+	for i := 0; i < 7; i++ {
+		tx := createTxBlockTest()
+		tx.LockTime = int32(i)
+		txs = append(txs, tx)
+
+		block := Block{Header: mockBlockHeader(), TxCount: int64(len(txs)), Transactions: txs}
+		root := block.CalcMerkle().Root
+		if roots[root] {
+			t.Errorf("Expected a different merkle root with %d transactions", len(txs))
+		}
+		roots[root] = true
+	}
+
+	empty := Block{Header: mockBlockHeader()}
+	if root := empty.CalcMerkle().Root; !root.IsZero() {
+		t.Errorf("Expected zero merkle root for an empty block")
+	}
+}
+
+func TestBlockHashIsHeaderHash(t *testing.T) {
+	block := Block{
+		Size:         30,
+		Header:       mockBlockHeader(),
+		TxCount:      1,
+		Transactions: []Tx{createTxBlockTest()},
+	}
+
+	blockHash := block.Hash()
+	headerHash := block.Header.Hash()
+	if blockHash != headerHash {
+		t.Errorf("Expected block hash %x to be the header hash %x", blockHash, headerHash)
+	}
+
+	if block.SerSize() != int32(block.Ser().Len()) {
+		t.Errorf("SerSize %d expected %d", block.SerSize(), block.Ser().Len())
+	}
+}
+
 // TestBlockSerialisation Test serialisation and deserialisation
 func TestBlockSerialisation(t *testing.T) {
 	block := Block{
@@ -91,7 +133,10 @@ func TestBlockSerialisation(t *testing.T) {
 	}
 
 	ser := block.Ser()
-	dser := DeserialiseBlock(ser)
+	dser, err := DeserialiseBlock(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
 
 	if dser.Size != block.Size {
 		t.Errorf("Size %#v expected: %#v", dser.Size, block.Size)
@@ -104,11 +149,27 @@ func TestBlockSerialisation(t *testing.T) {
 	if dser.TxCount != block.TxCount {
 		t.Errorf("TxCount %#v expected: %#v", dser.TxCount, block.TxCount)
 	}
+}
+
+// TestBlockSerialisationTxHash The transactions keep their hashes when
+// a block is serialised and deserialised
+func TestBlockSerialisationTxHash(t *testing.T) {
+	block := Block{
+		Size:         30,
+		Header:       mockBlockHeader(),
+		TxCount:      1,
+		Transactions: []Tx{createTxBlockTest()},
+	}
+
+	dser, err := DeserialiseBlock(block.Ser())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
 
 	deserialisedTx0Hash := dser.Transactions[0].Hash()
 	originalTx0Hash := block.Transactions[0].Hash()
-	if bytes.Equal( deserialisedTx0Hash[:], originalTx0Hash[:]) {
-		spew.Dump("Expected tx hash", originalTx0Hash, "got",  deserialisedTx0Hash)
+	if !bytes.Equal(deserialisedTx0Hash[:], originalTx0Hash[:]) {
+		spew.Dump("Expected tx hash", originalTx0Hash, "got", deserialisedTx0Hash)
 		t.Errorf("Transactions incorrectly serialised")
 	}
 }
@@ -2,18 +2,16 @@ package chain
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
+	"spchain/chainhash"
 )
 
 var littleEndian = binary.LittleEndian
 
 type BlockHeader struct {
-	Version int32
-	// Should be 32 bytes
-	PrevBlockHash []byte
-	// Should be 32 bytes
-	MerkleRoot       []byte
+	Version          int32
+	PrevBlockHash    chainhash.Hash
+	MerkleRoot       chainhash.Hash
 	TimeStamp        int64
 	DifficultyTarget int32
 	Nonce            int32
@@ -32,31 +30,33 @@ func (b BlockHeader) Ser() *bytes.Buffer {
 }
 
 // Hash calcuate double SHA256 of header
-func (b *BlockHeader) Hash() [32]byte {
-	ser := b.Ser().Bytes()
-	sha1 := sha256.Sum256(ser)
-	sha2 := sha256.Sum256(sha1[:])
-	return sha2
+func (b *BlockHeader) Hash() chainhash.Hash {
+	return chainhash.DoubleHashH(b.Ser().Bytes())
 }
 
-// DeserialiseBlockHeader Deserialise the blockheader
-func DeserialiseBlockHeader(buff *bytes.Buffer) BlockHeader {
-	var ret BlockHeader
-
-	binary.Read(buff, littleEndian, &ret.Version)
+// DeserialiseBlockHeader Deserialise the blockheader. Every byte of buff
+// must be used
+func DeserialiseBlockHeader(buff *bytes.Buffer) (BlockHeader, error) {
+	r := newReader(buff)
+	ret := readBlockHeader(r)
+	if err := r.end("block header"); err != nil {
+		return BlockHeader{}, err
+	}
+	return ret, nil
+}
 
-	prevBlockHash := [32]byte{}
-	binary.Read(buff, littleEndian, &prevBlockHash)
+// readBlockHeader Read a blockheader
+func readBlockHeader(r *reader) BlockHeader {
+	var ret BlockHeader
 
-	merkleRoot := [32]byte{}
-	binary.Read(buff, littleEndian, &merkleRoot)
+	r.read("header Version", &ret.Version)
 
-	binary.Read(buff, littleEndian, &ret.TimeStamp)
-	binary.Read(buff, littleEndian, &ret.DifficultyTarget)
-	binary.Read(buff, littleEndian, &ret.Nonce)
+	r.read("PrevBlockHash", &ret.PrevBlockHash)
+	r.read("MerkleRoot", &ret.MerkleRoot)
 
-	ret.PrevBlockHash = prevBlockHash[:]
-	ret.MerkleRoot = merkleRoot[:]
+	r.read("TimeStamp", &ret.TimeStamp)
+	r.read("DifficultyTarget", &ret.DifficultyTarget)
+	r.read("Nonce", &ret.Nonce)
 
 	return ret
 }
@@ -2,7 +2,7 @@ package chain
 
 import (
 	"bytes"
-	"encoding/hex"
+	"spchain/chainhash"
 	"testing"
 )
 
@@ -10,13 +10,13 @@ func mockBlockHeader() BlockHeader {
 	prevBlockHash := "0000000000000000000d9dca531a2a0a179ff72d2fcc9339577c98b369337cff"
 	merkleRoot := "5467954125490dad6e04ce8d4eaea7ac5bb1171b49a60d79624d9d6dfc624052"
 
-	prevBlockHashBinary, _ := hex.DecodeString(prevBlockHash)
-	merkleRootBinary, _ := hex.DecodeString(merkleRoot)
+	prevBlockHashBinary, _ := chainhash.NewHashFromStr(prevBlockHash)
+	merkleRootBinary, _ := chainhash.NewHashFromStr(merkleRoot)
 
 	return BlockHeader{
 		545259520,
-		prevBlockHashBinary,
-		merkleRootBinary,
+		*prevBlockHashBinary,
+		*merkleRootBinary,
 		20,
 		419668748,
 		440532392,
@@ -29,13 +29,16 @@ func TestBlockHeaderSerialisation(t *testing.T) {
 	header := mockBlockHeader()
 
 	ser := header.Ser()
-	dser := DeserialiseBlockHeader(ser)
+	dser, err := DeserialiseBlockHeader(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
 
-	if !bytes.Equal(dser.PrevBlockHash, header.PrevBlockHash) {
+	if dser.PrevBlockHash != header.PrevBlockHash {
 		t.Errorf("PrevBlockHash %#v expected: %#v", dser.PrevBlockHash, header.PrevBlockHash)
 	}
 
-	if !bytes.Equal(dser.MerkleRoot, header.MerkleRoot) {
+	if dser.MerkleRoot != header.MerkleRoot {
 		t.Errorf("MerkleRoot %#v expected: %#v", dser.MerkleRoot, header.MerkleRoot)
 	}
 
@@ -0,0 +1,168 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"spchain/chainhash"
+	"spchain/db"
+)
+
+/*
+  BlockMeta and BestBlock are kept alongside the blocks so the
+  chain state can be looked up without reading every block. The
+  metadata of every stored block holds its header, so the whole block
+  index can be rebuilt from it.
+*/
+
+// BlockStatus Validation state of a block
+type BlockStatus byte
+
+const (
+	// BlockStatusValid The block passed validation and, if it has been
+	// connected, its transactions passed too
+	BlockStatusValid BlockStatus = iota
+
+	// BlockStatusInvalid The block or one of its transactions failed validation
+	BlockStatusInvalid
+)
+
+// BlockMeta What is known about a stored block
+type BlockMeta struct {
+	Header BlockHeader
+	// Height The height of the block on its branch
+	Height int32
+	Status BlockStatus
+	// ChainWork The total work of the branch ending at the block
+	ChainWork *big.Int
+	// Size The serialised size of the block
+	Size int32
+	// Location Where the database stores the block, see
+	// db.Interface.BlockLocation
+	Location string
+}
+
+// Ser Serialise the BlockMeta
+func (m *BlockMeta) Ser() *bytes.Buffer {
+	var ret bytes.Buffer
+	binary.Write(&ret, littleEndian, m.Header.Ser().Bytes())
+	binary.Write(&ret, littleEndian, m.Height)
+	binary.Write(&ret, littleEndian, m.Status)
+	binary.Write(&ret, littleEndian, m.Size)
+	work := []byte{}
+	if m.ChainWork != nil {
+		work = m.ChainWork.Bytes()
+	}
+	writeVarBytes(&ret, work, true)
+	writeVarBytes(&ret, []byte(m.Location), true)
+	return &ret
+}
+
+// DeserialiseBlockMeta Deserialise bytes to a BlockMeta. Every byte
+// of b must be used
+func DeserialiseBlockMeta(b *bytes.Buffer) (BlockMeta, error) {
+	var ret BlockMeta
+	r := newReader(b)
+	ret.Header = readBlockHeader(r)
+	r.read("meta Height", &ret.Height)
+	r.read("meta Status", &ret.Status)
+	r.read("meta Size", &ret.Size)
+	work := r.readVarBytes("ChainWork", true)
+	location := r.readVarBytes("Location", true)
+	if err := r.end("block meta"); err != nil {
+		return BlockMeta{}, err
+	}
+	ret.ChainWork = new(big.Int).SetBytes(work)
+	ret.Location = string(location)
+	return ret, nil
+}
+
+// SaveBlockMeta Save the metadata of the block with hash
+func SaveBlockMeta(hash chainhash.Hash, meta *BlockMeta, db db.Interface) error {
+	return db.SaveBlockMeta(hash, meta.Ser())
+}
+
+// SaveBlockWithMeta Save block and its metadata together. The Header,
+// Size and Location of meta are set from block
+func SaveBlockWithMeta(block *Block, meta *BlockMeta, db db.Interface) error {
+	hash := block.Hash()
+	ser := block.Ser()
+	meta.Header = block.Header
+	meta.Size = int32(ser.Len())
+	meta.Location = db.BlockLocation(hash)
+	return db.WriteBlock(hash, ser, meta.Ser())
+}
+
+// ForEachBlockMeta Call fn with the hash and metadata of every
+// stored block
+func ForEachBlockMeta(db db.Interface, fn func(hash chainhash.Hash, meta *BlockMeta) error) error {
+	return db.ForEachBlockMeta(func(hash chainhash.Hash, buff *bytes.Buffer) error {
+		meta, err := DeserialiseBlockMeta(buff)
+		if err != nil {
+			return err
+		}
+		return fn(hash, &meta)
+	})
+}
+
+// GetBlockMeta The metadata of the block with hash
+func GetBlockMeta(hash chainhash.Hash, db db.Interface) (BlockMeta, error) {
+	buff, err := db.GetBlockMeta(hash)
+	if err != nil {
+		return BlockMeta{}, err
+	}
+	return DeserialiseBlockMeta(buff)
+}
+
+// BestBlock The tip of the best chain
+type BestBlock struct {
+	Hash   chainhash.Hash
+	Height int32
+}
+
+// Ser Serialise the BestBlock
+func (b *BestBlock) Ser() *bytes.Buffer {
+	var ret bytes.Buffer
+	binary.Write(&ret, littleEndian, b.Hash)
+	binary.Write(&ret, littleEndian, b.Height)
+	return &ret
+}
+
+// DeserialiseBestBlock Deserialise bytes to a BestBlock. Every byte
+// of b must be used
+func DeserialiseBestBlock(b *bytes.Buffer) (BestBlock, error) {
+	var ret BestBlock
+	r := newReader(b)
+	r.read("best Hash", &ret.Hash)
+	r.read("best Height", &ret.Height)
+	if err := r.end("best block"); err != nil {
+		return BestBlock{}, err
+	}
+	return ret, nil
+}
+
+// GetBlockByHeight The block at height on the best chain
+func GetBlockByHeight(height int32, db db.Interface) (Block, error) {
+	hash, err := db.GetBlockHashByHeight(height)
+	if err != nil {
+		return Block{}, err
+	}
+	return GetBlock(hash, db)
+}
+
+// GetBestBlock The tip of the best chain and its height
+func GetBestBlock(db db.Interface) (Block, int32, error) {
+	buff, err := db.GetBestBlock()
+	if err != nil {
+		return Block{}, 0, err
+	}
+	best, err := DeserialiseBestBlock(buff)
+	if err != nil {
+		return Block{}, 0, err
+	}
+	block, err := GetBlock(best.Hash, db)
+	if err != nil {
+		return Block{}, 0, err
+	}
+	return block, best.Height, nil
+}
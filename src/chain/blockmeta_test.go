@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"math/big"
+	"spchain/chainhash"
+	"spchain/db"
+	"testing"
+)
+
+func TestBlockMetaSerDer(t *testing.T) {
+	work, _ := new(big.Int).SetString("123456789abcdef0123456789", 16)
+	meta := BlockMeta{
+		Header:    mockBlockHeader(),
+		Height:    12,
+		Status:    BlockStatusInvalid,
+		ChainWork: work,
+		Size:      300,
+		Location:  "b_0102",
+	}
+	dser, err := DeserialiseBlockMeta(meta.Ser())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if dser.Height != meta.Height || dser.Status != meta.Status || dser.Size != meta.Size {
+		t.Errorf("BlockMeta %#v expected: %#v", dser, meta)
+	}
+	if dser.Header != meta.Header || dser.Location != meta.Location {
+		t.Errorf("Header and Location %#v %s expected: %#v %s", dser.Header, dser.Location, meta.Header, meta.Location)
+	}
+	if dser.ChainWork.Cmp(work) != 0 {
+		t.Errorf("ChainWork %s expected: %s", dser.ChainWork, work)
+	}
+}
+
+func TestBlockMetaSaveGet(t *testing.T) {
+	memDb := newMemDb()
+	meta := BlockMeta{Height: 1, ChainWork: big.NewInt(2), Size: 3}
+	if err := SaveBlockMeta(chainhash.Hash{0xaa}, &meta, memDb); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	got, err := GetBlockMeta(chainhash.Hash{0xaa}, memDb)
+	if err != nil || got.Height != 1 || got.ChainWork.Int64() != 2 {
+		t.Errorf("Expected saved meta, got %#v %v", got, err)
+	}
+	if _, err := GetBlockMeta(chainhash.Hash{0xbb}, memDb); err != db.ErrNotFound {
+		t.Errorf("Expected %s, got %v", db.ErrNotFound, err)
+	}
+}
+
+func TestSaveBlockWithMeta(t *testing.T) {
+	memDb := newMemDb()
+	block := utxoTestBlock(0, []Tx{utxoTestCoinbase(0)})
+	hash := block.Hash()
+	meta := BlockMeta{Height: 4, ChainWork: big.NewInt(5)}
+	if err := SaveBlockWithMeta(&block, &meta, memDb); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if saved, err := GetBlock(hash, memDb); err != nil || saved.Hash() != hash {
+		t.Errorf("Expected the saved block, got %v", err)
+	}
+	found := 0
+	err := ForEachBlockMeta(memDb, func(metaHash chainhash.Hash, got *BlockMeta) error {
+		found++
+		if metaHash != hash || got.Header.Hash() != hash || got.Height != 4 {
+			t.Errorf("Unexpected meta %#v for %s", got, metaHash)
+		}
+		if got.Size != int32(block.Ser().Len()) || got.Location != memDb.BlockLocation(hash) {
+			t.Errorf("Expected size %d at %s, got %d at %s",
+				block.Ser().Len(), memDb.BlockLocation(hash), got.Size, got.Location)
+		}
+		return nil
+	})
+	if err != nil || found != 1 {
+		t.Errorf("Expected one saved meta, got %d %v", found, err)
+	}
+}
+
+func TestBestBlockAndHeightIndex(t *testing.T) {
+	memDb := newMemDb()
+	set := NewUtxoSet(memDb)
+
+	if _, _, err := GetBestBlock(memDb); err != db.ErrNotFound {
+		t.Errorf("Expected %s before any block is connected, got %v", db.ErrNotFound, err)
+	}
+
+	block0 := utxoTestBlock(0, []Tx{utxoTestCoinbase(0)})
+	block0.Header.PrevBlockHash = chainhash.Hash{}
+	block0Hash := block0.Hash()
+	block1 := utxoTestBlock(0, []Tx{utxoTestCoinbase(1)})
+	block1.Header.PrevBlockHash = block0Hash
+
+	for height, block := range []*Block{&block0, &block1} {
+		if err := block.Save(memDb); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if err := set.ConnectBlock(block, int32(height)); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	best, height, err := GetBestBlock(memDb)
+	if err != nil || height != 1 || best.Hash() != block1.Hash() {
+		t.Errorf("Expected block 1 to be the best block, got height %d %v", height, err)
+	}
+	atHeight, err := GetBlockByHeight(0, memDb)
+	if err != nil || atHeight.Hash() != block0Hash {
+		t.Errorf("Expected block 0 at height 0, got %v", err)
+	}
+
+	if err := set.DisconnectBlock(&block1, 1); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	best, height, err = GetBestBlock(memDb)
+	if err != nil || height != 0 || best.Hash() != block0Hash {
+		t.Errorf("Expected block 0 to be the best block, got height %d %v", height, err)
+	}
+	if _, err := GetBlockByHeight(1, memDb); err != db.ErrNotFound {
+		t.Errorf("Expected height 1 to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// CoinBaseScriptSig The ScriptSig of a coinbase. The block height
+// followed by the extra nonce the miner rolls when the header nonce
+// space is used up. The coinbase ScriptSig is never executed
+func CoinBaseScriptSig(height int32, extraNonce uint64) []byte {
+	var ret bytes.Buffer
+	binary.Write(&ret, littleEndian, height)
+	binary.Write(&ret, littleEndian, extraNonce)
+	return ret.Bytes()
+}
+
+// CoinBaseHeight The block height at the start of a coinbase ScriptSig
+// written by CoinBaseScriptSig. False if the ScriptSig is too short
+func CoinBaseHeight(scriptSig []byte) (int32, bool) {
+	if len(scriptSig) < 4 {
+		return 0, false
+	}
+	return int32(littleEndian.Uint32(scriptSig)), true
+}
+
+// NewCoinBaseTx Create the coinbase for the block at height paying
+// value to scriptPubKey. The single input spends the null outpoint
+func NewCoinBaseTx(height int32, extraNonce uint64, value int64, scriptPubKey []byte) Tx {
+	return Tx{
+		Version: TxVersionCompactSize,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin: []InputTx{{
+			OutInx:    -1,
+			ScriptSig: CoinBaseScriptSig(height, extraNonce),
+			Sequence:  -1,
+		}},
+		Vout: []OutputTx{{
+			Value:        value,
+			ScriptPubKey: append([]byte{}, scriptPubKey...),
+		}},
+	}
+}
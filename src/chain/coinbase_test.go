@@ -0,0 +1,40 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestNewCoinBaseTx(t *testing.T) {
+	scriptPubKey := []byte{1, 2, 3}
+	tx := NewCoinBaseTx(42, 7, 5000, scriptPubKey)
+
+	if !tx.IsCoinBase() {
+		t.Errorf("Expected a coinbase")
+	}
+
+	if tx.Vout[0].Value != 5000 || !bytes.Equal(tx.Vout[0].ScriptPubKey, scriptPubKey) {
+		t.Errorf("Unexpected output %#v", tx.Vout[0])
+	}
+
+	scriptSig := tx.Vin[0].ScriptSig
+	if height := binary.LittleEndian.Uint32(scriptSig); height != 42 {
+		t.Errorf("Expected height %d in ScriptSig, got %d", 42, height)
+	}
+	if extraNonce := binary.LittleEndian.Uint64(scriptSig[4:]); extraNonce != 7 {
+		t.Errorf("Expected extra nonce %d in ScriptSig, got %d", 7, extraNonce)
+	}
+
+	if height, ok := CoinBaseHeight(scriptSig); !ok || height != 42 {
+		t.Errorf("Expected CoinBaseHeight %d, got %d", 42, height)
+	}
+	if _, ok := CoinBaseHeight(scriptSig[:3]); ok {
+		t.Errorf("Expected no height in a 3 byte ScriptSig")
+	}
+
+	other := NewCoinBaseTx(42, 8, 5000, scriptPubKey)
+	if tx.Hash() == other.Hash() {
+		t.Errorf("Expected the extra nonce to change the transaction hash")
+	}
+}
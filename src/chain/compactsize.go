@@ -0,0 +1,52 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"spchain/varint"
+)
+
+/*
+  Version 1 transactions and blocks write TxInNo, TxOutNo and TxCount
+  as 8 byte integers and script lengths as a single byte. From
+  TxVersionCompactSize and BlockVersionCompactSize they are all written
+  as CompactSize, so existing version 1 data decodes the same and its
+  hashes are unchanged.
+
+  A version 1 script can't be longer than MaxOneByteScriptLen.
+*/
+
+const (
+	// TxVersionCompactSize The first transaction version which
+	// writes TxInNo and TxOutNo as CompactSize
+	TxVersionCompactSize = 2
+
+	// BlockVersionCompactSize The first block version which
+	// writes TxCount as CompactSize
+	BlockVersionCompactSize = 2
+
+	// MaxOneByteScriptLen The longest script a transaction before
+	// TxVersionCompactSize can hold
+	MaxOneByteScriptLen = 0xff
+)
+
+// writeCount Write a count as CompactSize or, for the old format,
+// an 8 byte integer
+func writeCount(b *bytes.Buffer, n int64, compact bool) {
+	if compact {
+		varint.Write(b, uint64(n))
+		return
+	}
+	binary.Write(b, littleEndian, n)
+}
+
+// writeVarBytes Write data preceded by its length as CompactSize or,
+// for the old format, a single byte
+func writeVarBytes(b *bytes.Buffer, data []byte, compact bool) {
+	if compact {
+		varint.Write(b, uint64(len(data)))
+	} else {
+		b.WriteByte(byte(len(data)))
+	}
+	b.Write(data)
+}
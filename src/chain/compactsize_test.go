@@ -0,0 +1,121 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// oldFormatTx Serialise tx the way version 1 always has, with 8 byte
+// counts and single byte script lengths
+func oldFormatTx(tx *Tx) []byte {
+	var buff bytes.Buffer
+	binary.Write(&buff, littleEndian, tx.Version)
+	binary.Write(&buff, littleEndian, tx.TxInNo)
+	for _, in := range tx.Vin {
+		buff.Write(in.Txid[:])
+		binary.Write(&buff, littleEndian, in.OutInx)
+		buff.WriteByte(byte(len(in.ScriptSig)))
+		buff.Write(in.ScriptSig)
+		binary.Write(&buff, littleEndian, in.Sequence)
+	}
+	binary.Write(&buff, littleEndian, tx.TxOutNo)
+	for _, out := range tx.Vout {
+		binary.Write(&buff, littleEndian, out.Value)
+		buff.WriteByte(byte(len(out.ScriptPubKey)))
+		buff.Write(out.ScriptPubKey)
+	}
+	binary.Write(&buff, littleEndian, tx.LockTime)
+	return buff.Bytes()
+}
+
+func TestVersion1TxKeepsOldFormat(t *testing.T) {
+	tx := createTxBlockTest()
+	tx.Version = 1
+	old := oldFormatTx(&tx)
+
+	if !bytes.Equal(tx.Serialise().Bytes(), old) {
+		t.Errorf("Expected version 1 to serialise in the old format")
+	}
+
+	dser, err := DeserialiseTx(bytes.NewBuffer(old))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if dser.Hash() != tx.Hash() || dser.TxInNo != 1 || !bytes.Equal(dser.Vin[0].ScriptSig, tx.Vin[0].ScriptSig) {
+		t.Errorf("Expected the old format to decode, got %#v", dser)
+	}
+}
+
+func TestVersion1LongScriptSig(t *testing.T) {
+	// 0xfd bytes would start a 3 byte CompactSize length
+	tx := createTxBlockTest()
+	tx.Version = 1
+	tx.Vin[0].ScriptSig = bytes.Repeat([]byte{0x08}, 253)
+	old := oldFormatTx(&tx)
+
+	if !bytes.Equal(tx.Serialise().Bytes(), old) {
+		t.Errorf("Expected a 253 byte ScriptSig to have a single length byte")
+	}
+	dser, err := DeserialiseTx(bytes.NewBuffer(old))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if dser.Hash() != tx.Hash() || !bytes.Equal(dser.Vin[0].ScriptSig, tx.Vin[0].ScriptSig) {
+		t.Errorf("Expected the 253 byte ScriptSig to round trip")
+	}
+}
+
+func TestCompactSizeTx(t *testing.T) {
+	tx := createTxBlockTest()
+	tx.Version = TxVersionCompactSize
+	tx.Vout[0].ScriptPubKey = bytes.Repeat([]byte{0x07}, 300)
+	tx.Vin[0].ScriptSig = bytes.Repeat([]byte{0x08}, 70000)
+
+	ser := tx.Serialise()
+	// Version, 1 byte count, input with 5 byte script length,
+	// 1 byte count, output with 3 byte script length, LockTime
+	expected := 4 + 1 + (32 + 4 + 5 + 70000 + 4) + 1 + (8 + 3 + 300) + 4
+	if ser.Len() != expected {
+		t.Errorf("Expected %d bytes, got %d", expected, ser.Len())
+	}
+
+	dser, err := DeserialiseTx(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if dser.Hash() != tx.Hash() {
+		t.Errorf("Expected the transaction to round trip")
+	}
+	if len(dser.Vin[0].ScriptSig) != 70000 || len(dser.Vout[0].ScriptPubKey) != 300 {
+		t.Errorf("Expected long scripts to round trip, got %d and %d",
+			len(dser.Vin[0].ScriptSig), len(dser.Vout[0].ScriptPubKey))
+	}
+}
+
+func TestCompactSizeBlock(t *testing.T) {
+	for _, version := range []int32{1, BlockVersionCompactSize} {
+		header := mockBlockHeader()
+		header.Version = version
+		tx := createTxBlockTest()
+		block := Block{Header: header, TxCount: 1, Transactions: []Tx{tx}}
+
+		ser := block.Ser()
+		countSize := 8
+		if version >= BlockVersionCompactSize {
+			countSize = 1
+		}
+		expected := 4 + header.Ser().Len() + countSize + tx.Serialise().Len()
+		if ser.Len() != expected {
+			t.Errorf("Version %d: expected %d bytes, got %d", version, expected, ser.Len())
+		}
+
+		dser, err := DeserialiseBlock(ser)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if dser.TxCount != 1 || len(dser.Transactions) != 1 || dser.Transactions[0].Hash() != tx.Hash() {
+			t.Errorf("Version %d: expected the block to round trip", version)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package chain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"spchain/chainhash"
+	"spchain/script"
+	"strconv"
+	"strings"
+)
+
+/*
+  JSON for debugging, RPC and test fixtures. Hashes are hex in display
+  byte order and other byte strings are hex, scripts are shown
+  disassembled next to their hex, and amounts are given in base units
+  and in coins. The txid, block hash, transaction size, script assembly
+  and coin amount are computed when marshalling and ignored when
+  unmarshalling, so hand written JSON only needs the serialised fields.
+  TxInNo, TxOutNo and TxCount are taken from the number of inputs,
+  outputs and transactions.
+*/
+
+// scriptJSON A script as hex with its disassembly
+type scriptJSON struct {
+	Asm string `json:"asm"`
+	Hex string `json:"hex"`
+}
+
+func newScriptJSON(b []byte) scriptJSON {
+	asm, err := script.Disassemble(b)
+	if err != nil {
+		asm = "[error]"
+	}
+	return scriptJSON{Asm: asm, Hex: hex.EncodeToString(b)}
+}
+
+// decodeHex Decode the hex string s of field
+func decodeHex(field string, s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", field, err)
+	}
+	return b, nil
+}
+
+// FormatAmount value in base units as a decimal number of coins
+func FormatAmount(value int64) string {
+	sign := ""
+	abs := uint64(value)
+	if value < 0 {
+		sign = "-"
+		abs = uint64(-value)
+	}
+	return fmt.Sprintf("%s%d.%08d", sign, abs/BaseUnitsPerCoin, abs%BaseUnitsPerCoin)
+}
+
+// ParseAmount A decimal number of coins in base units. Fractions of a
+// base unit are an error
+func ParseAmount(s string) (int64, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if len(frac) > 8 {
+		return 0, fmt.Errorf("amount %s has more than 8 decimal places", s)
+	}
+	negative := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+	// ParseInt takes a sign, so check for digits first
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %s", s)
+	}
+	coins, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %s", s)
+	}
+	var units int64
+	if frac != "" {
+		units, err = strconv.ParseInt(frac+strings.Repeat("0", 8-len(frac)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %s", s)
+		}
+	}
+	if coins > MaxMoney/BaseUnitsPerCoin {
+		return 0, fmt.Errorf("amount %s is more than the maximum", s)
+	}
+	value := coins*BaseUnitsPerCoin + units
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// isDigits True if s is only decimal digits
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type outputTxJSON struct {
+	Value        int64       `json:"value"`
+	Amount       json.Number `json:"amount"`
+	ScriptPubKey scriptJSON  `json:"scriptPubKey"`
+}
+
+// MarshalJSON The output as JSON
+func (b OutputTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(outputTxJSON{
+		Value:        b.Value,
+		Amount:       json.Number(FormatAmount(b.Value)),
+		ScriptPubKey: newScriptJSON(b.ScriptPubKey),
+	})
+}
+
+// UnmarshalJSON Read an output from JSON. The value is taken from the
+// amount in coins when there is no value in base units
+func (b *OutputTx) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		Value        *int64      `json:"value"`
+		Amount       json.Number `json:"amount"`
+		ScriptPubKey scriptJSON  `json:"scriptPubKey"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var out OutputTx
+	switch {
+	case fields.Value != nil:
+		out.Value = *fields.Value
+	case fields.Amount != "":
+		value, err := ParseAmount(fields.Amount.String())
+		if err != nil {
+			return err
+		}
+		out.Value = value
+	default:
+		return fmt.Errorf("output has no value")
+	}
+	var err error
+	if out.ScriptPubKey, err = decodeHex("scriptPubKey", fields.ScriptPubKey.Hex); err != nil {
+		return err
+	}
+	*b = out
+	return nil
+}
+
+type inputTxJSON struct {
+	Coinbase  string          `json:"coinbase,omitempty"`
+	Txid      *chainhash.Hash `json:"txid,omitempty"`
+	Vout      int32           `json:"vout"`
+	ScriptSig *scriptJSON     `json:"scriptSig,omitempty"`
+	Sequence  uint32          `json:"sequence"`
+}
+
+// isNullOutPoint True if the input spends the null outpoint of a coinbase
+func (b *InputTx) isNullOutPoint() bool {
+	tx := Tx{Vin: []InputTx{*b}}
+	return tx.IsCoinBase()
+}
+
+// MarshalJSON The input as JSON. The ScriptSig of a coinbase input is
+// not a script, so it is given as coinbase in hex
+func (b InputTx) MarshalJSON() ([]byte, error) {
+	fields := inputTxJSON{Vout: b.OutInx, Sequence: uint32(b.Sequence)}
+	if b.isNullOutPoint() {
+		fields.Coinbase = hex.EncodeToString(b.ScriptSig)
+	} else {
+		scriptSig := newScriptJSON(b.ScriptSig)
+		fields.Txid = &b.Txid
+		fields.ScriptSig = &scriptSig
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON Read an input from JSON
+func (b *InputTx) UnmarshalJSON(data []byte) error {
+	var fields inputTxJSON
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	in := InputTx{OutInx: fields.Vout, Sequence: int32(fields.Sequence)}
+	var err error
+	if fields.Txid == nil {
+		in.OutInx = -1
+		if in.ScriptSig, err = decodeHex("coinbase", fields.Coinbase); err != nil {
+			return err
+		}
+		*b = in
+		return nil
+	}
+	in.Txid = *fields.Txid
+	if fields.ScriptSig != nil {
+		if in.ScriptSig, err = decodeHex("scriptSig", fields.ScriptSig.Hex); err != nil {
+			return err
+		}
+	}
+	*b = in
+	return nil
+}
+
+type txJSON struct {
+	Txid     *chainhash.Hash `json:"txid,omitempty"`
+	Version  int32           `json:"version"`
+	Size     int             `json:"size,omitempty"`
+	LockTime uint32          `json:"locktime"`
+	Vin      []InputTx       `json:"vin"`
+	Vout     []OutputTx      `json:"vout"`
+}
+
+// MarshalJSON The transaction as JSON with its txid and size
+func (tx Tx) MarshalJSON() ([]byte, error) {
+	hash := tx.Hash()
+	return json.Marshal(txJSON{
+		Txid:     &hash,
+		Version:  tx.Version,
+		Size:     tx.Serialise().Len(),
+		LockTime: uint32(tx.LockTime),
+		Vin:      nonNilInputs(tx.Vin),
+		Vout:     nonNilOutputs(tx.Vout),
+	})
+}
+
+func nonNilInputs(vin []InputTx) []InputTx {
+	if vin == nil {
+		return []InputTx{}
+	}
+	return vin
+}
+
+func nonNilOutputs(vout []OutputTx) []OutputTx {
+	if vout == nil {
+		return []OutputTx{}
+	}
+	return vout
+}
+
+// UnmarshalJSON Read a transaction from JSON
+func (tx *Tx) UnmarshalJSON(data []byte) error {
+	var fields txJSON
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*tx = Tx{
+		Version:  fields.Version,
+		TxInNo:   int64(len(fields.Vin)),
+		TxOutNo:  int64(len(fields.Vout)),
+		Vin:      fields.Vin,
+		Vout:     fields.Vout,
+		LockTime: int32(fields.LockTime),
+	}
+	return nil
+}
+
+type blockHeaderJSON struct {
+	Hash              *chainhash.Hash `json:"hash,omitempty"`
+	Version           int32           `json:"version"`
+	PreviousBlockHash chainhash.Hash  `json:"previousblockhash"`
+	MerkleRoot        chainhash.Hash  `json:"merkleroot"`
+	Time              int64           `json:"time"`
+	Bits              string          `json:"bits"`
+	Nonce             uint32          `json:"nonce"`
+}
+
+// MarshalJSON The header as JSON with the block hash. The
+// DifficultyTarget is given as bits in hex
+func (b BlockHeader) MarshalJSON() ([]byte, error) {
+	hash := b.Hash()
+	return json.Marshal(blockHeaderJSON{
+		Hash:              &hash,
+		Version:           b.Version,
+		PreviousBlockHash: b.PrevBlockHash,
+		MerkleRoot:        b.MerkleRoot,
+		Time:              b.TimeStamp,
+		Bits:              fmt.Sprintf("%08x", uint32(b.DifficultyTarget)),
+		Nonce:             uint32(b.Nonce),
+	})
+}
+
+// UnmarshalJSON Read a header from JSON
+func (b *BlockHeader) UnmarshalJSON(data []byte) error {
+	var fields blockHeaderJSON
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	header := BlockHeader{
+		Version:       fields.Version,
+		PrevBlockHash: fields.PreviousBlockHash,
+		MerkleRoot:    fields.MerkleRoot,
+		TimeStamp:     fields.Time,
+		Nonce:         int32(fields.Nonce),
+	}
+	bits, err := strconv.ParseUint(fields.Bits, 16, 32)
+	if err != nil {
+		return fmt.Errorf("bits: %v", err)
+	}
+	header.DifficultyTarget = int32(bits)
+	*b = header
+	return nil
+}
+
+type blockJSON struct {
+	Hash   *chainhash.Hash `json:"hash,omitempty"`
+	Size   int32           `json:"size"`
+	Header BlockHeader     `json:"header"`
+	Tx     []Tx            `json:"tx"`
+}
+
+// MarshalJSON The block as JSON with its hash
+func (b Block) MarshalJSON() ([]byte, error) {
+	hash := b.Hash()
+	txs := b.Transactions
+	if txs == nil {
+		txs = []Tx{}
+	}
+	return json.Marshal(blockJSON{
+		Hash:   &hash,
+		Size:   b.Size,
+		Header: b.Header,
+		Tx:     txs,
+	})
+}
+
+// UnmarshalJSON Read a block from JSON
+func (b *Block) UnmarshalJSON(data []byte) error {
+	var fields blockJSON
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*b = Block{
+		Size:         fields.Size,
+		Header:       fields.Header,
+		TxCount:      int64(len(fields.Tx)),
+		Transactions: fields.Tx,
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func jsonTestBlock() Block {
+	block := Block{
+		Header:       mockBlockHeader(),
+		Transactions: []Tx{NewCoinBaseTx(7, 3, 5000, createTxOutputBlockTest().ScriptPubKey), createTxBlockTest()},
+	}
+	block.TxCount = int64(len(block.Transactions))
+	block.Size = block.SerSize()
+	return block
+}
+
+func TestBlockJSONRoundTrip(t *testing.T) {
+	block := jsonTestBlock()
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var decoded Block
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !bytes.Equal(decoded.Ser().Bytes(), block.Ser().Bytes()) {
+		t.Errorf("Block did not survive JSON: %s", data)
+	}
+	if decoded.TxCount != 2 || decoded.Transactions[1].TxInNo != 1 || decoded.Transactions[1].TxOutNo != 1 {
+		t.Errorf("Expected the counts to be filled in")
+	}
+}
+
+func TestTxJSONFields(t *testing.T) {
+	tx := createTxBlockTest()
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	hash := tx.Hash()
+	if fields["txid"] != hash.String() {
+		t.Errorf("Expected txid %s, got %v", hash, fields["txid"])
+	}
+	if fields["size"] != float64(tx.Serialise().Len()) {
+		t.Errorf("Expected size %d, got %v", tx.Serialise().Len(), fields["size"])
+	}
+
+	out := fields["vout"].([]interface{})[0].(map[string]interface{})
+	if out["value"] != float64(20000) {
+		t.Errorf("Expected value 20000, got %v", out["value"])
+	}
+	if !strings.Contains(string(data), `"amount":0.00020000`) {
+		t.Errorf("Expected the amount in coins, got %s", data)
+	}
+	asm := out["scriptPubKey"].(map[string]interface{})["asm"].(string)
+	if !strings.HasPrefix(asm, "OP_DUP OP_HASH_160 PUB_KEY_V1[") || !strings.HasSuffix(asm, "] OP_EQUALVERIFY OP_CHECKSIG") {
+		t.Errorf("Unexpected scriptPubKey asm %s", asm)
+	}
+
+	in := fields["vin"].([]interface{})[0].(map[string]interface{})
+	if in["sequence"] != float64(20) || in["vout"] != float64(1) {
+		t.Errorf("Unexpected input %v", in)
+	}
+}
+
+func TestCoinbaseInputJSON(t *testing.T) {
+	coinbase := NewCoinBaseTx(7, 3, 5000, []byte{0xff})
+	data, err := json.Marshal(coinbase.Vin[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := `{"coinbase":"` + hex.EncodeToString(coinbase.Vin[0].ScriptSig) + `","vout":-1,"sequence":4294967295}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	// A script which does not disassemble is still given in hex
+	data, _ = json.Marshal(coinbase.Vout[0])
+	if string(data) != `{"value":5000,"amount":0.00005000,"scriptPubKey":{"asm":"[error]","hex":"ff"}}` {
+		t.Errorf("Unexpected output %s", data)
+	}
+}
+
+func TestOutputJSONAmount(t *testing.T) {
+	var out OutputTx
+	if err := json.Unmarshal([]byte(`{"amount":1.5,"scriptPubKey":{"hex":"00"}}`), &out); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if out.Value != 150000000 {
+		t.Errorf("Expected 150000000 base units, got %d", out.Value)
+	}
+
+	bad := []string{
+		`{"amount":0.000000001,"scriptPubKey":{"hex":"00"}}`,
+		`{"scriptPubKey":{"hex":"00"}}`,
+		`{"value":1,"scriptPubKey":{"hex":"0"}}`,
+	}
+	for _, data := range bad {
+		if err := json.Unmarshal([]byte(data), &out); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+}
+
+func TestHeaderJSONRejectsShortHash(t *testing.T) {
+	var header BlockHeader
+	data := `{"version":1,"previousblockhash":"00","merkleroot":"` + strings.Repeat("00", 32) + `","time":1,"bits":"207fffff","nonce":0}`
+	if err := json.Unmarshal([]byte(data), &header); err == nil {
+		t.Errorf("Expected an error for a short previousblockhash")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := map[int64]string{
+		0:                    "0.00000000",
+		1:                    "0.00000001",
+		150000000:            "1.50000000",
+		-2:                   "-0.00000002",
+		MaxMoney:             "21000000.00000000",
+		BaseUnitsPerCoin * 3: "3.00000000",
+	}
+	for value, expected := range tests {
+		if s := FormatAmount(value); s != expected {
+			t.Errorf("Expected %s for %d, got %s", expected, value, s)
+		}
+		if parsed, err := ParseAmount(expected); err != nil || parsed != value {
+			t.Errorf("Expected %s to parse to %d, got %d %v", expected, value, parsed, err)
+		}
+	}
+}
+
+func TestParseAmountInvalid(t *testing.T) {
+	for _, s := range []string{"", "1.+5", "1.-5", "+1", "--1", "1.5x", "1.000000001", "21000001"} {
+		if value, err := ParseAmount(s); err == nil {
+			t.Errorf("Expected an error for %q, got %d", s, value)
+		}
+	}
+	if value, err := ParseAmount("1.5"); err != nil || value != 150000000 {
+		t.Errorf("Expected 1.5 to parse to 150000000, got %d %v", value, err)
+	}
+}
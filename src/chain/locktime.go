@@ -0,0 +1,127 @@
+package chain
+
+import (
+	"fmt"
+)
+
+/*
+  Tx.LockTime and InputTx.Sequence are read as unsigned 32 bit values.
+
+  A LockTime below LockTimeThreshold is the block height the transaction
+  is locked until, from LockTimeThreshold up it is a unix time compared
+  against the median time past. The LockTime is ignored when every input
+  has the final Sequence MaxTxInSequenceNum.
+
+  From TxVersionSequenceLock on, an input Sequence without the
+  SequenceLockTimeDisabled flag is a relative lock time. The low 16 bits
+  are the number of blocks after the spent output was mined, or with
+  SequenceLockTimeIsSeconds set, the number of 512 second units after
+  the median time past of the block before it.
+*/
+
+const (
+	// LockTimeThreshold LockTime values below this are block heights,
+	// values from it up are unix times
+	LockTimeThreshold = 500000000
+
+	// MaxTxInSequenceNum The Sequence of a final input
+	MaxTxInSequenceNum uint32 = 0xffffffff
+
+	// TxVersionSequenceLock The first transaction version whose input
+	// Sequence can be a relative lock time
+	TxVersionSequenceLock = 2
+
+	// SequenceLockTimeDisabled Sequence flag which turns off the
+	// relative lock time of an input
+	SequenceLockTimeDisabled uint32 = 1 << 31
+
+	// SequenceLockTimeIsSeconds Sequence flag saying the relative lock
+	// time is in units of 512 seconds instead of blocks
+	SequenceLockTimeIsSeconds uint32 = 1 << 22
+
+	// SequenceLockTimeMask The bits of Sequence holding the relative
+	// lock time
+	SequenceLockTimeMask uint32 = 0x0000ffff
+
+	// SequenceLockTimeGranularity Relative lock times in seconds are
+	// shifted left by this, making a unit 512 seconds
+	SequenceLockTimeGranularity = 9
+)
+
+// IsFinal True if the input has the final Sequence
+func (b *InputTx) IsFinal() bool {
+	return uint32(b.Sequence) == MaxTxInSequenceNum
+}
+
+// IsFinal True if the LockTime of tx allows it in a block at height
+// whose median time past is medianTime
+func (tx *Tx) IsFinal(height int32, medianTime int64) bool {
+	lockTime := int64(uint32(tx.LockTime))
+	if lockTime == 0 {
+		return true
+	}
+
+	limit := int64(height)
+	if lockTime >= LockTimeThreshold {
+		limit = medianTime
+	}
+	if lockTime < limit {
+		return true
+	}
+
+	for i := range tx.Vin {
+		if !tx.Vin[i].IsFinal() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckLockTime Check the transaction LockTime has reached lockTime.
+// Used by OP_CHECKLOCKTIMEVERIFY
+func (c *SigContext) CheckLockTime(lockTime int64) error {
+	txLockTime := int64(uint32(c.Tx.LockTime))
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return fmt.Errorf("lock time %d and transaction LockTime %d are not both heights or both times",
+			lockTime, txLockTime)
+	}
+	if lockTime > txLockTime {
+		return fmt.Errorf("lock time %d is after the transaction LockTime %d", lockTime, txLockTime)
+	}
+
+	// A final input makes the transaction LockTime meaningless
+	if c.Tx.Vin[c.InputIndex].IsFinal() {
+		return fmt.Errorf("input %d is final so the LockTime is not enforced", c.InputIndex)
+	}
+	return nil
+}
+
+// CheckSequence Check the relative lock time of the input has reached
+// sequence. Used by OP_CHECKSEQUENCEVERIFY
+func (c *SigContext) CheckSequence(sequence int64) error {
+	if sequence&int64(SequenceLockTimeDisabled) != 0 {
+		return nil
+	}
+
+	if c.Tx.Version < TxVersionSequenceLock {
+		return fmt.Errorf("transaction version %d does not support relative lock times", c.Tx.Version)
+	}
+
+	txSequence := int64(uint32(c.Tx.Vin[c.InputIndex].Sequence))
+	if txSequence&int64(SequenceLockTimeDisabled) != 0 {
+		return fmt.Errorf("input %d has relative lock times disabled", c.InputIndex)
+	}
+
+	mask := int64(SequenceLockTimeIsSeconds | SequenceLockTimeMask)
+	sequence &= mask
+	txSequence &= mask
+	isSeconds := int64(SequenceLockTimeIsSeconds)
+	if (sequence&isSeconds != 0) != (txSequence&isSeconds != 0) {
+		return fmt.Errorf("relative lock time 0x%x and input Sequence 0x%x are not both blocks or both times",
+			sequence, txSequence)
+	}
+	if sequence > txSequence {
+		return fmt.Errorf("relative lock time 0x%x is after the input Sequence 0x%x", sequence, txSequence)
+	}
+	return nil
+}
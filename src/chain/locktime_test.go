@@ -0,0 +1,91 @@
+package chain
+
+import (
+	"testing"
+)
+
+func lockTimeTestTx(lockTime int32, sequence int32) Tx {
+	tx := createTxBlockTest()
+	tx.Version = TxVersionSequenceLock
+	tx.LockTime = lockTime
+	tx.Vin[0].Sequence = sequence
+	return tx
+}
+
+func TestTxIsFinal(t *testing.T) {
+	tests := []struct {
+		name       string
+		lockTime   int32
+		sequence   int32
+		height     int32
+		medianTime int64
+		final      bool
+	}{
+		{"no lock time", 0, 0, 1, 0, true},
+		{"height reached", 100, 0, 101, 0, true},
+		{"height not reached", 100, 0, 100, 0, false},
+		{"time reached", LockTimeThreshold + 10, 0, 1, LockTimeThreshold + 11, true},
+		{"time not reached", LockTimeThreshold + 10, 0, 1, LockTimeThreshold + 10, false},
+		{"time is not compared to height", LockTimeThreshold + 10, 0, LockTimeThreshold + 11, 0, false},
+		{"final input", 100, -1, 1, 0, true},
+	}
+	for _, test := range tests {
+		tx := lockTimeTestTx(test.lockTime, test.sequence)
+		if final := tx.IsFinal(test.height, test.medianTime); final != test.final {
+			t.Errorf("%s: expected IsFinal %t, got %t", test.name, test.final, final)
+		}
+	}
+}
+
+func TestCheckLockTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockTime int64
+		txLock   int32
+		sequence int32
+		ok       bool
+	}{
+		{"height reached", 100, 100, 0, true},
+		{"height not reached", 101, 100, 0, false},
+		{"time reached", LockTimeThreshold, LockTimeThreshold + 5, 0, true},
+		{"time not reached", LockTimeThreshold + 6, LockTimeThreshold + 5, 0, false},
+		{"height against time", 100, LockTimeThreshold, 0, false},
+		{"final input", 100, 100, -1, false},
+	}
+	for _, test := range tests {
+		tx := lockTimeTestTx(test.txLock, test.sequence)
+		ctx := SigContext{Tx: &tx, InputIndex: 0}
+		if err := ctx.CheckLockTime(test.lockTime); (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %t, got %v", test.name, test.ok, err)
+		}
+	}
+}
+
+func TestCheckSequence(t *testing.T) {
+	seconds := int64(SequenceLockTimeIsSeconds)
+	disabled := int64(SequenceLockTimeDisabled)
+	tests := []struct {
+		name     string
+		sequence int64
+		txSeq    int32
+		version  int32
+		ok       bool
+	}{
+		{"blocks reached", 10, 10, TxVersionSequenceLock, true},
+		{"blocks not reached", 11, 10, TxVersionSequenceLock, false},
+		{"time reached", seconds | 3, int32(seconds | 4), TxVersionSequenceLock, true},
+		{"time not reached", seconds | 5, int32(seconds | 4), TxVersionSequenceLock, false},
+		{"blocks against time", 3, int32(seconds | 4), TxVersionSequenceLock, false},
+		{"disabled in script", disabled | 100, 0, 1, true},
+		{"disabled in input", 1, -1, TxVersionSequenceLock, false},
+		{"old version", 1, 10, 1, false},
+	}
+	for _, test := range tests {
+		tx := lockTimeTestTx(0, test.txSeq)
+		tx.Version = test.version
+		ctx := SigContext{Tx: &tx, InputIndex: 0}
+		if err := ctx.CheckSequence(test.sequence); (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %t, got %v", test.name, test.ok, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"spchain/chainhash"
+)
+
+// maxMerkleProofDepth The deepest branch a proof may have. Enough for
+// more transactions than could ever fit in a block
+const maxMerkleProofDepth = 32
+
+// MerkleProof Proves a transaction is in a block using only the
+// block header. The proof is the branch of sibling hashes from the
+// transaction up to the merkle root
+type MerkleProof struct {
+	// Index The position of the transaction in the block. Bit i is set
+	// when the node at level i of the branch is a right child
+	Index uint32
+	// Branch The sibling at each level of the tree, leaf first
+	Branch []chainhash.Hash
+}
+
+// BuildMerkleProof The proof that the transaction at txIndex is in block
+func BuildMerkleProof(block *Block, txIndex int) (MerkleProof, error) {
+	if txIndex < 0 || txIndex >= len(block.Transactions) {
+		return MerkleProof{}, fmt.Errorf(
+			"transaction index %d out of range for block with %d transactions",
+			txIndex, len(block.Transactions),
+		)
+	}
+
+	level := []chainhash.Hash{}
+	for _, tx := range block.Transactions {
+		level = append(level, tx.Hash())
+	}
+
+	proof := MerkleProof{Index: uint32(txIndex), Branch: []chainhash.Hash{}}
+	position := txIndex
+	// Mirrors CalcMerkle, a lone transaction is still paired
+	for len(level) > 1 || len(proof.Branch) == 0 {
+		if len(level)%2 != 0 {
+			level = append(level, chainhash.Hash{})
+		}
+		proof.Branch = append(proof.Branch, level[position^1])
+
+		next := []chainhash.Hash{}
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, merkleParent(level[i], level[i+1]))
+		}
+		level = next
+		position /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof True if proof shows txHash is committed to by merkleRoot
+func VerifyMerkleProof(txHash chainhash.Hash, proof *MerkleProof, merkleRoot chainhash.Hash) bool {
+	depth := len(proof.Branch)
+	if depth == 0 || depth > maxMerkleProofDepth {
+		return false
+	}
+	// Bits above the depth of the tree would give one proof many indexes
+	if depth < 32 && proof.Index>>uint(depth) != 0 {
+		return false
+	}
+
+	hash := txHash
+	for level, sibling := range proof.Branch {
+		if proof.Index&(1<<uint(level)) != 0 {
+			hash = merkleParent(sibling, hash)
+		} else {
+			hash = merkleParent(hash, sibling)
+		}
+	}
+	return hash == merkleRoot
+}
+
+// Ser Serialise the MerkleProof
+func (p *MerkleProof) Ser() *bytes.Buffer {
+	var ret bytes.Buffer
+	binary.Write(&ret, littleEndian, p.Index)
+	binary.Write(&ret, littleEndian, byte(len(p.Branch)))
+	for _, hash := range p.Branch {
+		binary.Write(&ret, littleEndian, hash)
+	}
+	return &ret
+}
+
+// DeserialiseMerkleProof Deserialise bytes to a MerkleProof
+func DeserialiseMerkleProof(b *bytes.Buffer) (MerkleProof, error) {
+	var ret MerkleProof
+	if err := binary.Read(b, littleEndian, &ret.Index); err != nil {
+		return MerkleProof{}, err
+	}
+	var depth byte
+	if err := binary.Read(b, littleEndian, &depth); err != nil {
+		return MerkleProof{}, err
+	}
+	if depth > maxMerkleProofDepth {
+		return MerkleProof{}, fmt.Errorf("merkle proof depth %d is more than %d", depth, maxMerkleProofDepth)
+	}
+	ret.Branch = make([]chainhash.Hash, depth)
+	for i := range ret.Branch {
+		if err := binary.Read(b, littleEndian, &ret.Branch[i]); err != nil {
+			return MerkleProof{}, err
+		}
+	}
+	return ret, nil
+}
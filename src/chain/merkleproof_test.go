@@ -0,0 +1,92 @@
+package chain
+
+import (
+	"bytes"
+	"spchain/chainhash"
+	"testing"
+)
+
+func merkleProofTestBlock(txCount int) Block {
+	txs := []Tx{}
+	for i := 0; i < txCount; i++ {
+		tx := utxoTestCoinbase(byte(i))
+		txs = append(txs, tx)
+	}
+	block := Block{Header: mockBlockHeader(), TxCount: int64(txCount), Transactions: txs}
+	root := block.CalcMerkle().Root
+	block.Header.MerkleRoot = root
+	return block
+}
+
+func TestMerkleProofEveryTransaction(t *testing.T) {
+	for txCount := 1; txCount <= 9; txCount++ {
+		block := merkleProofTestBlock(txCount)
+		for i := range block.Transactions {
+			proof, err := BuildMerkleProof(&block, i)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if !VerifyMerkleProof(block.Transactions[i].Hash(), &proof, block.Header.MerkleRoot) {
+				t.Errorf("Proof for transaction %d of %d did not verify", i, txCount)
+			}
+
+			// The proof is for one position only
+			if txCount > 1 {
+				other := block.Transactions[(i+1)%txCount].Hash()
+				if VerifyMerkleProof(other, &proof, block.Header.MerkleRoot) {
+					t.Errorf("Proof for transaction %d of %d verified another transaction", i, txCount)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkleProofTampered(t *testing.T) {
+	block := merkleProofTestBlock(5)
+	txHash := block.Transactions[2].Hash()
+	proof, _ := BuildMerkleProof(&block, 2)
+
+	badIndex := proof
+	badIndex.Index = 3
+	if VerifyMerkleProof(txHash, &badIndex, block.Header.MerkleRoot) {
+		t.Errorf("Expected a wrong index to fail")
+	}
+
+	highBits := proof
+	highBits.Index |= 1 << 20
+	if VerifyMerkleProof(txHash, &highBits, block.Header.MerkleRoot) {
+		t.Errorf("Expected index bits above the branch depth to fail")
+	}
+
+	badBranch := MerkleProof{Index: proof.Index, Branch: append([]chainhash.Hash{}, proof.Branch...)}
+	badBranch.Branch[1][0] ^= 0xff
+	if VerifyMerkleProof(txHash, &badBranch, block.Header.MerkleRoot) {
+		t.Errorf("Expected a tampered branch to fail")
+	}
+
+	if _, err := BuildMerkleProof(&block, 5); err == nil {
+		t.Errorf("Expected an error for an index out of range")
+	}
+}
+
+func TestMerkleProofSerialisation(t *testing.T) {
+	block := merkleProofTestBlock(6)
+	proof, _ := BuildMerkleProof(&block, 4)
+
+	ser := proof.Ser()
+	if ser.Len() != 5+32*len(proof.Branch) {
+		t.Errorf("Unexpected serialised size %d", ser.Len())
+	}
+	dser, err := DeserialiseMerkleProof(bytes.NewBuffer(ser.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !VerifyMerkleProof(block.Transactions[4].Hash(), &dser, block.Header.MerkleRoot) {
+		t.Errorf("Deserialised proof did not verify")
+	}
+
+	truncated := bytes.NewBuffer(ser.Bytes()[:ser.Len()-1])
+	if _, err := DeserialiseMerkleProof(truncated); err == nil {
+		t.Errorf("Expected an error deserialising a truncated proof")
+	}
+}
@@ -0,0 +1,137 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"spchain/varint"
+)
+
+/*
+  Everything read from a peer or from disk goes through reader.
+  Nothing it reads is trusted. Counts and lengths are checked against
+  the bytes left before anything is read or allocated for them.
+*/
+
+const (
+	// minInputSize The smallest serialised InputTx. Txid, OutInx,
+	// an empty ScriptSig and Sequence
+	minInputSize = 32 + 4 + 1 + 4
+
+	// minOutputSize The smallest serialised OutputTx. Value and
+	// an empty ScriptPubKey
+	minOutputSize = 8 + 1
+
+	// minTxSize The smallest serialised Tx. Version, two empty
+	// counts and LockTime
+	minTxSize = 4 + 1 + 1 + 4
+)
+
+// DeserialiseError Bytes which do not decode to the expected type
+type DeserialiseError struct {
+	Msg string
+}
+
+func (e *DeserialiseError) Error() string {
+	return e.Msg
+}
+
+// reader Reads fields from a buffer keeping the first error.
+// After an error every read is skipped so a run of reads can be
+// checked once at the end
+type reader struct {
+	buff *bytes.Buffer
+	err  error
+}
+
+func newReader(buff *bytes.Buffer) *reader {
+	return &reader{buff: buff}
+}
+
+// fail Record an error if there isn't one already
+func (r *reader) fail(format string, a ...interface{}) {
+	if r.err == nil {
+		r.err = &DeserialiseError{fmt.Sprintf(format, a...)}
+	}
+}
+
+// read Read a fixed size field
+func (r *reader) read(field string, data interface{}) {
+	if r.err != nil {
+		return
+	}
+	if err := binary.Read(r.buff, littleEndian, data); err != nil {
+		r.fail("Unable to read %s: %s", field, err)
+	}
+}
+
+// readCount Read a count written by writeCount. Each of the items
+// counted is at least minItemSize bytes so the count can't be more
+// than the bytes left allow
+func (r *reader) readCount(field string, compact bool, minItemSize int) int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	var n int64
+	if compact {
+		v, err := varint.Read(r.buff)
+		if err != nil {
+			r.fail("Unable to read %s: %s", field, err)
+			return 0
+		}
+		if v > uint64(r.buff.Len()) {
+			r.fail("%s %d is more than the %d bytes left", field, v, r.buff.Len())
+			return 0
+		}
+		n = int64(v)
+	} else {
+		r.read(field, &n)
+	}
+
+	if n < 0 || n > int64(r.buff.Len()/minItemSize) {
+		r.fail("%s %d is not possible with %d bytes left", field, n, r.buff.Len())
+		return 0
+	}
+	return n
+}
+
+// readVarBytes Read bytes written by writeVarBytes
+func (r *reader) readVarBytes(field string, compact bool) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	var lenToRead uint64
+	if compact {
+		v, err := varint.Read(r.buff)
+		if err != nil {
+			r.fail("Unable to read the length of %s: %s", field, err)
+			return nil
+		}
+		lenToRead = v
+	} else {
+		var v byte
+		r.read(field+" length", &v)
+		if r.err != nil {
+			return nil
+		}
+		lenToRead = uint64(v)
+	}
+	if lenToRead > uint64(r.buff.Len()) {
+		r.fail("%s length %d is more than the %d bytes left", field, lenToRead, r.buff.Len())
+		return nil
+	}
+
+	var ret []byte
+	return append(ret, r.buff.Next(int(lenToRead))...)
+}
+
+// end The error of the reads so far, or an error if any bytes
+// are left over after what
+func (r *reader) end(what string) error {
+	if r.err == nil && r.buff.Len() > 0 {
+		r.fail("%d unexpected bytes after %s", r.buff.Len(), what)
+	}
+	return r.err
+}
@@ -0,0 +1,87 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func expectDeserialiseError(t *testing.T, name string, err error) {
+	if _, ok := err.(*DeserialiseError); !ok {
+		t.Errorf("%s: expected DeserialiseError, got %v", name, err)
+	}
+}
+
+func TestDeserialiseTruncated(t *testing.T) {
+	block := Block{Header: mockBlockHeader(), TxCount: 1, Transactions: []Tx{createTxBlockTest()}}
+	ser := block.Ser().Bytes()
+
+	// Every prefix of the block is missing something
+	for i := 0; i < len(ser); i++ {
+		_, err := DeserialiseBlock(bytes.NewBuffer(ser[:i]))
+		if err == nil {
+			t.Fatalf("Expected an error deserialising %d of %d bytes", i, len(ser))
+		}
+		expectDeserialiseError(t, "truncated block", err)
+	}
+
+	tx := createTxBlockTest()
+	txSer := tx.Serialise().Bytes()
+	_, err := DeserialiseTx(bytes.NewBuffer(txSer[:len(txSer)-1]))
+	expectDeserialiseError(t, "truncated tx", err)
+
+	header := mockBlockHeader()
+	headerSer := header.Ser().Bytes()
+	_, err = DeserialiseBlockHeader(bytes.NewBuffer(headerSer[:10]))
+	expectDeserialiseError(t, "truncated header", err)
+}
+
+func TestDeserialiseTrailingBytes(t *testing.T) {
+	tx := createTxBlockTest()
+	ser := append(tx.Serialise().Bytes(), 0x00)
+	_, err := DeserialiseTx(bytes.NewBuffer(ser))
+	expectDeserialiseError(t, "tx", err)
+
+	block := Block{Header: mockBlockHeader(), TxCount: 1, Transactions: []Tx{tx}}
+	ser = append(block.Ser().Bytes(), 0x01, 0x02)
+	_, err = DeserialiseBlock(bytes.NewBuffer(ser))
+	expectDeserialiseError(t, "block", err)
+
+	output := createTxOutput()
+	ser = append(output.Ser().Bytes(), 0x00)
+	_, err = DeserialiseOutputTx(bytes.NewBuffer(ser))
+	expectDeserialiseError(t, "output", err)
+}
+
+func TestDeserialiseAbsurdCounts(t *testing.T) {
+	// A block claiming 2^60 transactions
+	var buff bytes.Buffer
+	binary.Write(&buff, littleEndian, int32(100))
+	header := mockBlockHeader()
+	header.Version = 1
+	buff.Write(header.Ser().Bytes())
+	binary.Write(&buff, littleEndian, int64(1)<<60)
+	_, err := DeserialiseBlock(&buff)
+	expectDeserialiseError(t, "TxCount", err)
+
+	// A version 1 transaction with a negative input count
+	buff.Reset()
+	binary.Write(&buff, littleEndian, int32(1))
+	binary.Write(&buff, littleEndian, int64(-1))
+	_, err = DeserialiseTx(&buff)
+	expectDeserialiseError(t, "negative TxInNo", err)
+
+	// A CompactSize transaction claiming 2^32 inputs
+	buff.Reset()
+	binary.Write(&buff, littleEndian, int32(TxVersionCompactSize))
+	buff.Write([]byte{0xff, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00})
+	_, err = DeserialiseTx(&buff)
+	expectDeserialiseError(t, "TxInNo", err)
+
+	// An output whose script is longer than the bytes left
+	buff.Reset()
+	binary.Write(&buff, littleEndian, int64(10))
+	buff.Write([]byte{0xfe, 0x00, 0x00, 0x00, 0x10})
+	_, err = DeserialiseOutputTx(&buff)
+	expectDeserialiseError(t, "ScriptPubKey length", err)
+}
@@ -0,0 +1,174 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// SigHashType The parts of a transaction a signature commits to.
+// The type is the last byte of a signature
+type SigHashType byte
+
+const (
+	// SigHashAll Sign every input and every output
+	SigHashAll SigHashType = 0x01
+
+	// SigHashNone Sign every input and none of the outputs.
+	// Anyone can change where the coins go
+	SigHashNone SigHashType = 0x02
+
+	// SigHashSingle Sign every input and only the output with the
+	// same index as the input being signed
+	SigHashSingle SigHashType = 0x03
+
+	// SigHashAnyOneCanPay Combined with one of the other types to sign
+	// only the input being signed. Anyone can add inputs
+	SigHashAnyOneCanPay SigHashType = 0x80
+
+	// sigHashBaseMask Removes SigHashAnyOneCanPay from a type
+	sigHashBaseMask SigHashType = 0x1f
+)
+
+// Base The type without SigHashAnyOneCanPay
+func (t SigHashType) Base() SigHashType {
+	return t & sigHashBaseMask
+}
+
+// AnyOneCanPay True if the type includes SigHashAnyOneCanPay
+func (t SigHashType) AnyOneCanPay() bool {
+	return t&SigHashAnyOneCanPay != 0
+}
+
+// checkSigHashType Only ALL, NONE and SINGLE optionally with
+// ANYONECANPAY are valid
+func checkSigHashType(hashType SigHashType) error {
+	if hashType&^(sigHashBaseMask|SigHashAnyOneCanPay) != 0 {
+		return fmt.Errorf("unknown sighash type 0x%02x", byte(hashType))
+	}
+	switch hashType.Base() {
+	case SigHashAll, SigHashNone, SigHashSingle:
+		return nil
+	}
+	return fmt.Errorf("unknown sighash type 0x%02x", byte(hashType))
+}
+
+// SerialiseForSign Serialise the transaction as signed by the signature of
+// hashType on input inputIndex, which spends prevOut. ScriptSigs are
+// always left out, a signature can't sign itself. In their place the
+// input being signed has the ScriptPubKey of prevOut, and the value of
+// prevOut and inputIndex are appended, so a signature is only valid for
+// the one input it was made for.
+//
+// SigHashNone leaves out the outputs and the Sequence of the other inputs
+// so they can be changed. SigHashSingle keeps only the output at
+// inputIndex, the outputs before it are blanked to a Value of -1.
+// SigHashAnyOneCanPay keeps only the input being signed.
+// The type is appended so a signature can't be reused as another type
+func (tx *Tx) SerialiseForSign(inputIndex int, prevOut *OutputTx, hashType SigHashType) (*bytes.Buffer, error) {
+	if err := checkSigHashType(hashType); err != nil {
+		return nil, err
+	}
+	if inputIndex < 0 || inputIndex >= len(tx.Vin) {
+		return nil, fmt.Errorf("input %d out of range for transaction with %d inputs", inputIndex, len(tx.Vin))
+	}
+	if prevOut == nil {
+		return nil, fmt.Errorf("no spent output for input %d", inputIndex)
+	}
+
+	var inputs bytes.Buffer
+	inputCount := 0
+	for i, in := range tx.Vin {
+		if hashType.AnyOneCanPay() && i != inputIndex {
+			continue
+		}
+		signed := InputTx{Txid: in.Txid, OutInx: in.OutInx, Sequence: in.Sequence}
+		scriptCode := []byte{}
+		if i == inputIndex {
+			scriptCode = prevOut.ScriptPubKey
+		} else if hashType.Base() == SigHashNone || hashType.Base() == SigHashSingle {
+			signed.Sequence = 0
+		}
+		inputs.Write(signed.SerSigning(scriptCode, tx.compactSize()))
+		inputCount++
+	}
+
+	outputs := []OutputTx{}
+	switch hashType.Base() {
+	case SigHashAll:
+		outputs = tx.Vout
+	case SigHashSingle:
+		if inputIndex >= len(tx.Vout) {
+			return nil, fmt.Errorf("SIGHASH_SINGLE input %d has no matching output", inputIndex)
+		}
+		for i := 0; i < inputIndex; i++ {
+			outputs = append(outputs, OutputTx{Value: -1})
+		}
+		outputs = append(outputs, tx.Vout[inputIndex])
+	}
+
+	var buffer bytes.Buffer
+	binary.Write(&buffer, littleEndian, tx.Version)
+	writeCount(&buffer, int64(inputCount), tx.compactSize())
+	buffer.Write(inputs.Bytes())
+	writeCount(&buffer, int64(len(outputs)), tx.compactSize())
+	for _, output := range outputs {
+		binary.Write(&buffer, littleEndian, output.ser(tx.compactSize()).Bytes())
+	}
+	binary.Write(&buffer, littleEndian, tx.LockTime)
+	binary.Write(&buffer, littleEndian, prevOut.Value)
+	binary.Write(&buffer, littleEndian, int32(inputIndex))
+	binary.Write(&buffer, littleEndian, uint32(hashType))
+	return &buffer, nil
+}
+
+// SigHash The 32 byte digest a signature of hashType on input inputIndex
+// signs, the double SHA256 of SerialiseForSign
+func (tx *Tx) SigHash(inputIndex int, prevOut *OutputTx, hashType SigHashType) ([32]byte, error) {
+	ser, err := tx.SerialiseForSign(inputIndex, prevOut, hashType)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	sha1 := sha256.Sum256(ser.Bytes())
+	return sha256.Sum256(sha1[:]), nil
+}
+
+// SignInput Sign input index, which spends prevOut, with SigHashAll.
+// The signature is returned with the type appended, ready to go in
+// a SIG operand
+func (tx *Tx) SignInput(index int, pKey *btcec.PrivateKey, prevOut *OutputTx) ([]byte, error) {
+	return tx.SignInputWithType(index, pKey, prevOut, SigHashAll)
+}
+
+// SignInputWithType Sign input index, which spends prevOut, with hashType
+func (tx *Tx) SignInputWithType(index int, pKey *btcec.PrivateKey, prevOut *OutputTx, hashType SigHashType) ([]byte, error) {
+	hash, err := tx.SigHash(index, prevOut, hashType)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := pKey.Sign(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	return append(sig.Serialize(), byte(hashType)), nil
+}
+
+// SigContext The input of a transaction whose scripts are being run.
+// Implements script.ScriptContext
+type SigContext struct {
+	Tx         *Tx
+	InputIndex int
+	// PrevOut The output the input spends
+	PrevOut *OutputTx
+}
+
+// SigHash The digest a signature of hashType on the input signs
+func (c *SigContext) SigHash(hashType byte) ([]byte, error) {
+	hash, err := c.Tx.SigHash(c.InputIndex, c.PrevOut, SigHashType(hashType))
+	if err != nil {
+		return nil, err
+	}
+	return hash[:], nil
+}
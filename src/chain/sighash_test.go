@@ -0,0 +1,148 @@
+package chain
+
+import (
+	"bytes"
+	"github.com/btcsuite/btcd/btcec"
+	"spchain/key"
+	"testing"
+)
+
+func sigHashTestTx() Tx {
+	tx := createTxBlockTest()
+	second := createTxInputBlockTestNoSig()
+	second.OutInx = 2
+	tx.Vin = append(tx.Vin, second)
+	tx.TxInNo = 2
+	tx.Vout = append(tx.Vout, OutputTx{Value: 50, ScriptPubKey: []byte{0x09}})
+	tx.TxOutNo = 2
+	return tx
+}
+
+func serialiseForSign(t *testing.T, tx *Tx, inputIndex int, hashType SigHashType) []byte {
+	prevOut := createTxOutputBlockTest()
+	ser, err := tx.SerialiseForSign(inputIndex, &prevOut, hashType)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return ser.Bytes()
+}
+
+func TestSerialiseForSignCommitsTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(tx *Tx)
+		hashType SigHashType
+		changes  bool
+	}{
+		{"ALL output", func(tx *Tx) { tx.Vout[1].Value++ }, SigHashAll, true},
+		{"ALL other input", func(tx *Tx) { tx.Vin[1].OutInx++ }, SigHashAll, true},
+		{"ALL own ScriptSig", func(tx *Tx) { tx.Vin[0].ScriptSig = []byte{1} }, SigHashAll, false},
+		{"NONE output", func(tx *Tx) { tx.Vout[0].Value++ }, SigHashNone, false},
+		{"NONE other sequence", func(tx *Tx) { tx.Vin[1].Sequence++ }, SigHashNone, false},
+		{"NONE own sequence", func(tx *Tx) { tx.Vin[0].Sequence++ }, SigHashNone, true},
+		{"NONE other input", func(tx *Tx) { tx.Vin[1].OutInx++ }, SigHashNone, true},
+		{"SINGLE matching output", func(tx *Tx) { tx.Vout[0].Value++ }, SigHashSingle, true},
+		{"SINGLE other output", func(tx *Tx) { tx.Vout[1].Value++ }, SigHashSingle, false},
+		{"SINGLE other sequence", func(tx *Tx) { tx.Vin[1].Sequence++ }, SigHashSingle, false},
+		{"ANYONECANPAY other input", func(tx *Tx) { tx.Vin[1].OutInx++ }, SigHashAll | SigHashAnyOneCanPay, false},
+		{"ANYONECANPAY added input", func(tx *Tx) {
+			tx.Vin = append(tx.Vin, createTxInputBlockTestNoSig())
+			tx.TxInNo++
+		}, SigHashAll | SigHashAnyOneCanPay, false},
+		{"ANYONECANPAY output", func(tx *Tx) { tx.Vout[1].Value++ }, SigHashAll | SigHashAnyOneCanPay, true},
+	}
+
+	for _, test := range tests {
+		tx := sigHashTestTx()
+		before := serialiseForSign(t, &tx, 0, test.hashType)
+		test.modify(&tx)
+		after := serialiseForSign(t, &tx, 0, test.hashType)
+		if changes := !bytes.Equal(before, after); changes != test.changes {
+			t.Errorf("%s: expected change %v, got %v", test.name, test.changes, changes)
+		}
+	}
+}
+
+func TestSerialiseForSignTypes(t *testing.T) {
+	tx := sigHashTestTx()
+	all := serialiseForSign(t, &tx, 0, SigHashAll)
+	none := serialiseForSign(t, &tx, 0, SigHashNone)
+	prevOut := createTxOutputBlockTest()
+	if bytes.Equal(all, none) {
+		t.Errorf("Expected the sighash type to be part of the message")
+	}
+
+	for _, hashType := range []SigHashType{0x00, 0x04, 0x41, 0xff} {
+		if _, err := tx.SerialiseForSign(0, &prevOut, hashType); err == nil {
+			t.Errorf("Expected an error for sighash type 0x%02x", byte(hashType))
+		}
+	}
+
+	if _, err := tx.SerialiseForSign(2, &prevOut, SigHashAll); err == nil {
+		t.Errorf("Expected an error for an input out of range")
+	}
+
+	tx.Vout = tx.Vout[:1]
+	tx.TxOutNo = 1
+	if _, err := tx.SerialiseForSign(1, &prevOut, SigHashSingle); err == nil {
+		t.Errorf("Expected an error for SIGHASH_SINGLE without a matching output")
+	}
+}
+
+func TestSigHashPerInput(t *testing.T) {
+	tx := sigHashTestTx()
+	prevOut := createTxOutputBlockTest()
+
+	hash0, err := tx.SigHash(0, &prevOut, SigHashAll)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	hash1, _ := tx.SigHash(1, &prevOut, SigHashAll)
+	if hash0 == hash1 {
+		t.Errorf("Expected each input to have its own digest")
+	}
+
+	otherValue := prevOut
+	otherValue.Value++
+	if hash, _ := tx.SigHash(0, &otherValue, SigHashAll); hash == hash0 {
+		t.Errorf("Expected the digest to commit to the spent value")
+	}
+
+	otherScript := OutputTx{Value: prevOut.Value, ScriptPubKey: []byte{0x01}}
+	if hash, _ := tx.SigHash(0, &otherScript, SigHashAll); hash == hash0 {
+		t.Errorf("Expected the digest to commit to the spent ScriptPubKey")
+	}
+
+	if _, err := tx.SigHash(0, nil, SigHashAll); err == nil {
+		t.Errorf("Expected an error without the spent output")
+	}
+}
+
+func TestSignInput(t *testing.T) {
+	tx := sigHashTestTx()
+	prevOut := createTxOutputBlockTest()
+	k := key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725")
+
+	sig, err := tx.SignInputWithType(1, k.PrivateKey, &prevOut, SigHashSingle|SigHashAnyOneCanPay)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if sig[len(sig)-1] != byte(SigHashSingle|SigHashAnyOneCanPay) {
+		t.Errorf("Expected the sighash type as the last byte, got 0x%02x", sig[len(sig)-1])
+	}
+
+	// The signature is over the 32 byte digest
+	sig, _ = tx.SignInput(0, k.PrivateKey, &prevOut)
+	parsed, err := btcec.ParseDERSignature(sig[:len(sig)-1], btcec.S256())
+	if err != nil {
+		t.Fatalf("Unable to parse signature %s", err)
+	}
+	hash, _ := tx.SigHash(0, &prevOut, SigHashAll)
+	if !parsed.Verify(hash[:], k.PublicKey) {
+		t.Errorf("Expected the signature to verify against the digest")
+	}
+	hash1, _ := tx.SigHash(1, &prevOut, SigHashAll)
+	if parsed.Verify(hash1[:], k.PublicKey) {
+		t.Errorf("Expected the signature not to verify for another input")
+	}
+}
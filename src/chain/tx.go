@@ -2,9 +2,8 @@ package chain
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
-	"github.com/btcsuite/btcd/btcec"
+	"spchain/chainhash"
 )
 
 // Tx An sp-chain transaction
@@ -19,50 +18,62 @@ type Tx struct {
 
 // Hash The transaction hash is the double SHA256 hash of the transaction
 // This is also the id of the transaction
-func (tx *Tx) Hash() [32]byte {
-	ser := tx.Serialise().Bytes()
-	sha1 := sha256.Sum256(ser)
-	sha2 := sha256.Sum256(sha1[:])
-	return sha2
+func (tx *Tx) Hash() chainhash.Hash {
+	return chainhash.DoubleHashH(tx.Serialise().Bytes())
+}
+
+// compactSize True if the version of the transaction writes TxInNo,
+// TxOutNo and script lengths as CompactSize
+func (tx *Tx) compactSize() bool {
+	return tx.Version >= TxVersionCompactSize
 }
 
 // Serialise Serialise the transaction
 func (tx *Tx) Serialise() *bytes.Buffer {
 	var buffer bytes.Buffer
 	binary.Write(&buffer, littleEndian, tx.Version)
-	binary.Write(&buffer, littleEndian, tx.TxInNo)
-	for _, tx := range tx.Vin {
-		binary.Write(&buffer, littleEndian, tx.Ser().Bytes())
+	writeCount(&buffer, tx.TxInNo, tx.compactSize())
+	for _, in := range tx.Vin {
+		binary.Write(&buffer, littleEndian, in.ser(tx.compactSize()).Bytes())
 	}
-	binary.Write(&buffer, littleEndian, tx.TxOutNo)
-	for _, tx := range tx.Vout {
-		binary.Write(&buffer, littleEndian, tx.Ser().Bytes())
+	writeCount(&buffer, tx.TxOutNo, tx.compactSize())
+	for _, out := range tx.Vout {
+		binary.Write(&buffer, littleEndian, out.ser(tx.compactSize()).Bytes())
 	}
 	binary.Write(&buffer, littleEndian, tx.LockTime)
 	return &buffer
 }
 
-// DeserialiseTx Deserialize a transaction
-func DeserialiseTx(b *bytes.Buffer) Tx {
+// DeserialiseTx Deserialise a transaction. Every byte of b must be used
+func DeserialiseTx(b *bytes.Buffer) (Tx, error) {
+	r := newReader(b)
+	ret := readTx(r)
+	if err := r.end("transaction"); err != nil {
+		return Tx{}, err
+	}
+	return ret, nil
+}
+
+// readTx Read a transaction
+func readTx(r *reader) Tx {
 	var readVersion int32
-	binary.Read(b, littleEndian, &readVersion)
+	r.read("transaction Version", &readVersion)
 
-	var readTxInNo int64
-	binary.Read(b, littleEndian, &readTxInNo)
+	compact := readVersion >= TxVersionCompactSize
+	readTxInNo := r.readCount("TxInNo", compact, minInputSize)
 	inputtxs := []InputTx{}
-	for i := int64(0); i < readTxInNo; i++ {
-		inputtxs = append(inputtxs, DeserialiseInputTx(b))
+	for i := int64(0); i < readTxInNo && r.err == nil; i++ {
+		inputtxs = append(inputtxs, readInputTx(r, compact))
 	}
 
-	var readTxOutNo int64
-	binary.Read(b, littleEndian, &readTxOutNo)
+	readTxOutNo := r.readCount("TxOutNo", compact, minOutputSize)
 	outputtx := []OutputTx{}
-	for i := int64(0); i < readTxOutNo; i++ {
-		outputtx = append(outputtx, DeserialiseOutputTx(b))
+	for i := int64(0); i < readTxOutNo && r.err == nil; i++ {
+		outputtx = append(outputtx, readOutputTx(r, compact))
 	}
 
 	var readLockTime int32
-	binary.Read(b, littleEndian, &readLockTime)
+	r.read("LockTime", &readLockTime)
 
 	return Tx{
 		Version:  readVersion,
@@ -74,25 +85,11 @@ func DeserialiseTx(b *bytes.Buffer) Tx {
 	}
 }
 
-// SerialiseForSign Serialise a transaction for signing
-// Restrict to SIGHASH_ALL
-func (tx *Tx) SerialiseForSign() *bytes.Buffer {
-	var buffer bytes.Buffer
-	binary.Write(&buffer, littleEndian, tx.Version)
-	binary.Write(&buffer, littleEndian, tx.TxInNo)
-	for _, input := range tx.Vin {
-		binary.Write(&buffer, littleEndian, input.SerSigning())
-	}
-	binary.Write(&buffer, littleEndian, tx.TxOutNo)
-	for _, output := range tx.Vout {
-		binary.Write(&buffer, littleEndian, output.Ser().Bytes())
+// IsCoinBase A coinbase transaction has a single input spending the
+// null outpoint, an all zero Txid with an OutInx of -1
+func (tx *Tx) IsCoinBase() bool {
+	if len(tx.Vin) != 1 {
+		return false
 	}
-	binary.Write(&buffer, littleEndian, tx.LockTime)
-	return &buffer
-}
-
-// Sign this transaction assuming a SIGHASH_ALL SIGHASH type
-func (tx *Tx) SignWithKey(pKey *btcec.PrivateKey) (*btcec.Signature, error) {
-	ser := tx.SerialiseForSign()
-	return pKey.Sign(ser.Bytes())
+	return tx.Vin[0].OutInx == -1 && tx.Vin[0].Txid.IsZero()
 }
@@ -2,15 +2,16 @@ package chain
 
 import (
 	"bytes"
+	"spchain/chainhash"
 	"spchain/util"
 	"testing"
 )
 
 func createTxInput() InputTx {
-	txid32 := util.Init32byteArray(0x01)
+	txid32 := chainhash.Hash(util.Init32byteArray(0x01))
 	scriptsig := []byte{20, 20, 20, 20}
 	return InputTx{
-		Txid:      txid32[:],
+		Txid:      txid32,
 		OutInx:    0,
 		ScriptSig: scriptsig,
 		Sequence:  0,
@@ -37,7 +38,10 @@ func TestTxSerDer(t *testing.T) {
 	}
 	serial := tx.Serialise()
 
-	detx := DeserialiseTx(serial)
+	detx, err := DeserialiseTx(serial)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
 
 	if detx.Version != tx.Version {
 		t.Errorf("Version %#v expected: %#v", detx.Version, tx.Version)
@@ -67,3 +71,28 @@ func TestTxSerDer(t *testing.T) {
 		t.Errorf("TxInNo %#v expected: %#v", 1, 1)
 	}
 }
+
+func TestIsCoinBase(t *testing.T) {
+	coinbase := Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin:     []InputTx{{OutInx: -1, ScriptSig: []byte{1}}},
+		Vout:    []OutputTx{createTxOutput()},
+	}
+	if !coinbase.IsCoinBase() {
+		t.Errorf("Expected transaction to be a coinbase")
+	}
+
+	notNull := coinbase
+	notNull.Vin = []InputTx{createTxInput()}
+	if notNull.IsCoinBase() {
+		t.Errorf("Expected input spending an outpoint not to be a coinbase")
+	}
+
+	twoInputs := coinbase
+	twoInputs.Vin = append([]InputTx{}, coinbase.Vin[0], coinbase.Vin[0])
+	if twoInputs.IsCoinBase() {
+		t.Errorf("Expected transaction with two inputs not to be a coinbase")
+	}
+}
@@ -3,72 +3,89 @@ package chain
 import (
 	"bytes"
 	"encoding/binary"
-	"spchain/util"
+	"spchain/chainhash"
 )
 
 // InputTx Input Transaction
 type InputTx struct {
-	//Txid This must  be 32 byte value
-	Txid      []byte
+	// Txid The transaction with the output spent
+	Txid      chainhash.Hash
 	OutInx    int32
 	ScriptSig []byte
-	// Delete sequence
+	// Sequence MaxTxInSequenceNum for a final input. Otherwise it can
+	// hold a relative lock time, see locktime.go
 	Sequence int32
 }
 
+// PreviousOutPoint The output the input spends
+func (b *InputTx) PreviousOutPoint() chainhash.OutPoint {
+	return chainhash.OutPoint{Hash: b.Txid, Index: b.OutInx}
+}
+
 // ScriptSigLen the length of the ScriptSig
-func (b *InputTx) ScriptSigLen() byte {
-	return byte(len(b.ScriptSig))
+func (b *InputTx) ScriptSigLen() int {
+	return len(b.ScriptSig)
 }
 
-// Ser Serialise the InputTx
+// Ser Serialise the InputTx as a transaction from TxVersionCompactSize
+// writes it
 func (b *InputTx) Ser() *bytes.Buffer {
+	return b.ser(true)
+}
+
+// ser Serialise the InputTx with a CompactSize or, for the old format,
+// single byte ScriptSig length
+func (b *InputTx) ser(compact bool) *bytes.Buffer {
 	var ret bytes.Buffer
 	binary.Write(&ret, littleEndian, b.Txid)
 	binary.Write(&ret, littleEndian, b.OutInx)
-	binary.Write(&ret, littleEndian, b.ScriptSigLen())
-	binary.Write(&ret, littleEndian, b.ScriptSig)
+	writeVarBytes(&ret, b.ScriptSig, compact)
 	binary.Write(&ret, littleEndian, b.Sequence)
 	return &ret
 }
 
-// DeserialiseInputTx Deserialze bytes to InputTx
-func DeserialiseInputTx(b *bytes.Buffer) InputTx {
-	var readTxID = util.Init32byteArray(0x00)
-	binary.Read(b, littleEndian, &readTxID)
+// DeserialiseInputTx Deserialise bytes written by Ser to InputTx. Every
+// byte of b must be used
+func DeserialiseInputTx(b *bytes.Buffer) (InputTx, error) {
+	r := newReader(b)
+	ret := readInputTx(r, true)
+	if err := r.end("input"); err != nil {
+		return InputTx{}, err
+	}
+	return ret, nil
+}
+
+// readInputTx Read an InputTx written by ser
+func readInputTx(r *reader, compact bool) InputTx {
+	var readTxID chainhash.Hash
+	r.read("input Txid", &readTxID)
 
 	var readOutInx int32
-	binary.Read(b, littleEndian, &readOutInx)
+	r.read("input OutInx", &readOutInx)
 
 	// Read the ScriptSig
-	lenToRead := byte(0)
-	binary.Read(b, littleEndian, &lenToRead)
-	var readScriptSig []byte
-	for i := 0; i < int(lenToRead); i++ {
-		var read byte
-		binary.Read(b, littleEndian, &read)
-		readScriptSig = append(readScriptSig, read)
-	}
+	readScriptSig := r.readVarBytes("ScriptSig", compact)
 
 	// Read the sequence
 	var readSequence int32
-	binary.Read(b, littleEndian, &readSequence)
+	r.read("input Sequence", &readSequence)
 
 	return InputTx{
-		Txid:      readTxID[:],
+		Txid:      readTxID,
 		OutInx:    readOutInx,
 		ScriptSig: readScriptSig,
 		Sequence:  readSequence,
 	}
 }
 
-// SerSigning Serialise the InputTx for signing
-// The InputTx should created without a ScriptSig
-func (b *InputTx) SerSigning() []byte {
+// SerSigning Serialise the InputTx for signing. The ScriptSig is
+// replaced by scriptCode, the ScriptPubKey the input spends when it is
+// the input being signed, otherwise empty. compact is as for ser
+func (b *InputTx) SerSigning(scriptCode []byte, compact bool) []byte {
 	var ret bytes.Buffer
 	binary.Write(&ret, littleEndian, b.Txid)
 	binary.Write(&ret, littleEndian, b.OutInx)
-	binary.Write(&ret, littleEndian, [1]byte{0x00})
+	writeVarBytes(&ret, scriptCode, compact)
 	binary.Write(&ret, littleEndian, b.Sequence)
 	return ret.Bytes()
 }
@@ -2,23 +2,27 @@ package chain
 
 import (
 	"bytes"
+	"spchain/chainhash"
 	"spchain/util"
 	"testing"
 )
 
 // TestTxInputSerDer Test serialisation and deserialisation
 func TestTxInputSerDer(t *testing.T) {
-	txid32 := util.Init32byteArray(0x01)
+	txid32 := chainhash.Hash(util.Init32byteArray(0x01))
 	scriptsig := []byte{20, 20, 20, 20}
 	txinput := InputTx{
-		Txid:      txid32[:],
+		Txid:      txid32,
 		OutInx:    0,
 		ScriptSig: scriptsig,
 		Sequence:  0,
 	}
 
 	ser := txinput.Ser()
-	txinputdes := DeserialiseInputTx(ser)
+	txinputdes, err := DeserialiseInputTx(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
 
 	if slen := txinput.ScriptSigLen(); int(slen) != 4 {
 		t.Errorf("ScriptSigLen go %d, expect %d", slen, 4)
@@ -28,7 +32,7 @@ func TestTxInputSerDer(t *testing.T) {
 		t.Errorf("ScriptSig %#v expected: %#v", txinput.ScriptSig, scriptsig)
 	}
 
-	if !bytes.Equal(txinput.Txid, txid32[:]) {
+	if txinputdes.Txid != txid32 {
 		t.Errorf("Txid doesn't equal")
 	}
 
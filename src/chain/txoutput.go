@@ -5,40 +5,59 @@ import (
 	"encoding/binary"
 )
 
+const (
+	// BaseUnitsPerCoin The number of base units in one coin
+	BaseUnitsPerCoin = 100000000
+
+	// MaxMoney The most base units that can ever exist.
+	// No single output or sum of outputs may be more than this
+	MaxMoney = 21000000 * BaseUnitsPerCoin
+)
+
 // OutputTx OutputTx
 type OutputTx struct {
 	Value        int64
 	ScriptPubKey []byte
 }
 
-// ScriptPubLen the length of the ScriptSig
-func (b *OutputTx) ScriptPubLen() byte {
-	return byte(len(b.ScriptPubKey))
+// ScriptPubLen the length of the ScriptPubKey
+func (b *OutputTx) ScriptPubLen() int {
+	return len(b.ScriptPubKey)
 }
 
-// Ser Serialise the InputTx
+// Ser Serialise the OutputTx as a transaction from TxVersionCompactSize
+// writes it
 func (b *OutputTx) Ser() *bytes.Buffer {
+	return b.ser(true)
+}
+
+// ser Serialise the OutputTx with a CompactSize or, for the old format,
+// single byte ScriptPubKey length
+func (b *OutputTx) ser(compact bool) *bytes.Buffer {
 	var ret bytes.Buffer
 	binary.Write(&ret, littleEndian, b.Value)
-	binary.Write(&ret, littleEndian, b.ScriptPubLen())
-	binary.Write(&ret, littleEndian, b.ScriptPubKey)
+	writeVarBytes(&ret, b.ScriptPubKey, compact)
 	return &ret
 }
 
-// DeserialiseOutputTx Deserialze bytes to OutputTx
-func DeserialiseOutputTx(b *bytes.Buffer) OutputTx {
+// DeserialiseOutputTx Deserialise bytes written by Ser to OutputTx.
+// Every byte of b must be used
+func DeserialiseOutputTx(b *bytes.Buffer) (OutputTx, error) {
+	r := newReader(b)
+	ret := readOutputTx(r, true)
+	if err := r.end("output"); err != nil {
+		return OutputTx{}, err
+	}
+	return ret, nil
+}
+
+// readOutputTx Read an OutputTx written by ser
+func readOutputTx(r *reader, compact bool) OutputTx {
 	var readValue int64
-	binary.Read(b, littleEndian, &readValue)
+	r.read("output Value", &readValue)
 
 	// Read the ScriptPub
-	lenToRead := byte(0)
-	binary.Read(b, littleEndian, &lenToRead)
-	var readPubKey []byte
-	for i := 0; i < int(lenToRead); i++ {
-		var read byte
-		binary.Read(b, littleEndian, &read)
-		readPubKey = append(readPubKey, read)
-	}
+	readPubKey := r.readVarBytes("ScriptPubKey", compact)
 
 	return OutputTx{
 		Value:        readValue,
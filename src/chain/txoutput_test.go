@@ -14,7 +14,10 @@ func TestTxOutputSerDer(t *testing.T) {
 	}
 
 	ser := txoutput.Ser()
-	txoutputdes := DeserialiseOutputTx(ser)
+	txoutputdes, err := DeserialiseOutputTx(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
 
 	if slen := txoutputdes.ScriptPubLen(); int(slen) != 4 {
 		t.Errorf("ScriptPubLen go %d, expect %d", slen, 4)
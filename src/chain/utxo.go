@@ -1,11 +1,265 @@
 package chain
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"spchain/chainhash"
+	"spchain/db"
+)
+
 /*
   Utxo struct is used for serialising and deserialising a utxo.
-  Serialised as a json string
+  The utxo set is stored in the database keyed by outpoint, the
+  Txid and output index of the output.
 */
 
+// Utxo An unspent transaction output
 type Utxo struct {
-	value        int64
-	scriptPubKey []byte
+	Value        int64
+	ScriptPubKey []byte
+	// Height The height of the block which created the output
+	Height int32
+	// IsCoinBase True if the output was created by a coinbase
+	IsCoinBase bool
+}
+
+// Output The OutputTx this utxo came from
+func (u *Utxo) Output() OutputTx {
+	return OutputTx{
+		Value:        u.Value,
+		ScriptPubKey: append([]byte{}, u.ScriptPubKey...),
+	}
+}
+
+// Ser Serialise the Utxo
+func (u *Utxo) Ser() *bytes.Buffer {
+	var ret bytes.Buffer
+	binary.Write(&ret, littleEndian, u.Height)
+	binary.Write(&ret, littleEndian, u.IsCoinBase)
+	output := u.Output()
+	binary.Write(&ret, littleEndian, output.Ser().Bytes())
+	return &ret
+}
+
+// DeserialiseUtxo Deserialise bytes to a Utxo. Every byte of b must
+// be used
+func DeserialiseUtxo(b *bytes.Buffer) (Utxo, error) {
+	r := newReader(b)
+	ret := readUtxo(r)
+	if err := r.end("utxo"); err != nil {
+		return Utxo{}, err
+	}
+	return ret, nil
+}
+
+// readUtxo Read a Utxo
+func readUtxo(r *reader) Utxo {
+	var ret Utxo
+	r.read("utxo Height", &ret.Height)
+	r.read("utxo IsCoinBase", &ret.IsCoinBase)
+	output := readOutputTx(r, true)
+	ret.Value = output.Value
+	ret.ScriptPubKey = output.ScriptPubKey
+	return ret
+}
+
+// SpentUtxo A utxo spent by a block, kept so it can be restored
+// if the block is disconnected
+type SpentUtxo struct {
+	OutPoint chainhash.OutPoint
+	Utxo     Utxo
+}
+
+// BlockUndo The utxos spent by a block in the order they were spent
+type BlockUndo struct {
+	Spent []SpentUtxo
+}
+
+// Ser Serialise the BlockUndo
+func (u *BlockUndo) Ser() *bytes.Buffer {
+	var ret bytes.Buffer
+	binary.Write(&ret, littleEndian, int64(len(u.Spent)))
+	for _, spent := range u.Spent {
+		binary.Write(&ret, littleEndian, spent.OutPoint.Hash)
+		binary.Write(&ret, littleEndian, spent.OutPoint.Index)
+		binary.Write(&ret, littleEndian, spent.Utxo.Ser().Bytes())
+	}
+	return &ret
+}
+
+// DeserialiseBlockUndo Deserialise bytes to a BlockUndo. Every byte
+// of b must be used
+func DeserialiseBlockUndo(b *bytes.Buffer) (BlockUndo, error) {
+	var ret BlockUndo
+	r := newReader(b)
+	// Txid, OutInx, Height, IsCoinBase and an output
+	count := r.readCount("spent utxo count", false, 32+4+4+1+minOutputSize)
+	for i := int64(0); i < count && r.err == nil; i++ {
+		var outPoint chainhash.OutPoint
+		r.read("spent Txid", &outPoint.Hash)
+		r.read("spent OutInx", &outPoint.Index)
+		ret.Spent = append(ret.Spent, SpentUtxo{
+			OutPoint: outPoint,
+			Utxo:     readUtxo(r),
+		})
+	}
+	if err := r.end("block undo"); err != nil {
+		return BlockUndo{}, err
+	}
+	return ret, nil
+}
+
+// MissingUtxoError A block spends an output which is not in the utxo set
+type MissingUtxoError struct {
+	Msg string
+}
+
+func (e *MissingUtxoError) Error() string {
+	return e.Msg
+}
+
+// UtxoSet The set of unspent transaction outputs stored in the database
+type UtxoSet struct {
+	db db.Interface
+}
+
+// NewUtxoSet A utxo set backed by database
+func NewUtxoSet(database db.Interface) *UtxoSet {
+	return &UtxoSet{db: database}
+}
+
+// Get Look up a utxo by outpoint. Returns nil, nil if the
+// outpoint is not in the set
+func (s *UtxoSet) Get(outPoint chainhash.OutPoint) (*Utxo, error) {
+	buff, err := s.db.GetUtxo(outPoint)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	utxo, err := DeserialiseUtxo(buff)
+	if err != nil {
+		return nil, err
+	}
+	return &utxo, nil
+}
+
+// LookupUtxo The utxo at outPoint if it is unspent
+func (s *UtxoSet) LookupUtxo(outPoint chainhash.OutPoint) (*Utxo, error) {
+	return s.Get(outPoint)
+}
+
+// ForEach Call fn with every utxo in the set
+func (s *UtxoSet) ForEach(fn func(outPoint chainhash.OutPoint, utxo Utxo) error) error {
+	return s.db.ForEachUtxo(func(outPoint chainhash.OutPoint, buff *bytes.Buffer) error {
+		utxo, err := DeserialiseUtxo(buff)
+		if err != nil {
+			return err
+		}
+		return fn(outPoint, utxo)
+	})
+}
+
+// ConnectBlock Spend the outputs used by the block at height and add the
+// outputs it creates. The spent utxos are saved as undo data so the block
+// can be disconnected. The block becomes the best block at height.
+// Everything is written in a single batch
+func (s *UtxoSet) ConnectBlock(block *Block, height int32) error {
+	blockHash := block.Hash()
+	created := map[chainhash.OutPoint]Utxo{}
+	spent := []chainhash.OutPoint{}
+	undo := BlockUndo{}
+
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+
+		if !tx.IsCoinBase() {
+			for _, in := range tx.Vin {
+				outPoint := in.PreviousOutPoint()
+
+				// Outputs created and spent in the same block never
+				// reach the database so need no undo data
+				if _, ok := created[outPoint]; ok {
+					delete(created, outPoint)
+					continue
+				}
+
+				utxo, err := s.Get(outPoint)
+				if err != nil {
+					return err
+				}
+				if utxo == nil {
+					return &MissingUtxoError{
+						fmt.Sprintf("Block %s spends missing output %s", blockHash, outPoint),
+					}
+				}
+				spent = append(spent, outPoint)
+				undo.Spent = append(undo.Spent, SpentUtxo{
+					OutPoint: outPoint,
+					Utxo:     *utxo,
+				})
+			}
+		}
+
+		txHash := tx.Hash()
+		for index, out := range tx.Vout {
+			created[chainhash.OutPoint{Hash: txHash, Index: int32(index)}] = Utxo{
+				Value:        out.Value,
+				ScriptPubKey: out.ScriptPubKey,
+				Height:       height,
+				IsCoinBase:   tx.IsCoinBase(),
+			}
+		}
+	}
+
+	batch := db.UtxoBatch{
+		Spent:     spent,
+		Created:   map[chainhash.OutPoint]*bytes.Buffer{},
+		BlockHash: blockHash,
+		Undo:      undo.Ser(),
+		Heights:   map[int32]*chainhash.Hash{height: &blockHash},
+		BestBlock: (&BestBlock{Hash: block.Hash(), Height: height}).Ser(),
+	}
+	for outPoint, utxo := range created {
+		batch.Created[outPoint] = utxo.Ser()
+	}
+	return s.db.WriteUtxoBatch(&batch)
+}
+
+// DisconnectBlock Undo ConnectBlock for the block at height. The outputs
+// created by the block are removed and the outputs it spent are restored
+// from the undo data. The parent of the block becomes the best block
+func (s *UtxoSet) DisconnectBlock(block *Block, height int32) error {
+	blockHash := block.Hash()
+	buff, err := s.db.GetUndo(blockHash)
+	if err != nil {
+		return err
+	}
+	undo, err := DeserialiseBlockUndo(buff)
+	if err != nil {
+		return err
+	}
+
+	batch := db.UtxoBatch{
+		Spent:     []chainhash.OutPoint{},
+		Created:   map[chainhash.OutPoint]*bytes.Buffer{},
+		BlockHash: blockHash,
+		Heights:   map[int32]*chainhash.Hash{height: nil},
+	}
+	if height > 0 {
+		parent := BestBlock{Hash: block.Header.PrevBlockHash, Height: height - 1}
+		batch.BestBlock = parent.Ser()
+	}
+	for i := range block.Transactions {
+		txHash := block.Transactions[i].Hash()
+		for index := range block.Transactions[i].Vout {
+			batch.Spent = append(batch.Spent, chainhash.OutPoint{Hash: txHash, Index: int32(index)})
+		}
+	}
+	for _, spent := range undo.Spent {
+		batch.Created[spent.OutPoint] = spent.Utxo.Ser()
+	}
+	return s.db.WriteUtxoBatch(&batch)
 }
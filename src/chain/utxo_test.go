@@ -0,0 +1,265 @@
+package chain
+
+import (
+	"bytes"
+	"spchain/chainhash"
+	"spchain/db"
+	"spchain/util"
+	"testing"
+)
+
+// memDb An in memory db.Interface
+type memDb struct {
+	blocks  map[chainhash.Hash][]byte
+	utxos   map[chainhash.OutPoint][]byte
+	undo    map[chainhash.Hash][]byte
+	meta    map[chainhash.Hash][]byte
+	heights map[int32]chainhash.Hash
+	best    []byte
+}
+
+func newMemDb() *memDb {
+	return &memDb{
+		blocks:  map[chainhash.Hash][]byte{},
+		utxos:   map[chainhash.OutPoint][]byte{},
+		undo:    map[chainhash.Hash][]byte{},
+		meta:    map[chainhash.Hash][]byte{},
+		heights: map[int32]chainhash.Hash{},
+	}
+}
+
+func (m *memDb) SaveBlock(blockHash chainhash.Hash, buff *bytes.Buffer) error {
+	m.blocks[blockHash] = buff.Bytes()
+	return nil
+}
+
+func (m *memDb) BlockLocation(blockHash chainhash.Hash) string {
+	return blockHash.String()
+}
+
+func (m *memDb) WriteBlock(blockHash chainhash.Hash, block *bytes.Buffer, meta *bytes.Buffer) error {
+	m.blocks[blockHash] = block.Bytes()
+	m.meta[blockHash] = meta.Bytes()
+	return nil
+}
+
+func (m *memDb) GetBlock(blockHash chainhash.Hash) (*bytes.Buffer, error) {
+	data, ok := m.blocks[blockHash]
+	if !ok {
+		return &bytes.Buffer{}, db.ErrNotFound
+	}
+	return bytes.NewBuffer(append([]byte{}, data...)), nil
+}
+
+func (m *memDb) GetUtxo(outPoint chainhash.OutPoint) (*bytes.Buffer, error) {
+	data, ok := m.utxos[outPoint]
+	if !ok {
+		return &bytes.Buffer{}, db.ErrNotFound
+	}
+	return bytes.NewBuffer(append([]byte{}, data...)), nil
+}
+
+func (m *memDb) ForEachUtxo(fn func(outPoint chainhash.OutPoint, buff *bytes.Buffer) error) error {
+	for outPoint, data := range m.utxos {
+		if err := fn(outPoint, bytes.NewBuffer(append([]byte{}, data...))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memDb) GetUndo(blockHash chainhash.Hash) (*bytes.Buffer, error) {
+	data, ok := m.undo[blockHash]
+	if !ok {
+		return &bytes.Buffer{}, db.ErrNotFound
+	}
+	return bytes.NewBuffer(append([]byte{}, data...)), nil
+}
+
+func (m *memDb) WriteUtxoBatch(batch *db.UtxoBatch) error {
+	for _, outPoint := range batch.Spent {
+		delete(m.utxos, outPoint)
+	}
+	for outPoint, buff := range batch.Created {
+		m.utxos[outPoint] = buff.Bytes()
+	}
+	if batch.Undo != nil {
+		m.undo[batch.BlockHash] = batch.Undo.Bytes()
+	} else {
+		delete(m.undo, batch.BlockHash)
+	}
+	for height, blockHash := range batch.Heights {
+		if blockHash == nil {
+			delete(m.heights, height)
+		} else {
+			m.heights[height] = *blockHash
+		}
+	}
+	if batch.BestBlock != nil {
+		m.best = batch.BestBlock.Bytes()
+	}
+	return nil
+}
+
+func (m *memDb) SaveBlockMeta(blockHash chainhash.Hash, buff *bytes.Buffer) error {
+	m.meta[blockHash] = buff.Bytes()
+	return nil
+}
+
+func (m *memDb) GetBlockMeta(blockHash chainhash.Hash) (*bytes.Buffer, error) {
+	data, ok := m.meta[blockHash]
+	if !ok {
+		return &bytes.Buffer{}, db.ErrNotFound
+	}
+	return bytes.NewBuffer(append([]byte{}, data...)), nil
+}
+
+func (m *memDb) ForEachBlockMeta(fn func(blockHash chainhash.Hash, buff *bytes.Buffer) error) error {
+	for blockHash, data := range m.meta {
+		if err := fn(blockHash, bytes.NewBuffer(append([]byte{}, data...))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memDb) GetBlockHashByHeight(height int32) (chainhash.Hash, error) {
+	blockHash, ok := m.heights[height]
+	if !ok {
+		return chainhash.Hash{}, db.ErrNotFound
+	}
+	return blockHash, nil
+}
+
+func (m *memDb) GetBestBlock() (*bytes.Buffer, error) {
+	if m.best == nil {
+		return &bytes.Buffer{}, db.ErrNotFound
+	}
+	return bytes.NewBuffer(append([]byte{}, m.best...)), nil
+}
+
+func utxoTestCoinbase(extra byte) Tx {
+	return Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 2,
+		Vin:     []InputTx{{OutInx: -1, ScriptSig: []byte{extra}}},
+		Vout: []OutputTx{
+			{Value: 3000, ScriptPubKey: []byte{1}},
+			{Value: 2000, ScriptPubKey: []byte{2}},
+		},
+	}
+}
+
+func utxoTestSpend(txid chainhash.Hash, outInx int32, value int64) Tx {
+	return Tx{
+		Version: 1,
+		TxInNo:  1,
+		TxOutNo: 1,
+		Vin:     []InputTx{{Txid: txid, OutInx: outInx, ScriptSig: []byte{3}}},
+		Vout:    []OutputTx{{Value: value, ScriptPubKey: []byte{4}}},
+	}
+}
+
+func utxoTestBlock(prev byte, txs []Tx) Block {
+	header := mockBlockHeader()
+	header.PrevBlockHash = chainhash.Hash{prev}
+	return Block{Header: header, TxCount: int64(len(txs)), Transactions: txs}
+}
+
+func utxoCount(t *testing.T, set *UtxoSet) int {
+	count := 0
+	err := set.ForEach(func(outPoint chainhash.OutPoint, utxo Utxo) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return count
+}
+
+func TestUtxoSerDer(t *testing.T) {
+	utxo := Utxo{Value: 20000, ScriptPubKey: []byte{1, 2, 3}, Height: 7, IsCoinBase: true}
+	dser, err := DeserialiseUtxo(utxo.Ser())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if dser.Value != utxo.Value || dser.Height != utxo.Height || dser.IsCoinBase != utxo.IsCoinBase {
+		t.Errorf("Utxo %#v expected: %#v", dser, utxo)
+	}
+	if !bytes.Equal(dser.ScriptPubKey, utxo.ScriptPubKey) {
+		t.Errorf("ScriptPubKey %#v expected: %#v", dser.ScriptPubKey, utxo.ScriptPubKey)
+	}
+}
+
+func TestUtxoConnectDisconnect(t *testing.T) {
+	set := NewUtxoSet(newMemDb())
+
+	coinbase1 := utxoTestCoinbase(1)
+	block1 := utxoTestBlock(1, []Tx{coinbase1})
+	if err := set.ConnectBlock(&block1, 1); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	cb1Hash := coinbase1.Hash()
+	utxo, _ := set.Get(chainhash.OutPoint{Hash: cb1Hash, Index: 1})
+	if utxo == nil || utxo.Value != 2000 || !utxo.IsCoinBase || utxo.Height != 1 {
+		t.Fatalf("Expected coinbase output in the utxo set, got %#v", utxo)
+	}
+
+	// Block 2 spends output 0 of the first coinbase, then spends the
+	// output of that transaction within the same block
+	spend := utxoTestSpend(cb1Hash, 0, 2500)
+	spendHash := spend.Hash()
+	spendAgain := utxoTestSpend(spendHash, 0, 2400)
+	coinbase2 := utxoTestCoinbase(2)
+	block2 := utxoTestBlock(2, []Tx{coinbase2, spend, spendAgain})
+	if err := set.ConnectBlock(&block2, 2); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if utxo, _ := set.Get(chainhash.OutPoint{Hash: cb1Hash, Index: 0}); utxo != nil {
+		t.Errorf("Expected spent output to be removed")
+	}
+	if utxo, _ := set.Get(chainhash.OutPoint{Hash: spendHash, Index: 0}); utxo != nil {
+		t.Errorf("Expected output spent in the same block to be removed")
+	}
+	spendAgainHash := spendAgain.Hash()
+	if out, _ := set.LookupUtxo(chainhash.OutPoint{Hash: spendAgainHash, Index: 0}); out == nil || out.Value != 2400 {
+		t.Errorf("Expected new output in the utxo set, got %#v", out)
+	}
+	// cb1:1, cb2:0, cb2:1, spendAgain:0
+	if count := utxoCount(t, set); count != 4 {
+		t.Errorf("Expected 4 utxos, got %d", count)
+	}
+
+	if err := set.DisconnectBlock(&block2, 2); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if utxo, _ := set.Get(chainhash.OutPoint{Hash: cb1Hash, Index: 0}); utxo == nil || utxo.Value != 3000 || utxo.Height != 1 {
+		t.Errorf("Expected spent output to be restored, got %#v", utxo)
+	}
+	if utxo, _ := set.Get(chainhash.OutPoint{Hash: spendAgainHash, Index: 0}); utxo != nil {
+		t.Errorf("Expected outputs of the disconnected block to be removed")
+	}
+	if count := utxoCount(t, set); count != 2 {
+		t.Errorf("Expected 2 utxos, got %d", count)
+	}
+}
+
+func TestUtxoConnectMissing(t *testing.T) {
+	set := NewUtxoSet(newMemDb())
+
+	block := utxoTestBlock(1, []Tx{utxoTestCoinbase(1), utxoTestSpend(chainhash.Hash(util.Init32byteArray(0x05)), 0, 10)})
+	err := set.ConnectBlock(&block, 1)
+	if _, ok := err.(*MissingUtxoError); !ok {
+		t.Errorf("Expected MissingUtxoError, got %v", err)
+	}
+
+	// Nothing should have been written
+	if count := utxoCount(t, set); count != 0 {
+		t.Errorf("Expected an empty utxo set, got %d", count)
+	}
+}
@@ -0,0 +1,60 @@
+package chaincfg
+
+import (
+	"spchain/chain"
+	"spchain/script"
+)
+
+// genesisCoinbaseTx The coinbase of the genesis block of every network.
+// The output is deliberately unspendable: it has the P2PKH form but
+// compares against 20 zero bytes, which no public key hashes to
+var genesisCoinbaseTx = chain.Tx{
+	Version: 1,
+	TxInNo:  1,
+	TxOutNo: 1,
+	Vin: []chain.InputTx{{
+		OutInx:    -1,
+		ScriptSig: []byte("sp-chain genesis 01/Mar/2019"),
+		Sequence:  -1,
+	}},
+	Vout: []chain.OutputTx{{
+		Value: 50 * chain.BaseUnitsPerCoin,
+		ScriptPubKey: script.Stack{
+			Contents: []script.Operand{
+				script.OP_DUP{},
+				script.OP_HASH_160{},
+				script.PUB_KEY_V1{Key: make([]byte, 20)},
+				script.OP_EQUALVERIFY{},
+				script.OP_CHECKSIG{},
+			},
+		}.Ser().Bytes(),
+	}},
+	LockTime: 0,
+}
+
+// newGenesisBlock Build a genesis block around genesisCoinbaseTx.
+// The nonce is found ahead of time so the block meets its target
+func newGenesisBlock(timeStamp int64, bits uint32, nonce int32) chain.Block {
+	block := chain.Block{
+		Header: chain.BlockHeader{
+			Version:          1,
+			TimeStamp:        timeStamp,
+			DifficultyTarget: int32(bits),
+			Nonce:            nonce,
+		},
+		TxCount:      1,
+		Transactions: []chain.Tx{genesisCoinbaseTx},
+	}
+	block.Header.MerkleRoot = block.CalcMerkle().Root
+	block.Size = block.SerSize()
+	return block
+}
+
+// genesisBlock The genesis block of the main network
+var genesisBlock = newGenesisBlock(1551398400, 0x1d00ffff, -1948150969)
+
+// testNetGenesisBlock The genesis block of the test network
+var testNetGenesisBlock = newGenesisBlock(1551398401, 0x1e00ffff, 13495804)
+
+// regressionGenesisBlock The genesis block of the regression test network
+var regressionGenesisBlock = newGenesisBlock(1551398402, 0x207fffff, 4)
@@ -0,0 +1,44 @@
+package chaincfg
+
+import (
+	"spchain/mining"
+	"testing"
+)
+
+func TestGenesisBlocks(t *testing.T) {
+	for _, params := range []*Params{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		genesis := params.GenesisBlock
+
+		if uint32(genesis.Header.DifficultyTarget) != params.PowLimitBits {
+			t.Errorf("%s: genesis target %#x expected %#x", params.Name, genesis.Header.DifficultyTarget, params.PowLimitBits)
+		}
+
+		if !mining.CheckProofOfWork(&genesis.Header) {
+			t.Errorf("%s: genesis block does not meet its target", params.Name)
+		}
+
+		root := genesis.CalcMerkle().Root
+		if root != genesis.Header.MerkleRoot {
+			t.Errorf("%s: genesis merkle root %s expected %s", params.Name, genesis.Header.MerkleRoot, root)
+		}
+
+		if genesis.Size != genesis.SerSize() {
+			t.Errorf("%s: genesis size %d expected %d", params.Name, genesis.Size, genesis.SerSize())
+		}
+
+		if params.GenesisHash != genesis.Hash() {
+			t.Errorf("%s: GenesisHash does not match the genesis block", params.Name)
+		}
+
+		if !genesis.Transactions[0].IsCoinBase() {
+			t.Errorf("%s: genesis transaction is not a coinbase", params.Name)
+		}
+	}
+}
+
+func TestGenesisHashesDiffer(t *testing.T) {
+	if MainNetParams.GenesisHash == TestNetParams.GenesisHash ||
+		TestNetParams.GenesisHash == RegressionNetParams.GenesisHash {
+		t.Errorf("Expected a different genesis block for every network")
+	}
+}
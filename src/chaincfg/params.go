@@ -0,0 +1,158 @@
+package chaincfg
+
+import (
+	"math/big"
+	"spchain/chain"
+	"spchain/chainhash"
+	"time"
+)
+
+var (
+	bigOne = big.NewInt(1)
+
+	// mainPowLimit The easiest target allowed on the main network, 2^224 - 1
+	mainPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 224), bigOne)
+
+	// testNetPowLimit The easiest target allowed on the test network, 2^232 - 1
+	testNetPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 232), bigOne)
+
+	// regressionPowLimit The easiest target allowed on the regression
+	// test network, 2^255 - 1
+	regressionPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
+)
+
+// Net Magic number identifying the network a message belongs to
+type Net uint32
+
+const (
+	// MainNet The main network
+	MainNet Net = 0xd9b4bef9
+
+	// TestNet The test network
+	TestNet Net = 0x0709110b
+
+	// RegressionNet The regression test network
+	RegressionNet Net = 0xdab5bffa
+)
+
+// Params Consensus parameters which differ between networks
+type Params struct {
+	// Name Human readable name of the network
+	Name string
+
+	// Net Magic number identifying the network
+	Net Net
+
+	// GenesisBlock The first block of the chain
+	GenesisBlock *chain.Block
+
+	// GenesisHash The hash of GenesisBlock
+	GenesisHash chainhash.Hash
+
+	// PubKeyHashAddrID The version byte in front of pay to public key
+	// hash addresses
+	PubKeyHashAddrID byte
+
+	// ScriptHashAddrID The version byte in front of pay to script
+	// hash addresses
+	ScriptHashAddrID byte
+
+	// PowLimit The highest (easiest) target a block may have
+	PowLimit *big.Int
+
+	// PowLimitBits PowLimit in the compact form used by
+	// BlockHeader.DifficultyTarget
+	PowLimitBits uint32
+
+	// BaseSubsidy The base units a coinbase may create before
+	// any halving
+	BaseSubsidy int64
+
+	// SubsidyHalvingInterval The number of blocks between each
+	// halving of the subsidy
+	SubsidyHalvingInterval int32
+
+	// CoinbaseMaturity The number of blocks a coinbase output must be
+	// buried under before it can be spent
+	CoinbaseMaturity int32
+
+	// TargetTimePerBlock The desired time between blocks
+	TargetTimePerBlock time.Duration
+
+	// RetargetInterval The number of blocks between difficulty
+	// adjustments. This is also the window of blocks whose timestamps
+	// are used to calculate the new target
+	RetargetInterval int32
+
+	// RetargetAdjustmentFactor The most the target may change by in a
+	// single adjustment, in either direction
+	RetargetAdjustmentFactor int64
+}
+
+// PubKeyHashAddrVersion PubKeyHashAddrID, so Params can be used as
+// key.AddrParams
+func (p *Params) PubKeyHashAddrVersion() byte {
+	return p.PubKeyHashAddrID
+}
+
+// ScriptHashAddrVersion ScriptHashAddrID, so Params can be used as
+// key.AddrParams
+func (p *Params) ScriptHashAddrVersion() byte {
+	return p.ScriptHashAddrID
+}
+
+// MainNetParams Parameters for the main network
+var MainNetParams = Params{
+	Name:                     "mainnet",
+	Net:                      MainNet,
+	GenesisBlock:             &genesisBlock,
+	GenesisHash:              genesisBlock.Hash(),
+	PubKeyHashAddrID:         0x00,
+	ScriptHashAddrID:         0x05,
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             0x1d00ffff,
+	BaseSubsidy:              50 * chain.BaseUnitsPerCoin,
+	SubsidyHalvingInterval:   210000,
+	CoinbaseMaturity:         100,
+	TargetTimePerBlock:       10 * time.Minute,
+	RetargetInterval:         2016,
+	RetargetAdjustmentFactor: 4,
+}
+
+// TestNetParams Parameters for the test network
+var TestNetParams = Params{
+	Name:                     "testnet",
+	Net:                      TestNet,
+	GenesisBlock:             &testNetGenesisBlock,
+	GenesisHash:              testNetGenesisBlock.Hash(),
+	PubKeyHashAddrID:         0x6f,
+	ScriptHashAddrID:         0xc4,
+	PowLimit:                 testNetPowLimit,
+	PowLimitBits:             0x1e00ffff,
+	BaseSubsidy:              50 * chain.BaseUnitsPerCoin,
+	SubsidyHalvingInterval:   210000,
+	CoinbaseMaturity:         100,
+	TargetTimePerBlock:       time.Minute,
+	RetargetInterval:         144,
+	RetargetAdjustmentFactor: 4,
+}
+
+// RegressionNetParams Parameters for the regression test network.
+// Blocks are cheap to mine, coinbases mature quickly and the
+// difficulty adjusts quickly
+var RegressionNetParams = Params{
+	Name:                     "regtest",
+	Net:                      RegressionNet,
+	GenesisBlock:             &regressionGenesisBlock,
+	GenesisHash:              regressionGenesisBlock.Hash(),
+	PubKeyHashAddrID:         0x6f,
+	ScriptHashAddrID:         0xc4,
+	PowLimit:                 regressionPowLimit,
+	PowLimitBits:             0x207fffff,
+	BaseSubsidy:              50 * chain.BaseUnitsPerCoin,
+	SubsidyHalvingInterval:   150,
+	CoinbaseMaturity:         10,
+	TargetTimePerBlock:       time.Second,
+	RetargetInterval:         10,
+	RetargetAdjustmentFactor: 4,
+}
@@ -0,0 +1,121 @@
+package chainhash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+/*
+  Hashes are stored and hashed in the byte order they come out of
+  SHA256, but shown as hex with the bytes reversed, as in Bitcoin. A
+  block hash below the target then reads with its leading zeros first.
+*/
+
+// HashSize The number of bytes in a Hash
+const HashSize = 32
+
+// MaxHashStringSize The number of hex characters in a Hash
+const MaxHashStringSize = HashSize * 2
+
+// ErrHashStrSize A hash string is not MaxHashStringSize characters
+var ErrHashStrSize = fmt.Errorf("hash string must be %d characters", MaxHashStringSize)
+
+// Hash A double SHA256 hash of a transaction, block header or
+// merkle tree node
+type Hash [HashSize]byte
+
+// String The hash as hex in display byte order
+func (h Hash) String() string {
+	for i := 0; i < HashSize/2; i++ {
+		h[i], h[HashSize-1-i] = h[HashSize-1-i], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
+
+// CloneBytes A copy of the bytes of the hash in stored order
+func (h *Hash) CloneBytes() []byte {
+	return append([]byte{}, h[:]...)
+}
+
+// SetBytes Set the hash from bytes in stored order. newHash must be
+// HashSize bytes
+func (h *Hash) SetBytes(newHash []byte) error {
+	if len(newHash) != HashSize {
+		return fmt.Errorf("invalid hash length of %d, want %d", len(newHash), HashSize)
+	}
+	copy(h[:], newHash)
+	return nil
+}
+
+// IsEqual True if target is the same hash. Two nil hashes are equal
+func (h *Hash) IsEqual(target *Hash) bool {
+	if h == nil && target == nil {
+		return true
+	}
+	if h == nil || target == nil {
+		return false
+	}
+	return *h == *target
+}
+
+// IsZero True for the all zero hash used where there is no hash,
+// such as the parent of the genesis block
+func (h *Hash) IsZero() bool {
+	return *h == Hash{}
+}
+
+// MarshalText The hash in display byte order, so hashes are hex strings
+// in JSON and can be JSON map keys
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText Read a hash in display byte order
+func (h *Hash) UnmarshalText(text []byte) error {
+	return Decode(h, string(text))
+}
+
+// NewHash A Hash from bytes in stored order
+func NewHash(newHash []byte) (*Hash, error) {
+	var h Hash
+	if err := h.SetBytes(newHash); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// NewHashFromStr A Hash from hex in display byte order
+func NewHashFromStr(hash string) (*Hash, error) {
+	ret := new(Hash)
+	if err := Decode(ret, hash); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Decode Decode hex in display byte order into dst
+func Decode(dst *Hash, src string) error {
+	if len(src) != MaxHashStringSize {
+		return ErrHashStrSize
+	}
+	decoded, err := hex.DecodeString(src)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < HashSize; i++ {
+		dst[i] = decoded[HashSize-1-i]
+	}
+	return nil
+}
+
+// DoubleHashH The SHA256 of the SHA256 of b
+func DoubleHashH(b []byte) Hash {
+	first := sha256.Sum256(b)
+	return Hash(sha256.Sum256(first[:]))
+}
+
+// HashH The SHA256 of b
+func HashH(b []byte) Hash {
+	return Hash(sha256.Sum256(b))
+}
@@ -0,0 +1,63 @@
+package chainhash
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHashStringDisplayOrder(t *testing.T) {
+	hash := Hash{0x01, 0x02}
+	expected := strings.Repeat("00", 30) + "0201"
+	if hash.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, hash.String())
+	}
+
+	parsed, err := NewHashFromStr(expected)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if *parsed != hash {
+		t.Errorf("Expected %v, got %v", hash, *parsed)
+	}
+}
+
+func TestNewHashFromStrRejects(t *testing.T) {
+	bad := []string{
+		"",
+		"00",
+		strings.Repeat("00", 33),
+		strings.Repeat("zz", 32),
+	}
+	for _, s := range bad {
+		if _, err := NewHashFromStr(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestNewHashRejectsLength(t *testing.T) {
+	if _, err := NewHash(make([]byte, 31)); err == nil {
+		t.Errorf("Expected an error for a 31 byte hash")
+	}
+	hash, err := NewHash(make([]byte, HashSize))
+	if err != nil || !hash.IsZero() {
+		t.Errorf("Expected the zero hash, got %v %v", hash, err)
+	}
+}
+
+func TestHashJSON(t *testing.T) {
+	hash := DoubleHashH([]byte("spchain"))
+	data, err := json.Marshal(hash)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if string(data) != `"`+hash.String()+`"` {
+		t.Errorf("Expected the hash as a string, got %s", data)
+	}
+
+	var decoded Hash
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != hash {
+		t.Errorf("Expected %s, got %s %v", hash, decoded, err)
+	}
+}
@@ -0,0 +1,44 @@
+package chainhash
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errInvalidOutPoint An outpoint string is not hash:index
+var errInvalidOutPoint = errors.New("outpoint must be hash:index")
+
+// OutPoint A reference to output Index of the transaction with Hash
+type OutPoint struct {
+	Hash  Hash
+	Index int32
+}
+
+// NewOutPoint The outpoint of output index of hash
+func NewOutPoint(hash *Hash, index int32) *OutPoint {
+	return &OutPoint{Hash: *hash, Index: index}
+}
+
+// String The outpoint as hash:index with the hash in display byte order
+func (o OutPoint) String() string {
+	return fmt.Sprintf("%s:%d", o.Hash, o.Index)
+}
+
+// NewOutPointFromStr Parse an outpoint written by String
+func NewOutPointFromStr(s string) (*OutPoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, errInvalidOutPoint
+	}
+	hash, err := NewHashFromStr(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	index, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return NewOutPoint(hash, int32(index)), nil
+}
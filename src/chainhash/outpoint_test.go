@@ -0,0 +1,21 @@
+package chainhash
+
+import "testing"
+
+func TestOutPointString(t *testing.T) {
+	outPoint := OutPoint{Hash: Hash{0xaa}, Index: 3}
+	parsed, err := NewOutPointFromStr(outPoint.String())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if *parsed != outPoint {
+		t.Errorf("Expected %s, got %s", outPoint, parsed)
+	}
+
+	bad := []string{"", "aa", outPoint.Hash.String(), outPoint.Hash.String() + ":x", "aa:1"}
+	for _, s := range bad {
+		if _, err := NewOutPointFromStr(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
@@ -2,14 +2,56 @@ package db
 
 import (
 	"bytes"
+	"errors"
+	"spchain/chainhash"
 )
 
+// ErrNotFound The requested key is not in the database
+var ErrNotFound = errors.New("not found")
+
+// UtxoBatch Changes to the utxo set which must be written atomically
+type UtxoBatch struct {
+	// Spent Outpoints removed from the utxo set
+	Spent []chainhash.OutPoint
+	// Created Serialised utxos added to the set by outpoint
+	Created map[chainhash.OutPoint]*bytes.Buffer
+	// BlockHash The block the change is for
+	BlockHash chainhash.Hash
+	// Undo Undo data saved for BlockHash. When nil any undo
+	// data for BlockHash is deleted
+	Undo *bytes.Buffer
+	// Heights Changes to the height index, height to block hash.
+	// A nil hash removes the height from the index
+	Heights map[int32]*chainhash.Hash
+	// BestBlock The serialised tip of the best chain once the
+	// batch is applied. Left unchanged when nil
+	BestBlock *bytes.Buffer
+}
+
 // DbIterface Interface for database access
 type Interface interface {
-	SaveBlock(blockHash string, buff *bytes.Buffer) error
-	// GetBlock(blockhash string) (*bytes.Buffer, error)
+	SaveBlock(blockHash chainhash.Hash, buff *bytes.Buffer) error
+	GetBlock(blockHash chainhash.Hash) (*bytes.Buffer, error)
 
-	// SaveUTXO(txHash string, buff *bytes.Buffer) error
-	// GetUTXO(txHash string) (*bytes.Buffer, error)
-}
+	// GetUtxo Returns ErrNotFound if the outpoint is not in the set
+	GetUtxo(outPoint chainhash.OutPoint) (*bytes.Buffer, error)
+	ForEachUtxo(fn func(outPoint chainhash.OutPoint, buff *bytes.Buffer) error) error
+	GetUndo(blockHash chainhash.Hash) (*bytes.Buffer, error)
+	WriteUtxoBatch(batch *UtxoBatch) error
+
+	// BlockLocation Where SaveBlock and WriteBlock store the block
+	// with blockHash
+	BlockLocation(blockHash chainhash.Hash) string
+	// WriteBlock Save a block and its metadata atomically
+	WriteBlock(blockHash chainhash.Hash, block *bytes.Buffer, meta *bytes.Buffer) error
 
+	SaveBlockMeta(blockHash chainhash.Hash, buff *bytes.Buffer) error
+	// GetBlockMeta Returns ErrNotFound if no metadata is saved for the block
+	GetBlockMeta(blockHash chainhash.Hash) (*bytes.Buffer, error)
+	ForEachBlockMeta(fn func(blockHash chainhash.Hash, buff *bytes.Buffer) error) error
+	// GetBlockHashByHeight Returns ErrNotFound if no block on the best
+	// chain is at height
+	GetBlockHashByHeight(height int32) (chainhash.Hash, error)
+	// GetBestBlock Returns ErrNotFound if no block has been connected
+	GetBestBlock() (*bytes.Buffer, error)
+}
@@ -1,8 +1,10 @@
 package key
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil/base58"
 	"golang.org/x/crypto/ripemd160"
@@ -18,17 +20,59 @@ type Key struct {
 	BtcAddressString    string
 }
 
+// MainNetPubKeyHashAddrID The address version byte of the main network.
+// Networks set their own in chaincfg.Params.PubKeyHashAddrID
+const MainNetPubKeyHashAddrID = byte(0x00)
+
+// MainNetScriptHashAddrID The pay to script hash address version byte
+// of the main network. Networks set their own in
+// chaincfg.Params.ScriptHashAddrID
+const MainNetScriptHashAddrID = byte(0x05)
+
+// AddrParams The address version bytes of a network, implemented by
+// *chaincfg.Params. key can't import chaincfg as the genesis blocks
+// there are built with packages whose tests use key
+type AddrParams interface {
+	// PubKeyHashAddrVersion The version byte in front of pay to
+	// public key hash addresses
+	PubKeyHashAddrVersion() byte
+
+	// ScriptHashAddrVersion The version byte in front of pay to
+	// script hash addresses
+	ScriptHashAddrVersion() byte
+}
+
+// mainNetAddrParams The main network version bytes, used when no
+// AddrParams are given
+type mainNetAddrParams struct{}
+
+func (mainNetAddrParams) PubKeyHashAddrVersion() byte { return MainNetPubKeyHashAddrID }
+func (mainNetAddrParams) ScriptHashAddrVersion() byte { return MainNetScriptHashAddrID }
+
 // ImportFromPrivKeyHexString Generate a new key from a privatekey string
+// with a main network address
 func ImportFromPrivKeyHexString(s string) Key {
+	return ImportFromPrivKeyHexStringForNet(s, mainNetAddrParams{})
+}
+
+// ImportFromPrivKeyHexStringForNet Generate a new key from a privatekey
+// string with an address for the network of params
+func ImportFromPrivKeyHexStringForNet(s string, params AddrParams) Key {
 	pbytes, _ := hex.DecodeString(s)
 	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), pbytes)
-	return keyFromLibPrivKey(priv)
+	return keyFromLibPrivKey(priv, params.PubKeyHashAddrVersion())
 }
 
-// NewKey Generate a new key
+// NewKey Generate a new key with a main network address
 func NewKey() Key {
+	return NewKeyForNet(mainNetAddrParams{})
+}
+
+// NewKeyForNet Generate a new key with an address for the network
+// of params
+func NewKeyForNet(params AddrParams) Key {
 	newPrivKey, _ := btcec.NewPrivateKey(btcec.S256())
-	return keyFromLibPrivKey(newPrivKey)
+	return keyFromLibPrivKey(newPrivKey, params.PubKeyHashAddrVersion())
 }
 
 // sha256 of the byte buffer followed by ripemd160
@@ -40,18 +84,11 @@ func ripe160sha256(b []byte) []byte {
 }
 
 // keyFromLibPrivKey Create a Key from a btcec.PrivateKey
-func keyFromLibPrivKey(k *btcec.PrivateKey) Key {
+func keyFromLibPrivKey(k *btcec.PrivateKey, pubKeyHashAddrID byte) Key {
 	PubKBytes := []byte{0x02}
 	// (33 bytes, 1 byte 0x02 (y-coord is even), and 32 bytes corresponding to X coordinate)
 	PubKBytes = append(PubKBytes, k.PublicKey.X.Bytes()...)
-	PubKRipeMDBytes := ripe160sha256(PubKBytes)
-	// Add version byte in front of RIPEMD-160 hash (0x00 for Main Network)
-	PubKRipeMDBytes = append([]byte{0x00}, PubKRipeMDBytes...)
-	PubKRipeMDBytesSha256 := sha256.Sum256(PubKRipeMDBytes)
-	PubKRipeMDBytesSha256 = sha256.Sum256(PubKRipeMDBytesSha256[:])
-	PubKCheckSum := PubKRipeMDBytesSha256[:4]
-
-	BtcAddressBytes := append(PubKRipeMDBytes, PubKCheckSum...)
+	BtcAddressBytes := addressBytes(pubKeyHashAddrID, ripe160sha256(PubKBytes))
 
 	return Key{
 		PrivateKey:          k,
@@ -62,3 +99,43 @@ func keyFromLibPrivKey(k *btcec.PrivateKey) Key {
 		BtcAddressString:    base58.Encode(BtcAddressBytes),
 	}
 }
+
+// addressBytes The version byte, hash and 4 byte checksum of an address
+func addressBytes(version byte, hash []byte) []byte {
+	// Add version byte in front of RIPEMD-160 hash (0x00 for Main Network)
+	ret := append([]byte{version}, hash...)
+	checkSum := sha256.Sum256(ret)
+	checkSum = sha256.Sum256(checkSum[:])
+	return append(ret, checkSum[:4]...)
+}
+
+// DecodeAddress The version byte and hash of a base58 address
+func DecodeAddress(address string) (byte, []byte, error) {
+	b := base58.Decode(address)
+	if len(b) != 1+20+4 {
+		return 0, nil, fmt.Errorf("address %s has %d bytes, expected 25", address, len(b))
+	}
+	if !bytes.Equal(addressBytes(b[0], b[1:21]), b) {
+		return 0, nil, fmt.Errorf("address %s has an invalid checksum", address)
+	}
+	return b[0], b[1:21], nil
+}
+
+// ScriptHashAddress The base58 address paying to scriptHash, the hash
+// of a redeem script, on the network of params
+func ScriptHashAddress(scriptHash []byte, params AddrParams) string {
+	return base58.Encode(addressBytes(params.ScriptHashAddrVersion(), scriptHash))
+}
+
+// ParseScriptHashAddress The redeem script hash of a pay to script
+// hash address on the network of params
+func ParseScriptHashAddress(address string, params AddrParams) ([]byte, error) {
+	version, hash, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if version != params.ScriptHashAddrVersion() {
+		return nil, fmt.Errorf("address %s has version %#x, expected %#x", address, version, params.ScriptHashAddrVersion())
+	}
+	return hash, nil
+}
@@ -2,6 +2,7 @@ package key
 
 import (
 	"encoding/hex"
+	"spchain/chaincfg"
 	"testing"
 )
 
@@ -27,3 +28,75 @@ func TestWallet(t *testing.T) {
 		)
 	}
 }
+
+func TestWalletForNet(t *testing.T) {
+	privKeyHexString := "18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"
+	key := ImportFromPrivKeyHexStringForNet(privKeyHexString, &chaincfg.TestNetParams)
+
+	if key.BtcAddressBytes[0] != chaincfg.TestNetParams.PubKeyHashAddrID {
+		t.Errorf("Expected version byte %#x, got %#x", chaincfg.TestNetParams.PubKeyHashAddrID, key.BtcAddressBytes[0])
+	}
+
+	// Test network addresses start with m or n
+	if prefix := key.BtcAddressString[0]; prefix != 'm' && prefix != 'n' {
+		t.Errorf("Expected a test network address, got %s", key.BtcAddressString)
+	}
+
+	mainKey := ImportFromPrivKeyHexString(privKeyHexString)
+	if hex.EncodeToString(key.PublicKeyHash) != hex.EncodeToString(mainKey.PublicKeyHash) {
+		t.Errorf("The public key hash should not depend on the network")
+	}
+}
+
+func TestMainNetAddrIDs(t *testing.T) {
+	main := &chaincfg.MainNetParams
+	if main.PubKeyHashAddrID != MainNetPubKeyHashAddrID || main.ScriptHashAddrID != MainNetScriptHashAddrID {
+		t.Errorf("The main network version bytes do not match chaincfg.MainNetParams")
+	}
+	if NewKeyForNet(&chaincfg.RegressionNetParams).BtcAddressBytes[0] != chaincfg.RegressionNetParams.PubKeyHashAddrID {
+		t.Errorf("Expected a regression test network address")
+	}
+}
+
+func TestDecodeAddress(t *testing.T) {
+	version, hash, err := DecodeAddress("1PMycacnJaSqwwJqjawXBErnLsZ7RkXUAs")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if version != MainNetPubKeyHashAddrID || hex.EncodeToString(hash) != "f54a5851e9372b87810a8e60cdd2e7cfd80b6e31" {
+		t.Errorf("Unexpected version %#x and hash %x", version, hash)
+	}
+
+	bad := []string{"1PMycacnJaSqwwJqjawXBErnLsZ7RkXUAt", "1PMycacnJaSq", ""}
+	for _, address := range bad {
+		if _, _, err := DecodeAddress(address); err == nil {
+			t.Errorf("Expected an error for %s", address)
+		}
+	}
+}
+
+func TestScriptHashAddress(t *testing.T) {
+	scriptHash, _ := hex.DecodeString("f54a5851e9372b87810a8e60cdd2e7cfd80b6e31")
+
+	address := ScriptHashAddress(scriptHash, &chaincfg.MainNetParams)
+	if address[0] != '3' {
+		t.Errorf("Expected a main network script hash address, got %s", address)
+	}
+	parsed, err := ParseScriptHashAddress(address, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if hex.EncodeToString(parsed) != hex.EncodeToString(scriptHash) {
+		t.Errorf("Expected hash %x, got %x", scriptHash, parsed)
+	}
+
+	// Test network addresses start with 2
+	if address := ScriptHashAddress(scriptHash, &chaincfg.TestNetParams); address[0] != '2' {
+		t.Errorf("Expected a test network script hash address, got %s", address)
+	}
+
+	// A public key hash address is not a script hash address
+	if _, err := ParseScriptHashAddress("1PMycacnJaSqwwJqjawXBErnLsZ7RkXUAs", &chaincfg.MainNetParams); err == nil {
+		t.Errorf("Expected an error for a public key hash address")
+	}
+}
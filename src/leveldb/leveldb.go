@@ -1,10 +1,25 @@
 package leveldb
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
   "github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"spchain/chainhash"
+	"spchain/db"
+	"strconv"
+	"strings"
 )
 
+// utxoPrefix Prefix of every utxo key
+const utxoPrefix = "u_"
+
+// metaPrefix Prefix of every block metadata key
+const metaPrefix = "m_"
+
+// bestBlockKey Key of the tip of the best chain
+const bestBlockKey = "best"
+
 type LevelDb struct {
 	Db *leveldb.DB
 }
@@ -19,17 +34,46 @@ func InitDatabaseAtPath(path string) (LevelDb, error) {
 	return LevelDb { Db: db, }, nil
 }
 
-func blockId(blockhash string) string {
-	return fmt.Sprintf("b_%s", blockhash)
+// hashKey The hash in keys and values, hex in stored byte order
+func hashKey(hash chainhash.Hash) string {
+	return hex.EncodeToString(hash[:])
+}
+
+// parseHashKey Read a hash written by hashKey
+func parseHashKey(key string) (chainhash.Hash, error) {
+	var hash chainhash.Hash
+	b, err := hex.DecodeString(key)
+	if err != nil {
+		return hash, err
+	}
+	err = hash.SetBytes(b)
+	return hash, err
+}
+
+func blockId(blockHash chainhash.Hash) string {
+	return fmt.Sprintf("b_%s", hashKey(blockHash))
 }
 
 // SaveBlock Save a block to the database
-func (db LevelDb) SaveBlock(blockhash string, buff *bytes.Buffer) error {
-	return db.Db.Put([]byte(blockId(blockhash)), buff.Bytes(), nil)
+func (db LevelDb) SaveBlock(blockHash chainhash.Hash, buff *bytes.Buffer) error {
+	return db.Db.Put([]byte(blockId(blockHash)), buff.Bytes(), nil)
+}
+
+// BlockLocation The key a block is saved under
+func (db LevelDb) BlockLocation(blockHash chainhash.Hash) string {
+	return blockId(blockHash)
+}
+
+// WriteBlock Save a block and its metadata in one batch
+func (db LevelDb) WriteBlock(blockHash chainhash.Hash, block *bytes.Buffer, meta *bytes.Buffer) error {
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(blockId(blockHash)), block.Bytes())
+	batch.Put([]byte(metaId(blockHash)), meta.Bytes())
+	return db.Db.Write(batch, nil)
 }
 
 // Get a Block
-func (db LevelDb) GetBlock(blockHash string) (*bytes.Buffer, error) {
+func (db LevelDb) GetBlock(blockHash chainhash.Hash) (*bytes.Buffer, error) {
   data, err := db.Db.Get([]byte(blockId(blockHash)), nil)
 	if err != nil {
 		return &bytes.Buffer{}, err
@@ -37,6 +81,149 @@ func (db LevelDb) GetBlock(blockHash string) (*bytes.Buffer, error) {
 	return bytes.NewBuffer(data), nil
 }
 
+// outPointKey The outpoint in keys, the hash key and output index
+func outPointKey(outPoint chainhash.OutPoint) string {
+	return fmt.Sprintf("%s:%d", hashKey(outPoint.Hash), outPoint.Index)
+}
+
+// parseOutPointKey Read an outpoint written by outPointKey
+func parseOutPointKey(key string) (chainhash.OutPoint, error) {
+	parts := strings.Split(key, ":")
+	if len(parts) != 2 {
+		return chainhash.OutPoint{}, fmt.Errorf("invalid outpoint %s", key)
+	}
+	hash, err := parseHashKey(parts[0])
+	if err != nil {
+		return chainhash.OutPoint{}, err
+	}
+	index, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return chainhash.OutPoint{}, err
+	}
+	return chainhash.OutPoint{Hash: hash, Index: int32(index)}, nil
+}
+
+func utxoId(outPoint chainhash.OutPoint) string {
+	return fmt.Sprintf("%s%s", utxoPrefix, outPointKey(outPoint))
+}
+
+func undoId(blockHash chainhash.Hash) string {
+	return fmt.Sprintf("r_%s", hashKey(blockHash))
+}
+
+// get Read a key mapping leveldb.ErrNotFound to db.ErrNotFound
+func (ldb LevelDb) get(key string) (*bytes.Buffer, error) {
+	data, err := ldb.Db.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return &bytes.Buffer{}, db.ErrNotFound
+	}
+	if err != nil {
+		return &bytes.Buffer{}, err
+	}
+	return bytes.NewBuffer(data), nil
+}
+
+// GetUtxo Get a serialised utxo by outpoint
+func (ldb LevelDb) GetUtxo(outPoint chainhash.OutPoint) (*bytes.Buffer, error) {
+	return ldb.get(utxoId(outPoint))
+}
+
+// ForEachUtxo Call fn with every utxo in the set
+func (ldb LevelDb) ForEachUtxo(fn func(outPoint chainhash.OutPoint, buff *bytes.Buffer) error) error {
+	iter := ldb.Db.NewIterator(util.BytesPrefix([]byte(utxoPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		outPoint, err := parseOutPointKey(string(iter.Key()[len(utxoPrefix):]))
+		if err != nil {
+			return err
+		}
+		value := append([]byte{}, iter.Value()...)
+		if err := fn(outPoint, bytes.NewBuffer(value)); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// GetUndo Get the undo data saved when a block was connected
+func (ldb LevelDb) GetUndo(blockHash chainhash.Hash) (*bytes.Buffer, error) {
+	return ldb.get(undoId(blockHash))
+}
 
+// WriteUtxoBatch Apply changes to the utxo set and undo data atomically
+func (ldb LevelDb) WriteUtxoBatch(b *db.UtxoBatch) error {
+	batch := new(leveldb.Batch)
+	for _, outPoint := range b.Spent {
+		batch.Delete([]byte(utxoId(outPoint)))
+	}
+	for outPoint, buff := range b.Created {
+		batch.Put([]byte(utxoId(outPoint)), buff.Bytes())
+	}
+	if b.Undo != nil {
+		batch.Put([]byte(undoId(b.BlockHash)), b.Undo.Bytes())
+	} else {
+		batch.Delete([]byte(undoId(b.BlockHash)))
+	}
+	for height, blockHash := range b.Heights {
+		if blockHash == nil {
+			batch.Delete([]byte(heightId(height)))
+		} else {
+			batch.Put([]byte(heightId(height)), []byte(hashKey(*blockHash)))
+		}
+	}
+	if b.BestBlock != nil {
+		batch.Put([]byte(bestBlockKey), b.BestBlock.Bytes())
+	}
+	return ldb.Db.Write(batch, nil)
+}
 
+func metaId(blockHash chainhash.Hash) string {
+	return fmt.Sprintf("%s%s", metaPrefix, hashKey(blockHash))
+}
 
+func heightId(height int32) string {
+	return fmt.Sprintf("h_%d", height)
+}
+
+// SaveBlockMeta Save the metadata of a block
+func (ldb LevelDb) SaveBlockMeta(blockHash chainhash.Hash, buff *bytes.Buffer) error {
+	return ldb.Db.Put([]byte(metaId(blockHash)), buff.Bytes(), nil)
+}
+
+// GetBlockMeta Get the metadata of a block
+func (ldb LevelDb) GetBlockMeta(blockHash chainhash.Hash) (*bytes.Buffer, error) {
+	return ldb.get(metaId(blockHash))
+}
+
+// ForEachBlockMeta Call fn with the metadata of every block
+func (ldb LevelDb) ForEachBlockMeta(fn func(blockHash chainhash.Hash, buff *bytes.Buffer) error) error {
+	iter := ldb.Db.NewIterator(util.BytesPrefix([]byte(metaPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		blockHash, err := parseHashKey(string(iter.Key()[len(metaPrefix):]))
+		if err != nil {
+			return err
+		}
+		value := append([]byte{}, iter.Value()...)
+		if err := fn(blockHash, bytes.NewBuffer(value)); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// GetBlockHashByHeight Get the hash of the block at height on the best chain
+func (ldb LevelDb) GetBlockHashByHeight(height int32) (chainhash.Hash, error) {
+	buff, err := ldb.get(heightId(height))
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return parseHashKey(buff.String())
+}
+
+// GetBestBlock Get the serialised tip of the best chain
+func (ldb LevelDb) GetBestBlock() (*bytes.Buffer, error) {
+	return ldb.get(bestBlockKey)
+}
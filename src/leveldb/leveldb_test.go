@@ -1,13 +1,21 @@
 package leveldb
 
 import (
+	"bytes"
 	"os"
 	"testing"
 	"spchain/internal"
 	"spchain/chain"
-	"github.com/davecgh/go-spew/spew"
+	"spchain/chainhash"
+	"spchain/db"
 )
 
+var testBlockHash = chainhash.Hash{0xbb}
+
+func testOutPoint(index int32) chainhash.OutPoint {
+	return chainhash.OutPoint{Hash: chainhash.Hash{0xaa}, Index: index}
+}
+
 var testDbPath = "/tmp/spchain-test"
 
 func resetDb() {
@@ -36,19 +44,174 @@ func TestSaveBlock( t *testing.T) {
 	}
 
 	block := internal.BlockWithCoinBase()
-	hashStr := block.HashString()
+	hash := block.Hash()
 
-	saveErr := db.SaveBlock(hashStr, block.Ser())
+	saveErr := db.SaveBlock(hash, block.Ser())
 	if saveErr != nil {
 		t.Errorf("Got error attempting to save database %s", saveErr)
 	}
 
-	getBlock, getError := chain.GetBlock(hashStr, &db)
+	getBlock, getError := chain.GetBlock(hash, &db)
 	if getError != nil {
 		t.Errorf("Got error attempting to retrieve  block%s", getError)
 	}
 
-	if getBlock.HashString() != block.HashString() {
-		t.Errorf("Expected %s block hash got %s", getBlock.HashString(), block.HashString())
+	if getBlock.Hash() != hash {
+		t.Errorf("Expected %s block hash got %s", hash, getBlock.Hash())
+	}
+}
+
+func TestUtxoBatch(t *testing.T) {
+	resetDb()
+
+	ldb, err := InitDatabaseAtPath(testDbPath)
+	if err != nil {
+		t.Fatalf("Got error attempting to open database %s", err)
+	}
+	defer ldb.Db.Close()
+
+	utxo := chain.Utxo{Value: 100, ScriptPubKey: []byte{1, 2}, Height: 3}
+	batch := db.UtxoBatch{
+		Created: map[chainhash.OutPoint]*bytes.Buffer{
+			testOutPoint(0): utxo.Ser(),
+			testOutPoint(1): utxo.Ser(),
+		},
+		BlockHash: testBlockHash,
+		Undo:      bytes.NewBuffer([]byte{1, 2, 3}),
+	}
+	if err := ldb.WriteUtxoBatch(&batch); err != nil {
+		t.Fatalf("Got error writing batch %s", err)
+	}
+
+	buff, err := ldb.GetUtxo(testOutPoint(1))
+	if err != nil {
+		t.Fatalf("Got error getting utxo %s", err)
+	}
+	if got, err := chain.DeserialiseUtxo(buff); err != nil || got.Value != 100 {
+		t.Errorf("Expected value %d, got %d", 100, got.Value)
+	}
+
+	undo, err := ldb.GetUndo(testBlockHash)
+	if err != nil || !bytes.Equal(undo.Bytes(), []byte{1, 2, 3}) {
+		t.Errorf("Expected undo data, got %v %v", undo.Bytes(), err)
+	}
+
+	spend := db.UtxoBatch{Spent: []chainhash.OutPoint{testOutPoint(0)}, BlockHash: testBlockHash}
+	if err := ldb.WriteUtxoBatch(&spend); err != nil {
+		t.Fatalf("Got error writing batch %s", err)
+	}
+
+	if _, err := ldb.GetUtxo(testOutPoint(0)); err != db.ErrNotFound {
+		t.Errorf("Expected %s, got %v", db.ErrNotFound, err)
+	}
+	if _, err := ldb.GetUndo(testBlockHash); err != db.ErrNotFound {
+		t.Errorf("Expected undo data to be deleted, got %v", err)
+	}
+
+	outPoints := []chainhash.OutPoint{}
+	ldb.ForEachUtxo(func(outPoint chainhash.OutPoint, buff *bytes.Buffer) error {
+		outPoints = append(outPoints, outPoint)
+		return nil
+	})
+	if len(outPoints) != 1 || outPoints[0] != testOutPoint(1) {
+		t.Errorf("Expected only %s in the utxo set, got %v", testOutPoint(1), outPoints)
+	}
+}
+
+func TestChainState(t *testing.T) {
+	resetDb()
+	defer resetDb()
+	ldb, err := InitDatabaseAtPath(testDbPath)
+	if err != nil {
+		t.Fatalf("Got error attempting to open database %s", err)
+	}
+	defer ldb.Db.Close()
+
+	if _, err := ldb.GetBestBlock(); err != db.ErrNotFound {
+		t.Errorf("Expected %s, got %v", db.ErrNotFound, err)
+	}
+
+	batch := db.UtxoBatch{
+		BlockHash: testBlockHash,
+		Heights:   map[int32]*chainhash.Hash{1: &testBlockHash},
+		BestBlock: bytes.NewBuffer([]byte{4, 5}),
+	}
+	if err := ldb.WriteUtxoBatch(&batch); err != nil {
+		t.Fatalf("Got error writing batch %s", err)
+	}
+	if hash, err := ldb.GetBlockHashByHeight(1); err != nil || hash != testBlockHash {
+		t.Errorf("Expected %s at height 1, got %s %v", testBlockHash, hash, err)
+	}
+	if best, err := ldb.GetBestBlock(); err != nil || !bytes.Equal(best.Bytes(), []byte{4, 5}) {
+		t.Errorf("Expected best block, got %v %v", best.Bytes(), err)
+	}
+
+	remove := db.UtxoBatch{BlockHash: testBlockHash, Heights: map[int32]*chainhash.Hash{1: nil}}
+	if err := ldb.WriteUtxoBatch(&remove); err != nil {
+		t.Fatalf("Got error writing batch %s", err)
+	}
+	if _, err := ldb.GetBlockHashByHeight(1); err != db.ErrNotFound {
+		t.Errorf("Expected height 1 to be removed, got %v", err)
+	}
+	if best, _ := ldb.GetBestBlock(); !bytes.Equal(best.Bytes(), []byte{4, 5}) {
+		t.Errorf("Expected the best block to be unchanged")
+	}
+
+	if err := ldb.SaveBlockMeta(testBlockHash, bytes.NewBuffer([]byte{7})); err != nil {
+		t.Fatalf("Got error saving meta %s", err)
+	}
+	if meta, err := ldb.GetBlockMeta(testBlockHash); err != nil || !bytes.Equal(meta.Bytes(), []byte{7}) {
+		t.Errorf("Expected block meta, got %v %v", meta.Bytes(), err)
+	}
+}
+
+func TestWriteBlock(t *testing.T) {
+	resetDb()
+	defer resetDb()
+	ldb, err := InitDatabaseAtPath(testDbPath)
+	if err != nil {
+		t.Fatalf("Got error attempting to open database %s", err)
+	}
+	defer ldb.Db.Close()
+
+	other := chainhash.Hash{0x0b}
+	if err := ldb.WriteBlock(testBlockHash, bytes.NewBuffer([]byte{1, 2}), bytes.NewBuffer([]byte{3})); err != nil {
+		t.Fatalf("Got error writing block %s", err)
+	}
+	if err := ldb.WriteBlock(other, bytes.NewBuffer([]byte{4}), bytes.NewBuffer([]byte{5})); err != nil {
+		t.Fatalf("Got error writing block %s", err)
+	}
+	if block, err := ldb.GetBlock(testBlockHash); err != nil || !bytes.Equal(block.Bytes(), []byte{1, 2}) {
+		t.Errorf("Expected the block, got %v %v", block.Bytes(), err)
+	}
+	if ldb.BlockLocation(testBlockHash) != blockId(testBlockHash) {
+		t.Errorf("Expected the block to be stored under %s", blockId(testBlockHash))
+	}
+
+	metas := map[chainhash.Hash][]byte{}
+	err = ldb.ForEachBlockMeta(func(blockHash chainhash.Hash, buff *bytes.Buffer) error {
+		metas[blockHash] = buff.Bytes()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(metas) != 2 || !bytes.Equal(metas[testBlockHash], []byte{3}) || !bytes.Equal(metas[other], []byte{5}) {
+		t.Errorf("Expected the metadata of both blocks, got %v", metas)
+	}
+}
+
+func TestOutPointKey(t *testing.T) {
+	outPoint := testOutPoint(5)
+	parsed, err := parseOutPointKey(outPointKey(outPoint))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if parsed != outPoint {
+		t.Errorf("Expected %s, got %s", outPoint, parsed)
+	}
+
+	if _, err := parseOutPointKey("nonsense"); err == nil {
+		t.Errorf("Expected error parsing an invalid outpoint")
 	}
 }
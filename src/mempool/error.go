@@ -0,0 +1,78 @@
+package mempool
+
+// ErrorCode Identifies why the pool refused a transaction
+type ErrorCode int
+
+const (
+	// ErrDuplicate The transaction is already in the pool or
+	// the orphan pool
+	ErrDuplicate ErrorCode = iota
+
+	// ErrCoinbase Coinbase transactions only exist in blocks
+	ErrCoinbase
+
+	// ErrConflict An input spends an output already spent by a
+	// transaction in the pool which does not signal replaceability
+	ErrConflict
+
+	// ErrReplacementFee A replacement does not pay a higher fee and fee
+	// rate than the transactions it evicts
+	ErrReplacementFee
+
+	// ErrTooManyReplacements A replacement would evict more than
+	// MaxReplacementEvictions transactions
+	ErrTooManyReplacements
+
+	// ErrReplacementInputs A replacement spends an output of a
+	// transaction it evicts, or an unconfirmed output the transactions
+	// it replaces did not spend
+	ErrReplacementInputs
+
+	// ErrNonFinal The LockTime of the transaction does not allow it
+	// in the next block
+	ErrNonFinal
+
+	// ErrOrphanTooLarge The transaction spends unknown outputs and is
+	// too large to keep until they arrive
+	ErrOrphanTooLarge
+
+	// ErrPoolFull The transaction pays too low a fee rate to stay in
+	// the pool once it is trimmed to its maximum size
+	ErrPoolFull
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrDuplicate:           "ErrDuplicate",
+	ErrCoinbase:            "ErrCoinbase",
+	ErrConflict:            "ErrConflict",
+	ErrReplacementFee:      "ErrReplacementFee",
+	ErrTooManyReplacements: "ErrTooManyReplacements",
+	ErrReplacementInputs:   "ErrReplacementInputs",
+	ErrNonFinal:            "ErrNonFinal",
+	ErrOrphanTooLarge:      "ErrOrphanTooLarge",
+	ErrPoolFull:            "ErrPoolFull",
+}
+
+// String The name of the error code
+func (e ErrorCode) String() string {
+	if s, ok := errorCodeStrings[e]; ok {
+		return s
+	}
+	return "Unknown ErrorCode"
+}
+
+// TxRuleError The pool refused a transaction. Consensus failures are
+// returned as the *blockchain.RuleError from validation instead
+type TxRuleError struct {
+	Code ErrorCode
+	Msg  string
+}
+
+func (e *TxRuleError) Error() string {
+	return e.Msg
+}
+
+// txRuleError Create a TxRuleError
+func txRuleError(code ErrorCode, msg string) *TxRuleError {
+	return &TxRuleError{Code: code, Msg: msg}
+}
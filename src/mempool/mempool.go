@@ -0,0 +1,809 @@
+package mempool
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"spchain/blockchain"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"sync"
+	"time"
+)
+
+/*
+  The pool keeps transactions which are valid on top of the best chain
+  but not yet in a block. Each one is validated against the utxo set of
+  the best chain plus the outputs of the transactions already in the
+  pool, so a transaction can spend the outputs of an unconfirmed parent.
+
+  Transactions spending outputs which are unknown are parked as orphans
+  until their parents arrive. The pool follows the best chain through
+  ChainNotification, dropping transactions which are confirmed or
+  conflict with a new block and taking back the transactions of
+  disconnected blocks.
+*/
+
+const (
+	// DefaultMaxSize The default limit on the total serialised size of
+	// the transactions in the pool
+	DefaultMaxSize = 300 * 1000 * 1000
+
+	// DefaultMaxOrphans The default number of orphans kept
+	DefaultMaxOrphans = 100
+
+	// maxOrphanTxSize The largest orphan kept. Orphans can't be
+	// validated, so large ones are refused
+	maxOrphanTxSize = 100000
+)
+
+// ChainState The best chain the pool validates against.
+// Implemented by *blockchain.BlockChain
+type ChainState interface {
+	blockchain.UtxoViewer
+	Params() *chaincfg.Params
+	BestHash() chainhash.Hash
+	BestHeight() int32
+	MedianTimePast() (int64, error)
+	HeaderByHeight(height int32) (*chain.BlockHeader, error)
+	NextRequiredDifficulty(prevHash chainhash.Hash) (uint32, error)
+}
+
+// Config Settings of the pool
+type Config struct {
+	Chain ChainState
+	// MaxSize The limit on the total serialised size of the pool.
+	// Defaults to DefaultMaxSize
+	MaxSize int64
+	// MaxOrphans The number of orphans kept. Defaults to
+	// DefaultMaxOrphans
+	MaxOrphans int
+}
+
+// TxDesc A transaction in the pool
+type TxDesc struct {
+	Tx   chain.Tx
+	Hash chainhash.Hash
+	// Fee The inputs less the outputs
+	Fee int64
+	// Size The serialised size
+	Size int64
+	// Added When the transaction entered the pool
+	Added time.Time
+	// Height The best chain height when the transaction entered the pool
+	Height int32
+
+	// parents and children The transactions in the pool this one
+	// spends from and which spend from it
+	parents  map[chainhash.Hash]*TxDesc
+	children map[chainhash.Hash]*TxDesc
+
+	// descendantFee and descendantSize The fees and sizes of this
+	// transaction and every transaction in the pool spending from it,
+	// which are evicted together
+	descendantFee  int64
+	descendantSize int64
+}
+
+// FeeRate The fee paid per 1000 bytes
+func (d *TxDesc) FeeRate() int64 {
+	return feeRate(d.Fee, d.Size)
+}
+
+// feeRate The fee per 1000 bytes of size
+func feeRate(fee int64, size int64) int64 {
+	if size == 0 {
+		return 0
+	}
+	return fee * 1000 / size
+}
+
+// orphanTx A transaction waiting for its parents
+type orphanTx struct {
+	tx    *chain.Tx
+	hash  chainhash.Hash
+	added time.Time
+}
+
+// TxPool The pool of unconfirmed transactions. Safe for concurrent use
+type TxPool struct {
+	cfg Config
+
+	mtx  sync.RWMutex
+	pool map[chainhash.Hash]*TxDesc
+	// outpoints The pool transaction spending each output
+	outpoints map[chainhash.OutPoint]*TxDesc
+	totalSize int64
+	// evictions The transactions in the pool by the fee rate of their
+	// descendants, lowest first
+	evictions evictionHeap
+
+	orphans map[chainhash.Hash]*orphanTx
+	// orphansByPrev The orphans spending each output
+	orphansByPrev map[chainhash.OutPoint]map[chainhash.Hash]*orphanTx
+}
+
+// New Create an empty pool
+func New(cfg *Config) *TxPool {
+	c := *cfg
+	if c.MaxSize == 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if c.MaxOrphans == 0 {
+		c.MaxOrphans = DefaultMaxOrphans
+	}
+	return &TxPool{
+		cfg:           c,
+		pool:          map[chainhash.Hash]*TxDesc{},
+		outpoints:     map[chainhash.OutPoint]*TxDesc{},
+		orphans:       map[chainhash.Hash]*orphanTx{},
+		orphansByPrev: map[chainhash.OutPoint]map[chainhash.Hash]*orphanTx{},
+	}
+}
+
+// poolView A UtxoViewer over the best chain and the outputs of the
+// transactions in the pool, which are given the height of the next block
+type poolView struct {
+	mp     *TxPool
+	height int32
+}
+
+// LookupUtxo Implements blockchain.UtxoViewer
+func (v *poolView) LookupUtxo(outPoint chainhash.OutPoint) (*chain.Utxo, error) {
+	if desc, ok := v.mp.pool[outPoint.Hash]; ok {
+		if outPoint.Index < 0 || int(outPoint.Index) >= len(desc.Tx.Vout) {
+			return nil, nil
+		}
+		out := desc.Tx.Vout[outPoint.Index]
+		return &chain.Utxo{Value: out.Value, ScriptPubKey: out.ScriptPubKey, Height: v.height}, nil
+	}
+	return v.mp.cfg.Chain.LookupUtxo(outPoint)
+}
+
+// ProcessTransaction Validate tx and add it to the pool. A transaction
+// spending unknown outputs is kept as an orphan. Orphans which only
+// needed tx are accepted too.
+// Returns the transactions added to the pool, none for an orphan
+func (mp *TxPool) ProcessTransaction(tx *chain.Tx) ([]*TxDesc, error) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	missing, desc, err := mp.maybeAcceptTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, mp.maybeAddOrphan(tx)
+	}
+
+	accepted := []*TxDesc{desc}
+	return append(accepted, mp.processOrphans([]*chain.Tx{tx})...), nil
+}
+
+// maybeAcceptTransaction Add tx to the pool if it is valid on top of
+// the best chain. Returns the parents of tx which are unknown instead
+// when there are any
+func (mp *TxPool) maybeAcceptTransaction(tx *chain.Tx) ([]chainhash.Hash, *TxDesc, error) {
+	hash := tx.Hash()
+	if _, ok := mp.pool[hash]; ok {
+		return nil, nil, txRuleError(ErrDuplicate, fmt.Sprintf("Already have transaction %s", hash))
+	}
+	if _, ok := mp.orphans[hash]; ok {
+		return nil, nil, txRuleError(ErrDuplicate, fmt.Sprintf("Already have orphan %s", hash))
+	}
+	if tx.IsCoinBase() {
+		return nil, nil, txRuleError(ErrCoinbase, fmt.Sprintf("Transaction %s is a coinbase", hash))
+	}
+
+	if err := blockchain.CheckTransactionSanity(tx); err != nil {
+		return nil, nil, err
+	}
+
+	// Any unspent output means the transaction is already in the chain
+	for i := range tx.Vout {
+		utxo, err := mp.cfg.Chain.LookupUtxo(chainhash.OutPoint{Hash: hash, Index: int32(i)})
+		if err != nil {
+			return nil, nil, err
+		}
+		if utxo != nil {
+			return nil, nil, txRuleError(ErrDuplicate, fmt.Sprintf("Transaction %s is already in the chain", hash))
+		}
+	}
+
+	conflicts, err := mp.findConflicts(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	height := mp.cfg.Chain.BestHeight() + 1
+	medianTime, err := mp.cfg.Chain.MedianTimePast()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !tx.IsFinal(height, medianTime) {
+		return nil, nil, txRuleError(
+			ErrNonFinal,
+			fmt.Sprintf("Transaction %s has LockTime %d which is not reached by the next block", hash, uint32(tx.LockTime)),
+		)
+	}
+
+	view := &poolView{mp: mp, height: height}
+	missing := []chainhash.Hash{}
+	for i := range tx.Vin {
+		in := &tx.Vin[i]
+		utxo, err := view.LookupUtxo(in.PreviousOutPoint())
+		if err != nil {
+			return nil, nil, err
+		}
+		if utxo == nil {
+			missing = append(missing, in.Txid)
+		}
+	}
+	if len(missing) > 0 {
+		return missing, nil, nil
+	}
+
+	if err := blockchain.CheckSequenceLocks(tx, view, height, medianTime, mp.cfg.Chain.HeaderByHeight); err != nil {
+		return nil, nil, err
+	}
+
+	fee, err := blockchain.ValidateTx(tx, view, height, mp.cfg.Chain.Params())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	removed := []*TxDesc{}
+	if len(conflicts) > 0 {
+		evicted, err := mp.checkReplacement(tx, fee, conflicts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, desc := range evicted {
+			mp.removeTransaction(desc, false)
+			removed = append(removed, desc)
+		}
+	}
+
+	desc := mp.addTransaction(tx, hash, fee, height-1)
+	// A transaction back from a disconnected block can have children
+	// in the pool, which go if it goes
+	dropped := descendants(desc, map[chainhash.Hash]*TxDesc{})
+	removed = append(removed, mp.trimToSize()...)
+	if _, ok := mp.pool[hash]; !ok {
+		// Put back everything removed to make room, so a replacement
+		// which can't stay doesn't lose what it replaced as well
+		for _, d := range removed {
+			if _, ok := dropped[d.Hash]; !ok {
+				mp.insertTransaction(d)
+			}
+		}
+		return nil, nil, txRuleError(
+			ErrPoolFull,
+			fmt.Sprintf("Transaction %s fee rate %d is too low for the full pool", hash, desc.FeeRate()),
+		)
+	}
+	return nil, desc, nil
+}
+
+// addTransaction Add a validated transaction and link it to its
+// parents and children in the pool
+func (mp *TxPool) addTransaction(tx *chain.Tx, hash chainhash.Hash, fee int64, height int32) *TxDesc {
+	desc := &TxDesc{
+		Tx:     *tx,
+		Hash:   hash,
+		Fee:    fee,
+		Size:   int64(tx.Serialise().Len()),
+		Added:  time.Now(),
+		Height: height,
+	}
+	mp.insertTransaction(desc)
+	return desc
+}
+
+// insertTransaction Put desc in the pool and link it to its parents
+// and children in the pool
+func (mp *TxPool) insertTransaction(desc *TxDesc) {
+	tx := &desc.Tx
+	hash := desc.Hash
+	desc.parents = map[chainhash.Hash]*TxDesc{}
+	desc.children = map[chainhash.Hash]*TxDesc{}
+
+	for i := range tx.Vin {
+		op := tx.Vin[i].PreviousOutPoint()
+		mp.outpoints[op] = desc
+		if parent, ok := mp.pool[op.Hash]; ok {
+			desc.parents[parent.Hash] = parent
+			parent.children[hash] = desc
+		}
+	}
+
+	// Children are already in the pool when a transaction comes back
+	// from a disconnected block
+	for i := range tx.Vout {
+		if child, ok := mp.outpoints[chainhash.OutPoint{Hash: hash, Index: int32(i)}]; ok {
+			desc.children[child.Hash] = child
+			child.parents[hash] = desc
+		}
+	}
+
+	mp.pool[hash] = desc
+	mp.totalSize += desc.Size
+
+	// Without children desc adds just itself to each ancestor, otherwise
+	// some of its descendants may already be counted by an ancestor
+	desc.descendantFee = desc.Fee
+	desc.descendantSize = desc.Size
+	for _, ancestor := range ancestors(desc, map[chainhash.Hash]*TxDesc{}) {
+		if len(desc.children) > 0 {
+			ancestor.updateDescendantTotals()
+		} else if ancestor != desc {
+			ancestor.descendantFee += desc.Fee
+			ancestor.descendantSize += desc.Size
+		}
+		mp.pushEviction(ancestor)
+	}
+}
+
+// removeTransaction Remove desc from the pool, with every transaction
+// spending from it if removeDescendants is set
+func (mp *TxPool) removeTransaction(desc *TxDesc, removeDescendants bool) {
+	if removeDescendants {
+		for _, child := range desc.children {
+			mp.removeTransaction(child, true)
+		}
+	}
+	ancestors := ancestors(desc, map[chainhash.Hash]*TxDesc{})
+	delete(ancestors, desc.Hash)
+	hasChildren := len(desc.children) > 0
+
+	for i := range desc.Tx.Vin {
+		op := desc.Tx.Vin[i].PreviousOutPoint()
+		if mp.outpoints[op] == desc {
+			delete(mp.outpoints, op)
+		}
+	}
+	for _, parent := range desc.parents {
+		delete(parent.children, desc.Hash)
+	}
+	for _, child := range desc.children {
+		delete(child.parents, desc.Hash)
+	}
+
+	delete(mp.pool, desc.Hash)
+	mp.totalSize -= desc.Size
+
+	// The children left behind may still be descendants of an ancestor
+	// through another parent
+	for _, ancestor := range ancestors {
+		if hasChildren {
+			ancestor.updateDescendantTotals()
+		} else {
+			ancestor.descendantFee -= desc.Fee
+			ancestor.descendantSize -= desc.Size
+		}
+		mp.pushEviction(ancestor)
+	}
+}
+
+// descendants desc and every transaction in the pool spending from it
+func descendants(desc *TxDesc, seen map[chainhash.Hash]*TxDesc) map[chainhash.Hash]*TxDesc {
+	if _, ok := seen[desc.Hash]; ok {
+		return seen
+	}
+	seen[desc.Hash] = desc
+	for _, child := range desc.children {
+		descendants(child, seen)
+	}
+	return seen
+}
+
+// ancestors desc and every transaction in the pool it spends from
+func ancestors(desc *TxDesc, seen map[chainhash.Hash]*TxDesc) map[chainhash.Hash]*TxDesc {
+	if _, ok := seen[desc.Hash]; ok {
+		return seen
+	}
+	seen[desc.Hash] = desc
+	for _, parent := range desc.parents {
+		ancestors(parent, seen)
+	}
+	return seen
+}
+
+// updateDescendantTotals Count again the fees and sizes of desc and
+// its descendants
+func (d *TxDesc) updateDescendantTotals() {
+	d.descendantFee = 0
+	d.descendantSize = 0
+	for _, desc := range descendants(d, map[chainhash.Hash]*TxDesc{}) {
+		d.descendantFee += desc.Fee
+		d.descendantSize += desc.Size
+	}
+}
+
+// evictionEntry The descendant totals of desc when it was pushed
+type evictionEntry struct {
+	desc *TxDesc
+	fee  int64
+	size int64
+}
+
+// evictionHeap A min heap of evictionEntry by fee rate. Entries are
+// not removed when the totals of a transaction change, a new entry is
+// pushed instead and the stale ones are skipped when popped
+type evictionHeap []evictionEntry
+
+func (h evictionHeap) Len() int { return len(h) }
+
+func (h evictionHeap) Less(i, j int) bool {
+	ri := feeRate(h[i].fee, h[i].size)
+	rj := feeRate(h[j].fee, h[j].size)
+	if ri != rj {
+		return ri < rj
+	}
+	// Break ties on the hash so eviction is deterministic
+	return bytes.Compare(h[i].desc.Hash[:], h[j].desc.Hash[:]) < 0
+}
+
+func (h evictionHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *evictionHeap) Push(x interface{}) { *h = append(*h, x.(evictionEntry)) }
+
+func (h *evictionHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// pushEviction Record the current descendant totals of desc. The heap
+// is rebuilt from the pool when stale entries outnumber the live ones
+func (mp *TxPool) pushEviction(desc *TxDesc) {
+	if len(mp.evictions) > 2*len(mp.pool)+16 {
+		mp.evictions = mp.evictions[:0]
+		for _, d := range mp.pool {
+			mp.evictions = append(mp.evictions, evictionEntry{d, d.descendantFee, d.descendantSize})
+		}
+		heap.Init(&mp.evictions)
+		return
+	}
+	heap.Push(&mp.evictions, evictionEntry{desc, desc.descendantFee, desc.descendantSize})
+}
+
+// popEviction The transaction in the pool whose descendants have the
+// lowest fee rate
+func (mp *TxPool) popEviction() *TxDesc {
+	for len(mp.evictions) > 0 {
+		entry := heap.Pop(&mp.evictions).(evictionEntry)
+		desc := entry.desc
+		if mp.pool[desc.Hash] == desc && desc.descendantFee == entry.fee && desc.descendantSize == entry.size {
+			return desc
+		}
+	}
+	return nil
+}
+
+// trimToSize Evict the transactions with the lowest fee rate, with
+// their descendants, until the pool is within its maximum size.
+// Returns the evicted transactions
+func (mp *TxPool) trimToSize() []*TxDesc {
+	removed := []*TxDesc{}
+	for mp.totalSize > mp.cfg.MaxSize {
+		worst := mp.popEviction()
+		if worst == nil {
+			break
+		}
+		for _, d := range descendants(worst, map[chainhash.Hash]*TxDesc{}) {
+			removed = append(removed, d)
+		}
+		mp.removeTransaction(worst, true)
+	}
+	return removed
+}
+
+// maybeAddOrphan Keep tx until its parents arrive. The oldest orphan
+// is evicted when there are too many
+func (mp *TxPool) maybeAddOrphan(tx *chain.Tx) error {
+	hash := tx.Hash()
+	if size := tx.Serialise().Len(); size > maxOrphanTxSize {
+		return txRuleError(
+			ErrOrphanTooLarge,
+			fmt.Sprintf("Orphan %s is %d bytes, the maximum is %d", hash, size, maxOrphanTxSize),
+		)
+	}
+
+	for len(mp.orphans) >= mp.cfg.MaxOrphans {
+		var oldest *orphanTx
+		for _, orphan := range mp.orphans {
+			if oldest == nil || orphan.added.Before(oldest.added) {
+				oldest = orphan
+			}
+		}
+		mp.removeOrphan(oldest)
+	}
+
+	orphan := &orphanTx{tx: tx, hash: hash, added: time.Now()}
+	mp.orphans[hash] = orphan
+	for i := range tx.Vin {
+		op := tx.Vin[i].PreviousOutPoint()
+		if _, ok := mp.orphansByPrev[op]; !ok {
+			mp.orphansByPrev[op] = map[chainhash.Hash]*orphanTx{}
+		}
+		mp.orphansByPrev[op][hash] = orphan
+	}
+	return nil
+}
+
+// removeOrphan Remove orphan from the orphan pool
+func (mp *TxPool) removeOrphan(orphan *orphanTx) {
+	for i := range orphan.tx.Vin {
+		op := orphan.tx.Vin[i].PreviousOutPoint()
+		delete(mp.orphansByPrev[op], orphan.hash)
+		if len(mp.orphansByPrev[op]) == 0 {
+			delete(mp.orphansByPrev, op)
+		}
+	}
+	delete(mp.orphans, orphan.hash)
+}
+
+// processOrphans Try again the orphans spending the outputs of parents,
+// then the orphans of every transaction accepted. Orphans still missing
+// parents go back to the orphan pool, invalid ones are dropped.
+// Returns the transactions accepted
+func (mp *TxPool) processOrphans(parents []*chain.Tx) []*TxDesc {
+	accepted := []*TxDesc{}
+	queue := append([]*chain.Tx{}, parents...)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		hash := parent.Hash()
+		for i := range parent.Vout {
+			// The orphans are removed and may be added back, so don't
+			// range over the map itself
+			spenders := mp.orphansByPrev[chainhash.OutPoint{Hash: hash, Index: int32(i)}]
+			orphans := make([]*orphanTx, 0, len(spenders))
+			for _, orphan := range spenders {
+				orphans = append(orphans, orphan)
+			}
+			for _, orphan := range orphans {
+				// Evicted while an earlier orphan was added back
+				if mp.orphans[orphan.hash] != orphan {
+					continue
+				}
+				mp.removeOrphan(orphan)
+				missing, desc, err := mp.maybeAcceptTransaction(orphan.tx)
+				if err == nil && len(missing) > 0 {
+					// Still waiting on another parent
+					err = mp.maybeAddOrphan(orphan.tx)
+					desc = nil
+				}
+				// Invalid orphans and those which can't be kept again
+				// are dropped
+				if err != nil || desc == nil {
+					continue
+				}
+				accepted = append(accepted, desc)
+				queue = append(queue, orphan.tx)
+			}
+		}
+	}
+	return accepted
+}
+
+// ChainNotification Keep the pool in step with the best chain.
+// Subscribe with blockchain.BlockChain.Subscribe
+func (mp *TxPool) ChainNotification(n *blockchain.Notification) {
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		mp.BlockConnected(n.Block)
+	case blockchain.NTBlockDisconnected:
+		mp.BlockDisconnected(n.Block)
+	}
+}
+
+// BlockConnected Remove the transactions confirmed by block and those
+// spending the same outputs, with their descendants. Orphans spending
+// the outputs of block are tried again
+func (mp *TxPool) BlockConnected(block *chain.Block) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	txs := []*chain.Tx{}
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		txs = append(txs, tx)
+
+		hash := tx.Hash()
+		if desc, ok := mp.pool[hash]; ok {
+			mp.removeTransaction(desc, false)
+		}
+		if orphan, ok := mp.orphans[hash]; ok {
+			mp.removeOrphan(orphan)
+		}
+		if tx.IsCoinBase() {
+			continue
+		}
+		for j := range tx.Vin {
+			if spender, ok := mp.outpoints[tx.Vin[j].PreviousOutPoint()]; ok {
+				mp.removeTransaction(spender, true)
+			}
+		}
+	}
+
+	mp.processOrphans(txs)
+}
+
+// BlockDisconnected Put the transactions of block back into the pool.
+// Transactions in the pool left spending outputs which no longer exist,
+// or no longer final at the lower height, are removed
+func (mp *TxPool) BlockDisconnected(block *chain.Block) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if !tx.IsCoinBase() {
+			mp.maybeAcceptTransaction(tx)
+		}
+	}
+
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		hash := tx.Hash()
+		if _, ok := mp.pool[hash]; ok {
+			continue
+		}
+		for j := range tx.Vout {
+			if spender, ok := mp.outpoints[chainhash.OutPoint{Hash: hash, Index: int32(j)}]; ok {
+				mp.removeTransaction(spender, true)
+			}
+		}
+	}
+
+	mp.removeNonFinal()
+}
+
+// removeNonFinal Remove the transactions, with their descendants, whose
+// lock times don't allow them in the next block, or which spend a
+// coinbase output too young for the next block
+func (mp *TxPool) removeNonFinal() {
+	height := mp.cfg.Chain.BestHeight() + 1
+	medianTime, err := mp.cfg.Chain.MedianTimePast()
+	if err != nil {
+		return
+	}
+
+	view := &poolView{mp: mp, height: height}
+	locked := []*TxDesc{}
+	for _, desc := range mp.pool {
+		if !desc.Tx.IsFinal(height, medianTime) {
+			locked = append(locked, desc)
+			continue
+		}
+		if err := blockchain.CheckSequenceLocks(&desc.Tx, view, height, medianTime, mp.cfg.Chain.HeaderByHeight); err != nil {
+			locked = append(locked, desc)
+			continue
+		}
+		if err := blockchain.CheckCoinbaseMaturity(&desc.Tx, view, height, mp.cfg.Chain.Params()); err != nil {
+			locked = append(locked, desc)
+		}
+	}
+
+	for _, desc := range locked {
+		// Already gone as the descendant of another
+		if _, ok := mp.pool[desc.Hash]; ok {
+			mp.removeTransaction(desc, true)
+		}
+	}
+}
+
+// HaveTransaction True if the transaction is in the pool or is an orphan
+func (mp *TxPool) HaveTransaction(hash chainhash.Hash) bool {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	_, inPool := mp.pool[hash]
+	_, isOrphan := mp.orphans[hash]
+	return inPool || isOrphan
+}
+
+// IsOrphan True if the transaction is waiting for its parents
+func (mp *TxPool) IsOrphan(hash chainhash.Hash) bool {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	_, ok := mp.orphans[hash]
+	return ok
+}
+
+// FetchTxDesc The pool transaction with hash
+func (mp *TxPool) FetchTxDesc(hash chainhash.Hash) (*TxDesc, bool) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	desc, ok := mp.pool[hash]
+	return desc, ok
+}
+
+// TxDescs Every transaction in the pool
+func (mp *TxPool) TxDescs() []*TxDesc {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	ret := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		ret = append(ret, desc)
+	}
+	return ret
+}
+
+// Parents The hashes of the pool transactions hash spends from
+func (mp *TxPool) Parents(hash chainhash.Hash) []chainhash.Hash {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	ret := []chainhash.Hash{}
+	if desc, ok := mp.pool[hash]; ok {
+		for parent := range desc.parents {
+			ret = append(ret, parent)
+		}
+	}
+	return ret
+}
+
+// Children The hashes of the pool transactions spending from hash
+func (mp *TxPool) Children(hash chainhash.Hash) []chainhash.Hash {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	ret := []chainhash.Hash{}
+	if desc, ok := mp.pool[hash]; ok {
+		for child := range desc.children {
+			ret = append(ret, child)
+		}
+	}
+	return ret
+}
+
+// MiningDesc A pool transaction with the pool transactions it spends from
+type MiningDesc struct {
+	*TxDesc
+	Parents []chainhash.Hash
+}
+
+// MiningDescs Every transaction in the pool with its parents, taken
+// together so the parents are consistent
+func (mp *TxPool) MiningDescs() []*MiningDesc {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	ret := make([]*MiningDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		parents := []chainhash.Hash{}
+		for parent := range desc.parents {
+			parents = append(parents, parent)
+		}
+		ret = append(ret, &MiningDesc{TxDesc: desc, Parents: parents})
+	}
+	return ret
+}
+
+// Chain The best chain the pool validates against
+func (mp *TxPool) Chain() ChainState {
+	return mp.cfg.Chain
+}
+
+// Count The number of transactions in the pool, not counting orphans
+func (mp *TxPool) Count() int {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	return len(mp.pool)
+}
+
+// OrphanCount The number of orphans
+func (mp *TxPool) OrphanCount() int {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	return len(mp.orphans)
+}
+
+// Size The total serialised size of the transactions in the pool
+func (mp *TxPool) Size() int64 {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	return mp.totalSize
+}
@@ -0,0 +1,547 @@
+package mempool
+
+import (
+	"spchain/blockchain"
+	"spchain/chain"
+	"spchain/chaincfg"
+	"spchain/chainhash"
+	"spchain/key"
+	"spchain/script"
+	"testing"
+)
+
+// fakeChain A ChainState kept in memory
+type fakeChain struct {
+	utxos      map[chainhash.OutPoint]chain.Utxo
+	height     int32
+	medianTime int64
+}
+
+func (c *fakeChain) LookupUtxo(outPoint chainhash.OutPoint) (*chain.Utxo, error) {
+	utxo, ok := c.utxos[outPoint]
+	if !ok {
+		return nil, nil
+	}
+	return &utxo, nil
+}
+
+func (c *fakeChain) Params() *chaincfg.Params {
+	return &chaincfg.RegressionNetParams
+}
+
+func (c *fakeChain) BestHash() chainhash.Hash {
+	return chainhash.Hash{}
+}
+
+func (c *fakeChain) NextRequiredDifficulty(prevHash chainhash.Hash) (uint32, error) {
+	return 0, nil
+}
+
+func (c *fakeChain) BestHeight() int32 {
+	return c.height
+}
+
+func (c *fakeChain) MedianTimePast() (int64, error) {
+	return c.medianTime, nil
+}
+
+func (c *fakeChain) HeaderByHeight(height int32) (*chain.BlockHeader, error) {
+	return &chain.BlockHeader{TimeStamp: c.medianTime}, nil
+}
+
+// testOutput An output a test transaction can spend
+type testOutput struct {
+	txid  chainhash.Hash
+	index int32
+	out   chain.OutputTx
+}
+
+// poolTestHarness A pool on top of a fake chain with funds for testKey
+type poolTestHarness struct {
+	t     *testing.T
+	chain *fakeChain
+	pool  *TxPool
+	key   key.Key
+	funds byte
+}
+
+func newPoolTestHarness(t *testing.T, cfg Config) *poolTestHarness {
+	h := &poolTestHarness{
+		t:     t,
+		chain: &fakeChain{utxos: map[chainhash.OutPoint]chain.Utxo{}, height: 100, medianTime: 1550000000},
+		key:   key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"),
+	}
+	cfg.Chain = h.chain
+	h.pool = New(&cfg)
+	return h
+}
+
+func (h *poolTestHarness) p2pkhOutput(value int64) chain.OutputTx {
+	lock := script.Stack{
+		Contents: []script.Operand{
+			script.OP_DUP{},
+			script.OP_HASH_160{},
+			script.PUB_KEY_V1{Key: h.key.PublicKeyHash},
+			script.OP_EQUALVERIFY{},
+			script.OP_CHECKSIG{},
+		},
+	}
+	return chain.OutputTx{Value: value, ScriptPubKey: lock.Ser().Bytes()}
+}
+
+// fund A new confirmed output worth value
+func (h *poolTestHarness) fund(value int64) testOutput {
+	h.funds++
+	txid := chainhash.Hash{h.funds}
+	out := h.p2pkhOutput(value)
+	h.chain.utxos[chainhash.OutPoint{Hash: txid, Index: 0}] = chain.Utxo{
+		Value:        out.Value,
+		ScriptPubKey: out.ScriptPubKey,
+		Height:       1,
+	}
+	return testOutput{txid: txid, index: 0, out: out}
+}
+
+// outputOf The output index of tx
+func outputOf(tx *chain.Tx, index int32) testOutput {
+	return testOutput{txid: tx.Hash(), index: index, out: tx.Vout[index]}
+}
+
+// spend A signed transaction with final inputs spending inputs to
+// outputs worth values
+func (h *poolTestHarness) spend(inputs []testOutput, values ...int64) chain.Tx {
+	return h.spendWithSequence(inputs, -1, values...)
+}
+
+// spendWithSequence A signed transaction spending inputs, which all
+// have sequence, to outputs worth values
+func (h *poolTestHarness) spendWithSequence(inputs []testOutput, sequence int32, values ...int64) chain.Tx {
+	tx := chain.Tx{Version: 1, TxInNo: int64(len(inputs)), TxOutNo: int64(len(values))}
+	prevOuts := []chain.OutputTx{}
+	for _, in := range inputs {
+		tx.Vin = append(tx.Vin, chain.InputTx{Txid: in.txid, OutInx: in.index, Sequence: sequence})
+		prevOuts = append(prevOuts, in.out)
+	}
+	for _, value := range values {
+		tx.Vout = append(tx.Vout, h.p2pkhOutput(value))
+	}
+	if err := h.sign(&tx, prevOuts); err != nil {
+		h.t.Fatalf("Unable to sign %s", err)
+	}
+	return tx
+}
+
+// sign A SignFunc signing with the harness key
+func (h *poolTestHarness) sign(tx *chain.Tx, prevOuts []chain.OutputTx) error {
+	for i := range tx.Vin {
+		sig, err := tx.SignInput(i, h.key.PrivateKey, &prevOuts[i])
+		if err != nil {
+			return err
+		}
+		unlock := script.Stack{
+			Contents: []script.Operand{
+				script.SIG{Sig: sig},
+				script.PUB_KEY_V1{Key: h.key.PublicKey.SerializeCompressed()},
+			},
+		}
+		tx.Vin[i].ScriptSig = unlock.Ser().Bytes()
+	}
+	return nil
+}
+
+// accept Process tx expecting it to be accepted
+func (h *poolTestHarness) accept(tx *chain.Tx) []*TxDesc {
+	h.t.Helper()
+	accepted, err := h.pool.ProcessTransaction(tx)
+	if err != nil {
+		h.t.Fatalf("Unexpected error %s", err)
+	}
+	return accepted
+}
+
+// confirm Move tx from the fake mempool into the fake chain
+func (h *poolTestHarness) confirm(tx *chain.Tx) {
+	for i := range tx.Vin {
+		delete(h.chain.utxos, tx.Vin[i].PreviousOutPoint())
+	}
+	hash := tx.Hash()
+	for i, out := range tx.Vout {
+		h.chain.utxos[chainhash.OutPoint{Hash: hash, Index: int32(i)}] = chain.Utxo{
+			Value:        out.Value,
+			ScriptPubKey: out.ScriptPubKey,
+			Height:       h.chain.height,
+		}
+	}
+}
+
+func expectTxRuleError(t *testing.T, err error, code ErrorCode) {
+	t.Helper()
+	ruleErr, ok := err.(*TxRuleError)
+	if !ok {
+		t.Errorf("Expected %s, got %v", code, err)
+		return
+	}
+	if ruleErr.Code != code {
+		t.Errorf("Expected %s, got %s: %s", code, ruleErr.Code, ruleErr.Msg)
+	}
+}
+
+func TestProcessTransaction(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	tx := h.spend([]testOutput{h.fund(5000)}, 4000)
+
+	accepted := h.accept(&tx)
+	if len(accepted) != 1 || accepted[0].Hash != tx.Hash() {
+		t.Fatalf("Expected the transaction to be accepted")
+	}
+	if accepted[0].Fee != 1000 || accepted[0].Height != 100 {
+		t.Errorf("Expected fee 1000 at height 100, got %d at %d", accepted[0].Fee, accepted[0].Height)
+	}
+	if !h.pool.HaveTransaction(tx.Hash()) || h.pool.Count() != 1 || h.pool.Size() != accepted[0].Size {
+		t.Errorf("Expected the transaction in the pool")
+	}
+
+	_, err := h.pool.ProcessTransaction(&tx)
+	expectTxRuleError(t, err, ErrDuplicate)
+}
+
+func TestProcessTransactionRejects(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+
+	first := h.fund(5000)
+	tx := h.spend([]testOutput{first}, 4000)
+	h.accept(&tx)
+	conflict := h.spend([]testOutput{first}, 3000)
+	_, err := h.pool.ProcessTransaction(&conflict)
+	expectTxRuleError(t, err, ErrConflict)
+
+	coinbase := chain.NewCoinBaseTx(101, 0, 5000, h.p2pkhOutput(5000).ScriptPubKey)
+	_, err = h.pool.ProcessTransaction(&coinbase)
+	expectTxRuleError(t, err, ErrCoinbase)
+
+	locked := h.spendWithSequence([]testOutput{h.fund(5000)}, 0, 4000)
+	locked.LockTime = 102
+	_, err = h.pool.ProcessTransaction(&locked)
+	expectTxRuleError(t, err, ErrNonFinal)
+
+	tooMuch := h.spend([]testOutput{h.fund(5000)}, 6000)
+	_, err = h.pool.ProcessTransaction(&tooMuch)
+	if ruleErr, ok := err.(*blockchain.RuleError); !ok || ruleErr.Code != blockchain.ErrSpendTooHigh {
+		t.Errorf("Expected ErrSpendTooHigh, got %v", err)
+	}
+
+	confirmed := h.spend([]testOutput{h.fund(5000)}, 4000)
+	h.confirm(&confirmed)
+	_, err = h.pool.ProcessTransaction(&confirmed)
+	expectTxRuleError(t, err, ErrDuplicate)
+
+	if h.pool.Count() != 1 {
+		t.Errorf("Expected only the first transaction in the pool, got %d", h.pool.Count())
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	parent := h.spend([]testOutput{h.fund(5000)}, 2000, 2000)
+	child := h.spend([]testOutput{outputOf(&parent, 0), outputOf(&parent, 1)}, 3000)
+	h.accept(&parent)
+	h.accept(&child)
+
+	parents := h.pool.Parents(child.Hash())
+	if len(parents) != 1 || parents[0] != parent.Hash() {
+		t.Errorf("Expected the parent of the child, got %x", parents)
+	}
+	children := h.pool.Children(parent.Hash())
+	if len(children) != 1 || children[0] != child.Hash() {
+		t.Errorf("Expected the child of the parent, got %x", children)
+	}
+
+	for _, desc := range h.pool.MiningDescs() {
+		expected := 0
+		if desc.Hash == child.Hash() {
+			expected = 1
+		}
+		if len(desc.Parents) != expected {
+			t.Errorf("Expected %x to have %d parents, got %d", desc.Hash, expected, len(desc.Parents))
+		}
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	h := newPoolTestHarness(t, Config{MaxOrphans: 2})
+	parent := h.spend([]testOutput{h.fund(5000)}, 4000)
+	child := h.spend([]testOutput{outputOf(&parent, 0)}, 3000)
+	grandchild := h.spend([]testOutput{outputOf(&child, 0)}, 2000)
+
+	for _, tx := range []*chain.Tx{&grandchild, &child} {
+		if accepted := h.accept(tx); len(accepted) != 0 {
+			t.Errorf("Expected an orphan, got %d accepted", len(accepted))
+		}
+	}
+	if !h.pool.IsOrphan(child.Hash()) || h.pool.Count() != 0 {
+		t.Errorf("Expected orphans outside the pool")
+	}
+
+	accepted := h.accept(&parent)
+	if len(accepted) != 3 {
+		t.Fatalf("Expected the orphans to be accepted with their parent, got %d", len(accepted))
+	}
+	if h.pool.OrphanCount() != 0 || h.pool.Count() != 3 {
+		t.Errorf("Expected every transaction in the pool")
+	}
+
+	// The oldest orphan makes way when the orphan pool is full
+	for i := 0; i < 3; i++ {
+		missing := testOutput{txid: chainhash.Hash{0xf0, byte(i)}, out: h.p2pkhOutput(5000)}
+		orphan := h.spend([]testOutput{missing}, 4000)
+		h.accept(&orphan)
+	}
+	if h.pool.OrphanCount() != 2 {
+		t.Errorf("Expected 2 orphans, got %d", h.pool.OrphanCount())
+	}
+}
+
+func TestOrphanStillMissing(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	parent := h.spend([]testOutput{h.fund(5000)}, 2000, 2000)
+	missing := testOutput{txid: chainhash.Hash{0xf0}, out: h.p2pkhOutput(5000)}
+	waiting := h.spend([]testOutput{outputOf(&parent, 0), missing}, 6000)
+	ready := h.spend([]testOutput{outputOf(&parent, 1)}, 1500)
+	h.accept(&waiting)
+	h.accept(&ready)
+
+	// The orphan still missing a parent goes back, once
+	accepted := h.accept(&parent)
+	if len(accepted) != 2 || !h.pool.HaveTransaction(ready.Hash()) {
+		t.Errorf("Expected the parent and the ready orphan to be accepted, got %d", len(accepted))
+	}
+	if !h.pool.IsOrphan(waiting.Hash()) || h.pool.OrphanCount() != 1 {
+		t.Errorf("Expected the waiting orphan back in the orphan pool, got %d orphans", h.pool.OrphanCount())
+	}
+}
+
+func TestEviction(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	low := h.spend([]testOutput{h.fund(5000)}, 4950)
+	lowChild := h.spend([]testOutput{outputOf(&low, 0)}, 4500)
+	mid := h.spend([]testOutput{h.fund(5000)}, 4500)
+	high := h.spend([]testOutput{h.fund(5000)}, 4000)
+	lowest := h.spend([]testOutput{h.fund(5000)}, 4999)
+
+	// Room for three of the equally sized transactions
+	size := int64(low.Serialise().Len())
+	h.pool.cfg.MaxSize = 3 * size
+
+	// The child pays well but is evicted with its parent, as their
+	// package fee rate is the lowest
+	h.accept(&low)
+	h.accept(&lowChild)
+	h.accept(&mid)
+	h.accept(&high)
+	if h.pool.HaveTransaction(low.Hash()) || h.pool.HaveTransaction(lowChild.Hash()) {
+		t.Errorf("Expected the lowest fee rate package to be evicted")
+	}
+	if !h.pool.HaveTransaction(mid.Hash()) || !h.pool.HaveTransaction(high.Hash()) {
+		t.Errorf("Expected the higher fee rates to stay")
+	}
+	if h.pool.Size() > h.pool.cfg.MaxSize {
+		t.Errorf("Pool size %d is above the maximum %d", h.pool.Size(), h.pool.cfg.MaxSize)
+	}
+
+	h.pool.cfg.MaxSize = 2 * size
+	_, err := h.pool.ProcessTransaction(&lowest)
+	expectTxRuleError(t, err, ErrPoolFull)
+}
+
+// expectDescendantTotals Check the kept totals of every transaction in
+// the pool against its descendants
+func expectDescendantTotals(t *testing.T, pool *TxPool) {
+	t.Helper()
+	for hash, desc := range pool.pool {
+		var fee, size int64
+		for _, d := range descendants(desc, map[chainhash.Hash]*TxDesc{}) {
+			fee += d.Fee
+			size += d.Size
+		}
+		if desc.descendantFee != fee || desc.descendantSize != size {
+			t.Errorf("Expected %s to have descendant fee %d size %d, got %d %d",
+				hash, fee, size, desc.descendantFee, desc.descendantSize)
+		}
+	}
+}
+
+func TestDescendantTotals(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	parent := h.spend([]testOutput{h.fund(5000)}, 2000, 2000)
+	left := h.spend([]testOutput{outputOf(&parent, 0)}, 1900)
+	right := h.spend([]testOutput{outputOf(&parent, 1)}, 1800)
+	grandchild := h.spend([]testOutput{outputOf(&left, 0), outputOf(&right, 0)}, 3000)
+	for _, tx := range []*chain.Tx{&parent, &left, &right, &grandchild} {
+		h.accept(tx)
+	}
+	expectDescendantTotals(t, h.pool)
+	if fee := h.pool.pool[parent.Hash()].descendantFee; fee != 2000 {
+		t.Errorf("Expected the parent to count each descendant once, got fee %d", fee)
+	}
+
+	// The grandchild is still a descendant of the parent through left
+	rightDesc := h.pool.pool[right.Hash()]
+	h.pool.removeTransaction(rightDesc, false)
+	expectDescendantTotals(t, h.pool)
+
+	h.pool.insertTransaction(rightDesc)
+	expectDescendantTotals(t, h.pool)
+
+	h.pool.removeTransaction(h.pool.pool[left.Hash()], true)
+	expectDescendantTotals(t, h.pool)
+	if h.pool.Count() != 2 {
+		t.Errorf("Expected the parent and right to stay, got %d", h.pool.Count())
+	}
+}
+
+func TestBlockConnected(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	second := h.fund(5000)
+	confirmed := h.spend([]testOutput{h.fund(5000)}, 4000)
+	child := h.spend([]testOutput{outputOf(&confirmed, 0)}, 3000)
+	conflicted := h.spend([]testOutput{second}, 4000)
+	conflictedChild := h.spend([]testOutput{outputOf(&conflicted, 0)}, 3000)
+	for _, tx := range []*chain.Tx{&confirmed, &child, &conflicted, &conflictedChild} {
+		h.accept(tx)
+	}
+
+	// An orphan waiting on an output the block creates
+	doubleSpend := h.spend([]testOutput{second}, 4500)
+	orphan := h.spend([]testOutput{outputOf(&doubleSpend, 0)}, 4000)
+	h.accept(&orphan)
+
+	coinbase := chain.NewCoinBaseTx(101, 0, 5000, h.p2pkhOutput(5000).ScriptPubKey)
+	block := chain.Block{Transactions: []chain.Tx{coinbase, confirmed, doubleSpend}}
+	h.chain.height++
+	for i := range block.Transactions {
+		h.confirm(&block.Transactions[i])
+	}
+	h.pool.ChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Block: &block, Height: 101})
+
+	if h.pool.HaveTransaction(confirmed.Hash()) {
+		t.Errorf("Expected the confirmed transaction to be removed")
+	}
+	if !h.pool.HaveTransaction(child.Hash()) || len(h.pool.Parents(child.Hash())) != 0 {
+		t.Errorf("Expected the child to stay without a parent in the pool")
+	}
+	if h.pool.HaveTransaction(conflicted.Hash()) || h.pool.HaveTransaction(conflictedChild.Hash()) {
+		t.Errorf("Expected the conflicting transactions to be removed")
+	}
+	if h.pool.IsOrphan(orphan.Hash()) || !h.pool.HaveTransaction(orphan.Hash()) {
+		t.Errorf("Expected the orphan to be accepted once its parent is confirmed")
+	}
+}
+
+func TestBlockDisconnected(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(5000)
+	confirmed := h.spend([]testOutput{funding}, 4000)
+	h.confirm(&confirmed)
+	child := h.spend([]testOutput{outputOf(&confirmed, 0)}, 3000)
+	h.accept(&child)
+
+	coinbase := chain.NewCoinBaseTx(100, 0, 5000, h.p2pkhOutput(5000).ScriptPubKey)
+	h.confirm(&coinbase)
+	spendsCoinbase := h.spend([]testOutput{outputOf(&coinbase, 0)}, 4000)
+	h.accept(&spendsCoinbase)
+
+	// Undo the block in the fake chain
+	block := chain.Block{Transactions: []chain.Tx{coinbase, confirmed}}
+	for _, tx := range []*chain.Tx{&coinbase, &confirmed} {
+		hash := tx.Hash()
+		for i := range tx.Vout {
+			delete(h.chain.utxos, chainhash.OutPoint{Hash: hash, Index: int32(i)})
+		}
+	}
+	h.chain.utxos[confirmed.Vin[0].PreviousOutPoint()] = chain.Utxo{
+		Value:        funding.out.Value,
+		ScriptPubKey: funding.out.ScriptPubKey,
+		Height:       1,
+	}
+	h.chain.height--
+	h.pool.ChainNotification(&blockchain.Notification{Type: blockchain.NTBlockDisconnected, Block: &block, Height: 100})
+
+	if !h.pool.HaveTransaction(confirmed.Hash()) {
+		t.Fatalf("Expected the disconnected transaction back in the pool")
+	}
+	children := h.pool.Children(confirmed.Hash())
+	if len(children) != 1 || children[0] != child.Hash() {
+		t.Errorf("Expected the pool child to be linked to its returned parent")
+	}
+	if h.pool.HaveTransaction(spendsCoinbase.Hash()) {
+		t.Errorf("Expected the spend of the disconnected coinbase to be removed")
+	}
+}
+
+func TestDisconnectedTrimmed(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(5000)
+	confirmed := h.spend([]testOutput{funding}, 4999)
+	h.confirm(&confirmed)
+	child := h.spend([]testOutput{outputOf(&confirmed, 0)}, 4000)
+	other := h.spend([]testOutput{h.fund(5000)}, 3000)
+	h.accept(&child)
+	h.accept(&other)
+	h.pool.cfg.MaxSize = h.pool.Size()
+
+	// The returned transaction and its child have the lowest package
+	// fee rate, so both are trimmed
+	hash := confirmed.Hash()
+	delete(h.chain.utxos, chainhash.OutPoint{Hash: hash, Index: 0})
+	h.chain.utxos[confirmed.Vin[0].PreviousOutPoint()] = chain.Utxo{
+		Value:        funding.out.Value,
+		ScriptPubKey: funding.out.ScriptPubKey,
+		Height:       1,
+	}
+	_, _, err := h.pool.maybeAcceptTransaction(&confirmed)
+	expectTxRuleError(t, err, ErrPoolFull)
+
+	if h.pool.HaveTransaction(child.Hash()) {
+		t.Errorf("Expected the child to be trimmed with its parent")
+	}
+	if !h.pool.HaveTransaction(other.Hash()) || h.pool.Count() != 1 {
+		t.Errorf("Expected only the other transaction in the pool, got %d", h.pool.Count())
+	}
+	expectDescendantTotals(t, h.pool)
+}
+
+func TestImmatureCoinbaseSpend(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	maturity := h.chain.Params().CoinbaseMaturity
+
+	// fundCoinbase A coinbase output created by the block at height
+	fundCoinbase := func(height int32) testOutput {
+		coinbase := chain.NewCoinBaseTx(height, 0, 5000, h.p2pkhOutput(5000).ScriptPubKey)
+		out := outputOf(&coinbase, 0)
+		h.chain.utxos[chainhash.OutPoint{Hash: out.txid, Index: 0}] = chain.Utxo{
+			Value:        out.out.Value,
+			ScriptPubKey: out.out.ScriptPubKey,
+			Height:       height,
+			IsCoinBase:   true,
+		}
+		return out
+	}
+
+	// The next block is at height 101
+	immature := h.spend([]testOutput{fundCoinbase(102 - maturity)}, 4000)
+	_, err := h.pool.ProcessTransaction(&immature)
+	if ruleErr, ok := err.(*blockchain.RuleError); !ok || ruleErr.Code != blockchain.ErrImmatureSpend {
+		t.Errorf("Expected ErrImmatureSpend, got %v", err)
+	}
+
+	mature := h.spend([]testOutput{fundCoinbase(101 - maturity)}, 4000)
+	h.accept(&mature)
+
+	// Once the tip is disconnected the spend is immature again
+	h.chain.height--
+	block := chain.Block{Transactions: []chain.Tx{chain.NewCoinBaseTx(100, 1, 5000, h.p2pkhOutput(5000).ScriptPubKey)}}
+	h.pool.ChainNotification(&blockchain.Notification{Type: blockchain.NTBlockDisconnected, Block: &block, Height: 100})
+	if h.pool.HaveTransaction(mature.Hash()) {
+		t.Errorf("Expected the spend of an immature coinbase to be removed")
+	}
+}
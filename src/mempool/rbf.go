@@ -0,0 +1,257 @@
+package mempool
+
+import (
+	"bytes"
+	"fmt"
+	"spchain/chain"
+	"spchain/chainhash"
+	"spchain/script"
+)
+
+/*
+  Replace-by-fee. A transaction in the pool can be replaced by one
+  spending the same outputs if it signals replaceability: an input of it,
+  or of one of its ancestors in the pool, has a Sequence of at most
+  MaxRBFSequence. The replacement evicts the transactions it conflicts
+  with and all their descendants. It must pay a strictly higher absolute
+  fee than all of them together and a strictly higher fee rate than each
+  of them, and can evict at most MaxReplacementEvictions transactions.
+*/
+
+const (
+	// MaxRBFSequence The highest input Sequence which signals that
+	// the transaction can be replaced
+	MaxRBFSequence uint32 = chain.MaxTxInSequenceNum - 2
+
+	// MaxReplacementEvictions The most transactions one replacement
+	// can evict
+	MaxReplacementEvictions = 100
+
+	// maxSigLen The longest signature in a ScriptSig: a DER signature
+	// is at most 72 bytes, a SEQUENCE header of 2 bytes around two
+	// INTEGERs of up to 33 bytes with 2 byte headers, followed by the
+	// 1 byte hash type
+	maxSigLen = 72 + 1
+)
+
+// SignalsReplacement True if an input of tx allows it to be replaced
+func SignalsReplacement(tx *chain.Tx) bool {
+	for i := range tx.Vin {
+		if uint32(tx.Vin[i].Sequence) <= MaxRBFSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// signalsReplacement True if desc or one of its ancestors in the pool
+// signals replaceability
+func signalsReplacement(desc *TxDesc, seen map[chainhash.Hash]bool) bool {
+	if seen[desc.Hash] {
+		return false
+	}
+	seen[desc.Hash] = true
+	if SignalsReplacement(&desc.Tx) {
+		return true
+	}
+	for _, parent := range desc.parents {
+		if signalsReplacement(parent, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// findConflicts The pool transactions spending the same outputs as tx.
+// Every one of them must be replaceable
+func (mp *TxPool) findConflicts(tx *chain.Tx) (map[chainhash.Hash]*TxDesc, error) {
+	conflicts := map[chainhash.Hash]*TxDesc{}
+	for i := range tx.Vin {
+		in := &tx.Vin[i]
+		spender, ok := mp.outpoints[in.PreviousOutPoint()]
+		if !ok {
+			continue
+		}
+		if !signalsReplacement(spender, map[chainhash.Hash]bool{}) {
+			return nil, txRuleError(
+				ErrConflict,
+				fmt.Sprintf("Input %d spends %s which is already spent by %s", i, in.PreviousOutPoint(), spender.Hash),
+			)
+		}
+		conflicts[spender.Hash] = spender
+	}
+	return conflicts, nil
+}
+
+// checkReplacement Check tx paying fee may replace conflicts.
+// Returns every transaction the replacement evicts
+func (mp *TxPool) checkReplacement(tx *chain.Tx, fee int64, conflicts map[chainhash.Hash]*TxDesc) (map[chainhash.Hash]*TxDesc, error) {
+	hash := tx.Hash()
+	evicted := map[chainhash.Hash]*TxDesc{}
+	for _, conflict := range conflicts {
+		descendants(conflict, evicted)
+		if len(evicted) > MaxReplacementEvictions {
+			return nil, txRuleError(
+				ErrTooManyReplacements,
+				fmt.Sprintf("Replacement %s would evict more than %d transactions", hash, MaxReplacementEvictions),
+			)
+		}
+	}
+
+	// The replacement can't depend on what it evicts, and may only
+	// spend unconfirmed outputs the replaced transactions spent,
+	// so it is no harder to mine than they were
+	replacedSpends := map[chainhash.OutPoint]bool{}
+	for _, conflict := range conflicts {
+		for i := range conflict.Tx.Vin {
+			replacedSpends[conflict.Tx.Vin[i].PreviousOutPoint()] = true
+		}
+	}
+	for i := range tx.Vin {
+		op := tx.Vin[i].PreviousOutPoint()
+		if _, ok := evicted[op.Hash]; ok {
+			return nil, txRuleError(
+				ErrReplacementInputs,
+				fmt.Sprintf("Replacement %s input %d spends transaction %s which it evicts", hash, i, op.Hash),
+			)
+		}
+		if _, ok := mp.pool[op.Hash]; ok && !replacedSpends[op] {
+			return nil, txRuleError(
+				ErrReplacementInputs,
+				fmt.Sprintf("Replacement %s input %d spends a new unconfirmed output of %s", hash, i, op.Hash),
+			)
+		}
+	}
+
+	rate := feeRate(fee, int64(tx.Serialise().Len()))
+	var evictedFees int64
+	for _, desc := range evicted {
+		evictedFees += desc.Fee
+		if rate <= desc.FeeRate() {
+			return nil, txRuleError(
+				ErrReplacementFee,
+				fmt.Sprintf("Replacement %s fee rate %d is not more than the fee rate %d of %s",
+					hash, rate, desc.FeeRate(), desc.Hash),
+			)
+		}
+	}
+	if fee <= evictedFees {
+		return nil, txRuleError(
+			ErrReplacementFee,
+			fmt.Sprintf("Replacement %s fee %d is not more than the %d paid by the %d transactions it evicts",
+				hash, fee, evictedFees, len(evicted)),
+		)
+	}
+	return evicted, nil
+}
+
+// maxSignedSize The size of the signed tx if every SIG in its ScriptSigs
+// were maxSigLen bytes long. The length of a signature depends on the
+// digest it signs, so signing again after changing tx, or with another
+// hash type such as ANYONECANPAY, can give a longer one
+func maxSignedSize(tx *chain.Tx) (int64, error) {
+	padded := *tx
+	padded.Vin = append([]chain.InputTx{}, tx.Vin...)
+	for i := range padded.Vin {
+		stack, err := script.Marshall(bytes.NewBuffer(padded.Vin[i].ScriptSig))
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse the ScriptSig of input %d: %v", i, err)
+		}
+		for j, op := range stack.Contents {
+			if _, ok := op.(script.SIG); ok {
+				stack.Contents[j] = script.SIG{Sig: make([]byte, maxSigLen)}
+			}
+		}
+		padded.Vin[i].ScriptSig = stack.Ser().Bytes()
+	}
+	return int64(padded.Serialise().Len()), nil
+}
+
+// SignFunc Sets the ScriptSig of every input of tx. prevOuts are the
+// outputs the inputs spend, in input order
+type SignFunc func(tx *chain.Tx, prevOuts []chain.OutputTx) error
+
+// BumpFee Replace the pool transaction hash with a copy paying at least
+// feeRate per 1000 bytes, taking the extra fee from the output at
+// changeIndex. The copy pays more than the transaction and its
+// descendants so it can replace them. sign signs the copy.
+// Returns the transactions added to the pool
+func (mp *TxPool) BumpFee(hash chainhash.Hash, feeRate int64, changeIndex int, sign SignFunc) ([]*TxDesc, error) {
+	bumped, err := mp.bumpedTx(hash, feeRate, changeIndex, sign)
+	if err != nil {
+		return nil, err
+	}
+	return mp.ProcessTransaction(bumped)
+}
+
+// bumpedTx The replacement for BumpFee
+func (mp *TxPool) bumpedTx(hash chainhash.Hash, rate int64, changeIndex int, sign SignFunc) (*chain.Tx, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, ok := mp.pool[hash]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s is not in the pool", hash)
+	}
+	if !signalsReplacement(desc, map[chainhash.Hash]bool{}) {
+		return nil, fmt.Errorf("transaction %s does not signal replaceability", hash)
+	}
+	if changeIndex < 0 || changeIndex >= len(desc.Tx.Vout) {
+		return nil, fmt.Errorf("transaction %s has no output %d", hash, changeIndex)
+	}
+
+	view := &poolView{mp: mp}
+	prevOuts := []chain.OutputTx{}
+	for i := range desc.Tx.Vin {
+		in := &desc.Tx.Vin[i]
+		utxo, err := view.LookupUtxo(in.PreviousOutPoint())
+		if err != nil {
+			return nil, err
+		}
+		if utxo == nil {
+			return nil, fmt.Errorf("input %d of %s spends an unknown output", i, hash)
+		}
+		prevOuts = append(prevOuts, utxo.Output())
+	}
+
+	bumped := desc.Tx
+	bumped.Vin = append([]chain.InputTx{}, desc.Tx.Vin...)
+	bumped.Vout = append([]chain.OutputTx{}, desc.Tx.Vout...)
+
+	// Sign once to learn the shape of the ScriptSigs. The signatures
+	// made after the fee is set can be longer, so the fee is paid on
+	// the largest size they can give
+	if err := sign(&bumped, prevOuts); err != nil {
+		return nil, err
+	}
+	size, err := maxSignedSize(&bumped)
+	if err != nil {
+		return nil, err
+	}
+
+	// The fee must beat the fee rate of every transaction evicted and
+	// their fees together
+	fee := rate * size / 1000
+	var evictedFees int64
+	for _, d := range descendants(desc, map[chainhash.Hash]*TxDesc{}) {
+		evictedFees += d.Fee
+		if minFee := ((d.FeeRate()+1)*size + 999) / 1000; fee < minFee {
+			fee = minFee
+		}
+	}
+	if fee <= evictedFees {
+		fee = evictedFees + 1
+	}
+
+	extra := fee - desc.Fee
+	if extra > bumped.Vout[changeIndex].Value {
+		return nil, fmt.Errorf("output %d worth %d can't pay the extra fee %d",
+			changeIndex, bumped.Vout[changeIndex].Value, extra)
+	}
+	bumped.Vout[changeIndex].Value -= extra
+
+	if err := sign(&bumped, prevOuts); err != nil {
+		return nil, err
+	}
+	return &bumped, nil
+}
@@ -0,0 +1,229 @@
+package mempool
+
+import (
+	"bytes"
+	"spchain/chain"
+	"spchain/script"
+	"testing"
+)
+
+func TestReplaceByFee(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(5000)
+	original := h.spendWithSequence([]testOutput{funding}, 0, 4000)
+	child := h.spend([]testOutput{outputOf(&original, 0)}, 3500)
+	h.accept(&original)
+	h.accept(&child)
+
+	// A fee of 900 is below the fee rate of the original
+	lowRate := h.spend([]testOutput{funding}, 4100)
+	_, err := h.pool.ProcessTransaction(&lowRate)
+	expectTxRuleError(t, err, ErrReplacementFee)
+
+	// A fee of 1100 beats each fee rate but not the 1500 paid by the
+	// original and its child together
+	lowFee := h.spend([]testOutput{funding}, 3900)
+	_, err = h.pool.ProcessTransaction(&lowFee)
+	expectTxRuleError(t, err, ErrReplacementFee)
+
+	replacement := h.spend([]testOutput{funding}, 3000)
+	accepted := h.accept(&replacement)
+	if len(accepted) != 1 || accepted[0].Hash != replacement.Hash() {
+		t.Fatalf("Expected the replacement to be accepted")
+	}
+	if h.pool.HaveTransaction(original.Hash()) || h.pool.HaveTransaction(child.Hash()) {
+		t.Errorf("Expected the original and its child to be evicted")
+	}
+	if h.pool.Count() != 1 {
+		t.Errorf("Expected only the replacement in the pool, got %d", h.pool.Count())
+	}
+
+	// The replacement does not signal, so it can't be replaced
+	again := h.spend([]testOutput{funding}, 1000)
+	_, err = h.pool.ProcessTransaction(&again)
+	expectTxRuleError(t, err, ErrConflict)
+}
+
+func TestReplaceByFeeInheritedSignal(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	parent := h.spendWithSequence([]testOutput{h.fund(5000)}, 0, 4000)
+	child := h.spend([]testOutput{outputOf(&parent, 0)}, 3500)
+	h.accept(&parent)
+	h.accept(&child)
+
+	// The child is replaceable because its parent signals
+	replacement := h.spend([]testOutput{outputOf(&parent, 0)}, 2000)
+	h.accept(&replacement)
+	if h.pool.HaveTransaction(child.Hash()) || !h.pool.HaveTransaction(parent.Hash()) {
+		t.Errorf("Expected only the child to be replaced")
+	}
+}
+
+func TestReplacementInputs(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(5000)
+	original := h.spendWithSequence([]testOutput{funding}, 0, 4000)
+	unrelated := h.spend([]testOutput{h.fund(5000)}, 4000)
+	h.accept(&original)
+	h.accept(&unrelated)
+
+	newUnconfirmed := h.spend([]testOutput{funding, outputOf(&unrelated, 0)}, 5000)
+	_, err := h.pool.ProcessTransaction(&newUnconfirmed)
+	expectTxRuleError(t, err, ErrReplacementInputs)
+
+	// A confirmed input which the original did not spend is fine
+	withConfirmed := h.spend([]testOutput{funding, h.fund(5000)}, 5000)
+	h.accept(&withConfirmed)
+}
+
+func TestTooManyReplacements(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(1000000)
+
+	values := []int64{}
+	for i := 0; i <= MaxReplacementEvictions; i++ {
+		values = append(values, 9000)
+	}
+	original := h.spendWithSequence([]testOutput{funding}, 0, values...)
+	h.accept(&original)
+	for i := range values {
+		child := h.spend([]testOutput{outputOf(&original, int32(i))}, 8000)
+		h.accept(&child)
+	}
+
+	replacement := h.spend([]testOutput{funding}, 1000)
+	_, err := h.pool.ProcessTransaction(&replacement)
+	expectTxRuleError(t, err, ErrTooManyReplacements)
+}
+
+func TestBumpFee(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(5000)
+	original := h.spendWithSequence([]testOutput{funding}, 0, 1000, 3900)
+	child := h.spend([]testOutput{outputOf(&original, 1)}, 3800)
+	h.accept(&original)
+	h.accept(&child)
+
+	accepted, err := h.pool.BumpFee(original.Hash(), 2000, 1, h.sign)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(accepted) != 1 {
+		t.Fatalf("Expected the bumped transaction to be accepted")
+	}
+	bumped := accepted[0]
+	if bumped.FeeRate() < 2000 || bumped.Fee <= 200 {
+		t.Errorf("Expected a fee rate of at least 2000 and fee above 200, got %d and %d", bumped.FeeRate(), bumped.Fee)
+	}
+	if bumped.Tx.Vout[0].Value != 1000 || bumped.Tx.Vout[1].Value != 4000-bumped.Fee {
+		t.Errorf("Expected the fee to come from the change output, got %d and %d",
+			bumped.Tx.Vout[0].Value, bumped.Tx.Vout[1].Value)
+	}
+	if h.pool.HaveTransaction(original.Hash()) || h.pool.HaveTransaction(child.Hash()) {
+		t.Errorf("Expected the original and its child to be replaced")
+	}
+
+	// The bumped copy keeps signalling so it can be bumped again
+	if _, err := h.pool.BumpFee(bumped.Hash, 4000, 1, h.sign); err != nil {
+		t.Errorf("Unexpected error bumping again %s", err)
+	}
+
+	final := h.spend([]testOutput{h.fund(5000)}, 4000)
+	h.accept(&final)
+	if _, err := h.pool.BumpFee(final.Hash(), 4000, 0, h.sign); err == nil {
+		t.Errorf("Expected an error bumping a transaction which does not signal")
+	}
+}
+
+func TestBumpFeeLongerSignature(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	original := h.spendWithSequence([]testOutput{h.fund(5000), h.fund(5000)}, 0, 2000, 7900)
+	child := h.spend([]testOutput{outputOf(&original, 0)}, 0)
+	h.accept(&original)
+	h.accept(&child)
+	rate := h.pool.pool[child.Hash()].FeeRate()
+
+	// The signatures BumpFee sizes the copy with are short, those it
+	// ends up with are as long as they come
+	calls := 0
+	sign := func(tx *chain.Tx, prevOuts []chain.OutputTx) error {
+		calls++
+		if err := h.sign(tx, prevOuts); err != nil {
+			return err
+		}
+		if calls == 1 {
+			for i := range tx.Vin {
+				unlock := script.Stack{Contents: []script.Operand{
+					script.SIG{Sig: make([]byte, 60)},
+					script.PUB_KEY_V1{Key: h.key.PublicKey.SerializeCompressed()},
+				}}
+				tx.Vin[i].ScriptSig = unlock.Ser().Bytes()
+			}
+		}
+		return nil
+	}
+
+	// The fee rate of the child sets the fee, not the one asked for or
+	// the fees of both
+	accepted, err := h.pool.BumpFee(original.Hash(), 1, 1, sign)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(accepted) != 1 || accepted[0].FeeRate() <= rate {
+		t.Errorf("Expected a fee rate above %d once signed", rate)
+	}
+}
+
+func TestMaxSignedSize(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	tx := h.spend([]testOutput{h.fund(5000), h.fund(5000)}, 9000)
+	size, err := maxSignedSize(&tx)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := int64(tx.Serialise().Len())
+	for i := range tx.Vin {
+		stack, _ := script.Marshall(bytes.NewBuffer(tx.Vin[i].ScriptSig))
+		expected += int64(maxSigLen - len(stack.Contents[0].Data()))
+	}
+	if size != expected {
+		t.Errorf("Expected %d, got %d", expected, size)
+	}
+}
+
+func TestReplacementTrimmed(t *testing.T) {
+	h := newPoolTestHarness(t, Config{})
+	funding := h.fund(5000)
+	original := h.spendWithSequence([]testOutput{funding}, 0, 4000)
+	mid := h.spend([]testOutput{h.fund(5000)}, 3000)
+	high := h.spend([]testOutput{h.fund(5000)}, 2900)
+	h.accept(&original)
+	h.accept(&mid)
+	h.accept(&high)
+	h.pool.cfg.MaxSize = h.pool.Size()
+	size := h.pool.Size()
+
+	// The replacement beats the fee and fee rate of the original, but
+	// its extra outputs take more room than the original frees and its
+	// fee rate is the lowest in the full pool
+	replacement := h.spend([]testOutput{funding}, 1200, 1200, 1100)
+	_, err := h.pool.ProcessTransaction(&replacement)
+	expectTxRuleError(t, err, ErrPoolFull)
+
+	for _, tx := range []*chain.Tx{&original, &mid, &high} {
+		if !h.pool.HaveTransaction(tx.Hash()) {
+			t.Errorf("Expected %s to stay in the pool", tx.Hash())
+		}
+	}
+	if h.pool.HaveTransaction(replacement.Hash()) {
+		t.Errorf("Expected the replacement to be rejected")
+	}
+	if h.pool.Size() != size {
+		t.Errorf("Expected pool size %d, got %d", size, h.pool.Size())
+	}
+
+	// The original is still linked, so a child can spend it
+	child := h.spend([]testOutput{outputOf(&original, 0)}, 3900)
+	h.pool.cfg.MaxSize = 2 * size
+	h.accept(&child)
+}
@@ -0,0 +1,215 @@
+package mining
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"spchain/chain"
+	"spchain/chainhash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hashUpdateBatch How many hashes a worker does before updating the
+// shared hash counter and checking for cancellation
+const hashUpdateBatch = 1024
+
+var (
+	// ErrInvalidTarget The header DifficultyTarget decodes to a
+	// target which can never be met
+	ErrInvalidTarget = errors.New("difficulty target must be positive")
+)
+
+// ExtraNonceFunc Called when the nonce space has been exhausted.
+// Given the next extra nonce it should update whatever the extra nonce
+// is committed to (usually the coinbase) and return the new merkle root
+// for the header
+type ExtraNonceFunc func(extraNonce uint64) chainhash.Hash
+
+// Config Options for a Miner
+type Config struct {
+	// Workers The number of goroutines searching the nonce space.
+	// Defaults to runtime.NumCPU()
+	Workers int
+	// HashrateInterval How often OnHashrate is called while solving
+	HashrateInterval time.Duration
+	// OnHashrate Optional callback reporting hashes per second
+	OnHashrate func(hashesPerSecond float64)
+}
+
+// Miner Searches for a BlockHeader.Nonce which makes the header hash
+// meet its DifficultyTarget
+type Miner struct {
+	cfg Config
+	// maxNonce The last nonce searched before rolling.
+	// Only lowered in tests
+	maxNonce uint32
+
+	hashes  uint64
+	mtx     sync.Mutex
+	started time.Time
+	elapsed time.Duration
+	running bool
+}
+
+// NewMiner Create a new miner
+func NewMiner(cfg Config) *Miner {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.HashrateInterval <= 0 {
+		cfg.HashrateInterval = 5 * time.Second
+	}
+	return &Miner{
+		cfg:      cfg,
+		maxNonce: math.MaxUint32,
+	}
+}
+
+// HashesDone The total number of header hashes calculated by this miner
+func (m *Miner) HashesDone() uint64 {
+	return atomic.LoadUint64(&m.hashes)
+}
+
+// Hashrate Hashes per second averaged over the time spent solving
+func (m *Miner) Hashrate() float64 {
+	m.mtx.Lock()
+	elapsed := m.elapsed
+	if m.running {
+		elapsed += time.Since(m.started)
+	}
+	m.mtx.Unlock()
+
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.HashesDone()) / elapsed.Seconds()
+}
+
+// Solve Search for a nonce satisfying the header DifficultyTarget.
+// On success the header is updated in place with the winning Nonce,
+// TimeStamp and MerkleRoot. When every nonce has been tried the extra
+// nonce is rolled through extraNonce, or the TimeStamp is incremented
+// if extraNonce is nil, and the search starts again.
+// Returns ctx.Err() if the context is cancelled first
+func (m *Miner) Solve(ctx context.Context, header *chain.BlockHeader, extraNonce ExtraNonceFunc) error {
+	target := HeaderTarget(header)
+	if target.Sign() <= 0 {
+		return ErrInvalidTarget
+	}
+
+	m.startClock()
+	defer m.stopClock()
+
+	stopReporting := m.reportHashrate()
+	defer stopReporting()
+
+	work := *header
+	for roll := uint64(1); ; roll++ {
+		solved, ok := m.searchNonces(ctx, work, target)
+		if ok {
+			*header = solved
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if extraNonce != nil {
+			work.MerkleRoot = extraNonce(roll)
+		} else {
+			work.TimeStamp++
+		}
+	}
+}
+
+// searchNonces Split the nonce space between the workers and
+// search it for a solution
+func (m *Miner) searchNonces(ctx context.Context, header chain.BlockHeader, target *big.Int) (chain.BlockHeader, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan chain.BlockHeader, m.cfg.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < m.cfg.Workers; i++ {
+		wg.Add(1)
+		go func(start uint64) {
+			defer wg.Done()
+			if solved, ok := m.searchStripe(ctx, header, target, start); ok {
+				results <- solved
+				cancel()
+			}
+		}(uint64(i))
+	}
+	wg.Wait()
+	close(results)
+
+	solved, ok := <-results
+	return solved, ok
+}
+
+// searchStripe Try every nonce start, start+Workers, ... up to maxNonce
+func (m *Miner) searchStripe(ctx context.Context, header chain.BlockHeader, target *big.Int, start uint64) (chain.BlockHeader, bool) {
+	step := uint64(m.cfg.Workers)
+	var batch uint64
+	defer func() { atomic.AddUint64(&m.hashes, batch) }()
+
+	for nonce := start; nonce <= uint64(m.maxNonce); nonce += step {
+		header.Nonce = int32(uint32(nonce))
+		batch++
+		if HashToBig(header.Hash()).Cmp(target) <= 0 {
+			return header, true
+		}
+
+		if batch == hashUpdateBatch {
+			atomic.AddUint64(&m.hashes, batch)
+			batch = 0
+			select {
+			case <-ctx.Done():
+				return header, false
+			default:
+			}
+		}
+	}
+	return header, false
+}
+
+// reportHashrate Periodically call OnHashrate until the returned
+// function is called
+func (m *Miner) reportHashrate() func() {
+	if m.cfg.OnHashrate == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(m.cfg.HashrateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.cfg.OnHashrate(m.Hashrate())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (m *Miner) startClock() {
+	m.mtx.Lock()
+	m.started = time.Now()
+	m.running = true
+	m.mtx.Unlock()
+}
+
+func (m *Miner) stopClock() {
+	m.mtx.Lock()
+	m.elapsed += time.Since(m.started)
+	m.running = false
+	m.mtx.Unlock()
+}
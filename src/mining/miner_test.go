@@ -0,0 +1,146 @@
+package mining
+
+import (
+	"context"
+	"encoding/binary"
+	"spchain/chain"
+	"spchain/chainhash"
+	"testing"
+	"time"
+)
+
+func easyHeader() chain.BlockHeader {
+	return chain.BlockHeader{
+		Version:          1,
+		TimeStamp:        1550000000,
+		DifficultyTarget: 0x207fffff,
+	}
+}
+
+func TestSolve(t *testing.T) {
+	header := easyHeader()
+	header.DifficultyTarget = 0x1f00ffff
+
+	miner := NewMiner(Config{Workers: 4})
+	err := miner.Solve(context.Background(), &header, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if !CheckProofOfWork(&header) {
+		t.Errorf("Solved header does not meet its target")
+	}
+
+	if miner.HashesDone() == 0 {
+		t.Errorf("Expected hashes to be counted")
+	}
+
+	if miner.Hashrate() <= 0 {
+		t.Errorf("Expected a positive hashrate")
+	}
+}
+
+func TestSolveCancel(t *testing.T) {
+	header := easyHeader()
+	// A target of 1 is practically impossible
+	header.DifficultyTarget = 0x01010000
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	miner := NewMiner(Config{Workers: 2})
+	err := miner.Solve(ctx, &header, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %s, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestSolveInvalidTarget(t *testing.T) {
+	header := easyHeader()
+	header.DifficultyTarget = 0
+
+	miner := NewMiner(Config{})
+	if err := miner.Solve(context.Background(), &header, nil); err != ErrInvalidTarget {
+		t.Errorf("Expected %s, got %v", ErrInvalidTarget, err)
+	}
+}
+
+func TestSolveRollsTimeStamp(t *testing.T) {
+	header := easyHeader()
+	header.DifficultyTarget = 0x2000ffff
+	startTime := header.TimeStamp
+
+	// Only two nonces per round so the timestamp must roll
+	miner := NewMiner(Config{Workers: 2})
+	miner.maxNonce = 1
+	if err := miner.Solve(context.Background(), &header, nil); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if header.Nonce > 1 {
+		t.Errorf("Expected nonce to stay within the limit, got %d", header.Nonce)
+	}
+	if header.TimeStamp < startTime {
+		t.Errorf("TimeStamp should only roll forward")
+	}
+	if !CheckProofOfWork(&header) {
+		t.Errorf("Solved header does not meet its target")
+	}
+}
+
+func TestSolveRollsExtraNonce(t *testing.T) {
+	header := easyHeader()
+	header.DifficultyTarget = 0x2000ffff
+	startTime := header.TimeStamp
+
+	rolled := uint64(0)
+	extraNonce := func(n uint64) chainhash.Hash {
+		rolled = n
+		var root chainhash.Hash
+		binary.LittleEndian.PutUint64(root[:], n)
+		return root
+	}
+
+	miner := NewMiner(Config{Workers: 1})
+	miner.maxNonce = 0
+	if err := miner.Solve(context.Background(), &header, extraNonce); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if !CheckProofOfWork(&header) {
+		t.Errorf("Solved header does not meet its target")
+	}
+	if header.TimeStamp != startTime {
+		t.Errorf("TimeStamp should not roll when an extra nonce func is given")
+	}
+	if rolled > 0 && binary.LittleEndian.Uint64(header.MerkleRoot[:]) != rolled {
+		t.Errorf("Expected merkle root from extra nonce %d", rolled)
+	}
+}
+
+func TestHashrateReport(t *testing.T) {
+	header := easyHeader()
+	header.DifficultyTarget = 0x01010000
+
+	reports := make(chan float64, 10)
+	miner := NewMiner(Config{
+		Workers:          1,
+		HashrateInterval: 10 * time.Millisecond,
+		OnHashrate: func(rate float64) {
+			select {
+			case reports <- rate:
+			default:
+			}
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	miner.Solve(ctx, &header, nil)
+
+	select {
+	case <-reports:
+	default:
+		t.Errorf("Expected at least one hashrate report")
+	}
+}
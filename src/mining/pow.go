@@ -0,0 +1,113 @@
+package mining
+
+import (
+	"math/big"
+	"spchain/chain"
+	"spchain/chainhash"
+)
+
+var (
+	// bigOne 1 as a big.Int
+	bigOne = big.NewInt(1)
+
+	// oneLsh256 1 shifted left 256 bits. Used to calculate the work
+	// represented by a target
+	oneLsh256 = new(big.Int).Lsh(bigOne, 256)
+)
+
+// CompactToBig Decode the compact representation used by
+// BlockHeader.DifficultyTarget into a big integer.
+// The compact form is a 32 bit number where the most significant byte
+// is the size of the number in bytes (the exponent), the next bit is the
+// sign and the remaining 23 bits are the mantissa:
+//
+//	N = (-1^sign) * mantissa * 256^(exponent-3)
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+
+	return bn
+}
+
+// BigToCompact Encode a big integer into the compact representation
+// used by BlockHeader.DifficultyTarget. Precision below the 3 most
+// significant bytes is lost
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Abs(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// The sign bit is set, so shift the mantissa down and bump
+	// the exponent so the number is not read as negative
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// HashToBig Interpret a double SHA256 hash as a little endian
+// 256 bit number so it can be compared against a target
+func HashToBig(hash chainhash.Hash) *big.Int {
+	reversed := hash
+	for i := 0; i < len(reversed)/2; i++ {
+		reversed[i], reversed[len(reversed)-1-i] = reversed[len(reversed)-1-i], reversed[i]
+	}
+	return new(big.Int).SetBytes(reversed[:])
+}
+
+// HeaderTarget The target a BlockHeader hash must be less than
+// or equal to
+func HeaderTarget(header *chain.BlockHeader) *big.Int {
+	return CompactToBig(uint32(header.DifficultyTarget))
+}
+
+// CalcWork The expected number of hashes required to find a hash
+// below the compact target: 2^256 / (target+1)
+func CalcWork(compact uint32) *big.Int {
+	target := CompactToBig(compact)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	denominator := new(big.Int).Add(target, bigOne)
+	return new(big.Int).Div(oneLsh256, denominator)
+}
+
+// CheckProofOfWork True if the header hash satisfies its own
+// DifficultyTarget
+func CheckProofOfWork(header *chain.BlockHeader) bool {
+	target := HeaderTarget(header)
+	if target.Sign() <= 0 {
+		return false
+	}
+	return HashToBig(header.Hash()).Cmp(target) <= 0
+}
@@ -0,0 +1,73 @@
+package mining
+
+import (
+	"math/big"
+	"spchain/chainhash"
+	"testing"
+)
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact  uint32
+		expected string
+	}{
+		{0x1d00ffff, "00000000ffff0000000000000000000000000000000000000000000000000000"},
+		{0x207fffff, "7fffff0000000000000000000000000000000000000000000000000000000000"},
+		{0x1903a30c, "0000000000000003a30c00000000000000000000000000000000000000000000"},
+		{0x01003456, "00"},
+		{0x02123456, "1234"},
+	}
+
+	for _, test := range tests {
+		expected, _ := new(big.Int).SetString(test.expected, 16)
+		got := CompactToBig(test.compact)
+		if got.Cmp(expected) != 0 {
+			t.Errorf("CompactToBig(%#x) expected %x, got %x", test.compact, expected, got)
+		}
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	for _, compact := range []uint32{0x1d00ffff, 0x207fffff, 0x1903a30c, 0x02123400, 0x05009234} {
+		got := BigToCompact(CompactToBig(compact))
+		if got != compact {
+			t.Errorf("BigToCompact round trip expected %#x, got %#x", compact, got)
+		}
+	}
+
+	if got := BigToCompact(big.NewInt(0)); got != 0 {
+		t.Errorf("Expected 0, got %#x", got)
+	}
+
+	if got := BigToCompact(big.NewInt(-0x12)); got != 0x01920000 {
+		t.Errorf("Expected %#x, got %#x", 0x01920000, got)
+	}
+}
+
+func TestHashToBig(t *testing.T) {
+	hash := chainhash.Hash{}
+	hash[0] = 0x01
+	hash[31] = 0x02
+
+	expected := new(big.Int).Lsh(big.NewInt(2), 248)
+	expected.Add(expected, big.NewInt(1))
+	if got := HashToBig(hash); got.Cmp(expected) != 0 {
+		t.Errorf("Expected %x, got %x", expected, got)
+	}
+
+	if hash[0] != 0x01 {
+		t.Errorf("HashToBig modified its argument")
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	// The genesis difficulty of bitcoin represents 2^32 + 2^16 + 1 hashes
+	expected := big.NewInt(0x100010001)
+	if got := CalcWork(0x1d00ffff); got.Cmp(expected) != 0 {
+		t.Errorf("Expected %d, got %d", expected, got)
+	}
+
+	if got := CalcWork(0x01003456); got.Sign() != 0 {
+		t.Errorf("Expected no work for a zero target, got %d", got)
+	}
+}
@@ -0,0 +1,373 @@
+package script
+
+import (
+	"fmt"
+)
+
+/*
+  The arithmetic operands work on NUMBERs of at most 4 bytes, from
+  -2^31+1 to 2^31-1. Results may be longer, they can be pushed and
+  compared by OP_EQUAL but not used by another arithmetic operand.
+  Results which are true or false are pushed as 1 or 0.
+*/
+
+// boolNum 1 if b is true, 0 otherwise
+func boolNum(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// unaryOp Replace the top stack number n by f(n)
+func unaryOp(s *Stack, f func(n int64) int64) error {
+	n, err := popInt(s)
+	if err != nil {
+		return err
+	}
+	s.Push(NewNumber(f(n)))
+	return nil
+}
+
+// binaryOp Replace the top stack number b and the second a by f(a, b)
+func binaryOp(s *Stack, f func(a, b int64) int64) error {
+	b, err := popInt(s)
+	if err != nil {
+		return err
+	}
+	a, err := popInt(s)
+	if err != nil {
+		return err
+	}
+	s.Push(NewNumber(f(a, b)))
+	return nil
+}
+
+// OP_1ADD Adds 1 to the top stack number
+type OP_1ADD struct{}
+
+func (OP_1ADD) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := unaryOp(s, func(n int64) int64 { return n + 1 }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_1ADD) AsByte() byte { return OP_1ADD_BYTE }
+func (OP_1ADD) LenData() int { return 0 }
+func (OP_1ADD) Data() []byte { return []byte{0x00} }
+func (OP_1ADD) Name() string { return "OP_1ADD" }
+func (OP_1ADD) Copy() Operand {
+	return OP_1ADD{}
+}
+
+// OP_1SUB Subtracts 1 from the top stack number
+type OP_1SUB struct{}
+
+func (OP_1SUB) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := unaryOp(s, func(n int64) int64 { return n - 1 }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_1SUB) AsByte() byte { return OP_1SUB_BYTE }
+func (OP_1SUB) LenData() int { return 0 }
+func (OP_1SUB) Data() []byte { return []byte{0x00} }
+func (OP_1SUB) Name() string { return "OP_1SUB" }
+func (OP_1SUB) Copy() Operand {
+	return OP_1SUB{}
+}
+
+// OP_NEGATE Flips the sign of the top stack number
+type OP_NEGATE struct{}
+
+func (OP_NEGATE) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := unaryOp(s, func(n int64) int64 { return -n }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_NEGATE) AsByte() byte { return OP_NEGATE_BYTE }
+func (OP_NEGATE) LenData() int { return 0 }
+func (OP_NEGATE) Data() []byte { return []byte{0x00} }
+func (OP_NEGATE) Name() string { return "OP_NEGATE" }
+func (OP_NEGATE) Copy() Operand {
+	return OP_NEGATE{}
+}
+
+// OP_ABS Makes the top stack number positive
+type OP_ABS struct{}
+
+func (OP_ABS) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := unaryOp(s, func(n int64) int64 {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_ABS) AsByte() byte { return OP_ABS_BYTE }
+func (OP_ABS) LenData() int { return 0 }
+func (OP_ABS) Data() []byte { return []byte{0x00} }
+func (OP_ABS) Name() string { return "OP_ABS" }
+func (OP_ABS) Copy() Operand {
+	return OP_ABS{}
+}
+
+// OP_NOT Replaces the top stack number by 1 if it is 0, 0 otherwise
+type OP_NOT struct{}
+
+func (OP_NOT) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := unaryOp(s, func(n int64) int64 { return boolNum(n == 0) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_NOT) AsByte() byte { return OP_NOT_BYTE }
+func (OP_NOT) LenData() int { return 0 }
+func (OP_NOT) Data() []byte { return []byte{0x00} }
+func (OP_NOT) Name() string { return "OP_NOT" }
+func (OP_NOT) Copy() Operand {
+	return OP_NOT{}
+}
+
+// OP_0NOTEQUAL Replaces the top stack number by 0 if it is 0, 1 otherwise
+type OP_0NOTEQUAL struct{}
+
+func (OP_0NOTEQUAL) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := unaryOp(s, func(n int64) int64 { return boolNum(n != 0) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_0NOTEQUAL) AsByte() byte { return OP_0NOTEQUAL_BYTE }
+func (OP_0NOTEQUAL) LenData() int { return 0 }
+func (OP_0NOTEQUAL) Data() []byte { return []byte{0x00} }
+func (OP_0NOTEQUAL) Name() string { return "OP_0NOTEQUAL" }
+func (OP_0NOTEQUAL) Copy() Operand {
+	return OP_0NOTEQUAL{}
+}
+
+// OP_ADD Replaces the top two stack numbers by their sum
+type OP_ADD struct{}
+
+func (OP_ADD) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return a + b }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_ADD) AsByte() byte { return OP_ADD_BYTE }
+func (OP_ADD) LenData() int { return 0 }
+func (OP_ADD) Data() []byte { return []byte{0x00} }
+func (OP_ADD) Name() string { return "OP_ADD" }
+func (OP_ADD) Copy() Operand {
+	return OP_ADD{}
+}
+
+// OP_SUB Replaces the top two stack numbers by the second
+// minus the top
+type OP_SUB struct{}
+
+func (OP_SUB) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return a - b }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_SUB) AsByte() byte { return OP_SUB_BYTE }
+func (OP_SUB) LenData() int { return 0 }
+func (OP_SUB) Data() []byte { return []byte{0x00} }
+func (OP_SUB) Name() string { return "OP_SUB" }
+func (OP_SUB) Copy() Operand {
+	return OP_SUB{}
+}
+
+// OP_BOOLAND Replaces the top two stack numbers by 1 if both are
+// not 0, 0 otherwise
+type OP_BOOLAND struct{}
+
+func (OP_BOOLAND) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return boolNum(a != 0 && b != 0) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_BOOLAND) AsByte() byte { return OP_BOOLAND_BYTE }
+func (OP_BOOLAND) LenData() int { return 0 }
+func (OP_BOOLAND) Data() []byte { return []byte{0x00} }
+func (OP_BOOLAND) Name() string { return "OP_BOOLAND" }
+func (OP_BOOLAND) Copy() Operand {
+	return OP_BOOLAND{}
+}
+
+// OP_BOOLOR Replaces the top two stack numbers by 1 if either is
+// not 0, 0 otherwise
+type OP_BOOLOR struct{}
+
+func (OP_BOOLOR) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return boolNum(a != 0 || b != 0) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_BOOLOR) AsByte() byte { return OP_BOOLOR_BYTE }
+func (OP_BOOLOR) LenData() int { return 0 }
+func (OP_BOOLOR) Data() []byte { return []byte{0x00} }
+func (OP_BOOLOR) Name() string { return "OP_BOOLOR" }
+func (OP_BOOLOR) Copy() Operand {
+	return OP_BOOLOR{}
+}
+
+// OP_NUMEQUAL Replaces the top two stack numbers by 1 if they are
+// equal, 0 otherwise
+type OP_NUMEQUAL struct{}
+
+func (OP_NUMEQUAL) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return boolNum(a == b) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_NUMEQUAL) AsByte() byte { return OP_NUMEQUAL_BYTE }
+func (OP_NUMEQUAL) LenData() int { return 0 }
+func (OP_NUMEQUAL) Data() []byte { return []byte{0x00} }
+func (OP_NUMEQUAL) Name() string { return "OP_NUMEQUAL" }
+func (OP_NUMEQUAL) Copy() Operand {
+	return OP_NUMEQUAL{}
+}
+
+// OP_NUMEQUALVERIFY OP_NUMEQUAL then OP_VERIFY
+type OP_NUMEQUALVERIFY struct{}
+
+func (OP_NUMEQUALVERIFY) Work(s *Stack, w ScriptContext) (bool, error) {
+	b, err := popInt(s)
+	if err != nil {
+		return false, err
+	}
+	a, err := popInt(s)
+	if err != nil {
+		return false, err
+	}
+	if a != b {
+		return false, &VerifyError{fmt.Sprintf("%d is not equal to %d", a, b)}
+	}
+	return true, nil
+}
+func (OP_NUMEQUALVERIFY) AsByte() byte { return OP_NUMEQUALVERIFY_BYTE }
+func (OP_NUMEQUALVERIFY) LenData() int { return 0 }
+func (OP_NUMEQUALVERIFY) Data() []byte { return []byte{0x00} }
+func (OP_NUMEQUALVERIFY) Name() string { return "OP_NUMEQUALVERIFY" }
+func (OP_NUMEQUALVERIFY) Copy() Operand {
+	return OP_NUMEQUALVERIFY{}
+}
+
+// OP_LESSTHAN Replaces the top two stack numbers by 1 if the second
+// is less than the top, 0 otherwise
+type OP_LESSTHAN struct{}
+
+func (OP_LESSTHAN) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return boolNum(a < b) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_LESSTHAN) AsByte() byte { return OP_LESSTHAN_BYTE }
+func (OP_LESSTHAN) LenData() int { return 0 }
+func (OP_LESSTHAN) Data() []byte { return []byte{0x00} }
+func (OP_LESSTHAN) Name() string { return "OP_LESSTHAN" }
+func (OP_LESSTHAN) Copy() Operand {
+	return OP_LESSTHAN{}
+}
+
+// OP_GREATERTHAN Replaces the top two stack numbers by 1 if the second
+// is greater than the top, 0 otherwise
+type OP_GREATERTHAN struct{}
+
+func (OP_GREATERTHAN) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 { return boolNum(a > b) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_GREATERTHAN) AsByte() byte { return OP_GREATERTHAN_BYTE }
+func (OP_GREATERTHAN) LenData() int { return 0 }
+func (OP_GREATERTHAN) Data() []byte { return []byte{0x00} }
+func (OP_GREATERTHAN) Name() string { return "OP_GREATERTHAN" }
+func (OP_GREATERTHAN) Copy() Operand {
+	return OP_GREATERTHAN{}
+}
+
+// OP_MIN Replaces the top two stack numbers by the smaller
+type OP_MIN struct{}
+
+func (OP_MIN) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 {
+		if a < b {
+			return a
+		}
+		return b
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_MIN) AsByte() byte { return OP_MIN_BYTE }
+func (OP_MIN) LenData() int { return 0 }
+func (OP_MIN) Data() []byte { return []byte{0x00} }
+func (OP_MIN) Name() string { return "OP_MIN" }
+func (OP_MIN) Copy() Operand {
+	return OP_MIN{}
+}
+
+// OP_MAX Replaces the top two stack numbers by the larger
+type OP_MAX struct{}
+
+func (OP_MAX) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := binaryOp(s, func(a, b int64) int64 {
+		if a > b {
+			return a
+		}
+		return b
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_MAX) AsByte() byte { return OP_MAX_BYTE }
+func (OP_MAX) LenData() int { return 0 }
+func (OP_MAX) Data() []byte { return []byte{0x00} }
+func (OP_MAX) Name() string { return "OP_MAX" }
+func (OP_MAX) Copy() Operand {
+	return OP_MAX{}
+}
+
+// OP_WITHIN Replaces the top three stack numbers x min max by 1
+// if min <= x < max, 0 otherwise
+type OP_WITHIN struct{}
+
+func (OP_WITHIN) Work(s *Stack, w ScriptContext) (bool, error) {
+	max, err := popInt(s)
+	if err != nil {
+		return false, err
+	}
+	min, err := popInt(s)
+	if err != nil {
+		return false, err
+	}
+	x, err := popInt(s)
+	if err != nil {
+		return false, err
+	}
+	s.Push(NewNumber(boolNum(min <= x && x < max)))
+	return true, nil
+}
+func (OP_WITHIN) AsByte() byte { return OP_WITHIN_BYTE }
+func (OP_WITHIN) LenData() int { return 0 }
+func (OP_WITHIN) Data() []byte { return []byte{0x00} }
+func (OP_WITHIN) Name() string { return "OP_WITHIN" }
+func (OP_WITHIN) Copy() Operand {
+	return OP_WITHIN{}
+}
@@ -0,0 +1,135 @@
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		op       Operand
+		args     []int64
+		expected int64
+	}{
+		{OP_1ADD{}, []int64{5}, 6},
+		{OP_1ADD{}, []int64{-1}, 0},
+		{OP_1SUB{}, []int64{0}, -1},
+		{OP_NEGATE{}, []int64{7}, -7},
+		{OP_NEGATE{}, []int64{-7}, 7},
+		{OP_ABS{}, []int64{-300}, 300},
+		{OP_ABS{}, []int64{300}, 300},
+		{OP_NOT{}, []int64{0}, 1},
+		{OP_NOT{}, []int64{-2}, 0},
+		{OP_0NOTEQUAL{}, []int64{0}, 0},
+		{OP_0NOTEQUAL{}, []int64{-2}, 1},
+		{OP_ADD{}, []int64{2, 3}, 5},
+		{OP_ADD{}, []int64{0x7fffffff, 0x7fffffff}, 0xfffffffe},
+		{OP_SUB{}, []int64{2, 3}, -1},
+		{OP_BOOLAND{}, []int64{1, 5}, 1},
+		{OP_BOOLAND{}, []int64{1, 0}, 0},
+		{OP_BOOLOR{}, []int64{0, -1}, 1},
+		{OP_BOOLOR{}, []int64{0, 0}, 0},
+		{OP_NUMEQUAL{}, []int64{4, 4}, 1},
+		{OP_NUMEQUAL{}, []int64{4, -4}, 0},
+		{OP_LESSTHAN{}, []int64{2, 3}, 1},
+		{OP_LESSTHAN{}, []int64{3, 3}, 0},
+		{OP_GREATERTHAN{}, []int64{3, 2}, 1},
+		{OP_GREATERTHAN{}, []int64{-3, 2}, 0},
+		{OP_MIN{}, []int64{-3, 2}, -3},
+		{OP_MAX{}, []int64{-3, 2}, 2},
+		{OP_WITHIN{}, []int64{5, 5, 10}, 1},
+		{OP_WITHIN{}, []int64{10, 5, 10}, 0},
+		{OP_WITHIN{}, []int64{-1, 5, 10}, 0},
+	}
+	for _, test := range tests {
+		s := Stack{}
+		for _, arg := range test.args {
+			s.Push(NewNumber(arg))
+		}
+		if _, err := test.op.Work(&s, &fakedScriptContext{}); err != nil {
+			t.Errorf("%s %v: unexpected error %s", test.op.Name(), test.args, err)
+			continue
+		}
+		if len(s.Contents) != 1 {
+			t.Errorf("%s %v: expected one item left, got %d", test.op.Name(), test.args, len(s.Contents))
+			continue
+		}
+		if !bytes.Equal(s.Contents[0].Data(), encodeNum(test.expected)) {
+			t.Errorf("%s %v: expected %d, got 0x%x", test.op.Name(), test.args, test.expected, s.Contents[0].Data())
+		}
+	}
+}
+
+func TestNumEqualVerify(t *testing.T) {
+	s := Stack{[]Operand{NewNumber(1), NewNumber(9), NewNumber(9)}}
+	if _, err := (OP_NUMEQUALVERIFY{}).Work(&s, &fakedScriptContext{}); err != nil || len(s.Contents) != 1 {
+		t.Errorf("Expected equal numbers to be removed, got %v %v", s.Contents, err)
+	}
+
+	err := runEngine(t, []Operand{NewNumber(9), NewNumber(8)}, []Operand{OP_NUMEQUALVERIFY{}, NewNumber(1)})
+	expectScriptError(t, "not equal", err, ErrVerify, 2)
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	tooLong := NUMBER{Num: encodeNum(0x7fffffff + 1)}
+	notMinimal := NUMBER{Num: []byte{0x01, 0x00}}
+	tests := []struct {
+		name      string
+		unlocking []Operand
+		locking   []Operand
+		code      ErrorCode
+		index     int
+	}{
+		{"5 byte number", []Operand{tooLong}, []Operand{OP_1ADD{}}, ErrNumber, 1},
+		{"5 byte result", []Operand{NewNumber(0x7fffffff)}, []Operand{OP_1ADD{}, OP_1ADD{}}, ErrNumber, 2},
+		{"not minimal", []Operand{notMinimal, NewNumber(1)}, []Operand{OP_ADD{}}, ErrNumber, 2},
+		{"not a number", []Operand{PUB_KEY_V1{Key: []byte{1}}}, []Operand{OP_NOT{}}, ErrInvalidType, 1},
+		{"add underflow", []Operand{NewNumber(1)}, []Operand{OP_ADD{}}, ErrStackUnderflow, 1},
+		{"within underflow", []Operand{NewNumber(1), NewNumber(2)}, []Operand{OP_WITHIN{}}, ErrStackUnderflow, 2},
+	}
+	for _, test := range tests {
+		err := runEngine(t, test.unlocking, test.locking)
+		expectScriptError(t, test.name, err, test.code, test.index)
+	}
+}
+
+func TestArithmeticWorkFails(t *testing.T) {
+	ops := []Operand{
+		OP_1ADD{}, OP_1SUB{}, OP_NEGATE{}, OP_ABS{}, OP_NOT{}, OP_0NOTEQUAL{},
+		OP_ADD{}, OP_SUB{}, OP_BOOLAND{}, OP_BOOLOR{}, OP_NUMEQUAL{},
+		OP_LESSTHAN{}, OP_GREATERTHAN{}, OP_MIN{}, OP_MAX{},
+	}
+	for _, op := range ops {
+		stack := Stack{}
+		ok, err := op.Work(&stack, &fakedScriptContext{})
+		if ok || err == nil {
+			t.Errorf("%s: expected false with an error on an empty stack, got %t %v", op.Name(), ok, err)
+		}
+	}
+
+	// The engine stops at the failing operand with a typed error
+	err := runEngine(t, []Operand{NewNumber(1)}, []Operand{OP_ADD{}, NewNumber(1)})
+	expectScriptError(t, "add underflow", err, ErrStackUnderflow, 1)
+}
+
+func TestArithmeticScript(t *testing.T) {
+	// The unlocking number must be from 10 to 19 and its double more
+	// than 25
+	locking := []Operand{
+		OP_DUP{}, NewNumber(10), NewNumber(20), OP_WITHIN{}, OP_VERIFY{},
+		OP_DUP{}, OP_ADD{}, NewNumber(25), OP_GREATERTHAN{},
+	}
+	if err := runEngine(t, []Operand{NewNumber(13)}, locking); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	expectScriptError(t, "double too small", runEngine(t, []Operand{NewNumber(12)}, locking), ErrEvalFalse, -1)
+	expectScriptError(t, "out of range", runEngine(t, []Operand{NewNumber(20)}, locking), ErrVerify, 5)
+
+	asm, err := Disassemble(Stack{locking}.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if asm != "OP_DUP NUMBER[10] NUMBER[20] OP_WITHIN OP_VERIFY OP_DUP OP_ADD NUMBER[25] OP_GREATERTHAN" {
+		t.Errorf("Unexpected asm %s", asm)
+	}
+}
@@ -0,0 +1,163 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+  The Engine checks an input may spend an output. The unlocking script
+  from the input ScriptSig runs first, then the locking script from the
+  output ScriptPubKey runs on the stack it leaves behind. The spend is
+  valid if every operand succeeds and the item left on top of the stack
+  is true.
+
+  Operands inside a branch which is not taken are skipped, see
+  flow.go.
+
+  When the ScriptPubKey pays to a script hash the redeem script, the
+  SCRIPT pushed last by the ScriptSig, runs third. The locking script
+  has already checked its hash by then.
+*/
+
+// Engine Runs the unlocking and locking scripts of an input
+type Engine struct {
+	ctx ScriptContext
+	// scripts The ScriptSig then the ScriptPubKey operands, then the
+	// redeem script operands when paying to a script hash
+	scripts []Stack
+	stack   Stack
+	// conds The branches of the script being run
+	conds condStack
+}
+
+// NewEngine An Engine for scriptSig spending an output locked by
+// scriptPubKey. Returns a *ScriptError if either does not parse, or
+// if scriptPubKey pays to a script hash and scriptSig has no valid
+// redeem script
+func NewEngine(ctx ScriptContext, scriptSig []byte, scriptPubKey []byte) (*Engine, error) {
+	unlocking, err := Marshall(bytes.NewBuffer(append([]byte{}, scriptSig...)))
+	if err != nil {
+		return nil, scriptError(ErrMalformedScript, -1, fmt.Sprintf("Invalid ScriptSig: %s", err))
+	}
+	locking, err := Marshall(bytes.NewBuffer(append([]byte{}, scriptPubKey...)))
+	if err != nil {
+		return nil, scriptError(ErrMalformedScript, -1, fmt.Sprintf("Invalid ScriptPubKey: %s", err))
+	}
+	if len(locking.Contents) == 0 {
+		return nil, scriptError(ErrEmptyScript, -1, "Empty ScriptPubKey")
+	}
+	scripts := []Stack{unlocking, locking}
+	if isPayToScriptHash(locking) {
+		redeem, err := redeemScript(unlocking)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, redeem)
+	}
+	return &Engine{ctx: ctx, scripts: scripts}, nil
+}
+
+// redeemScript The redeem script of a ScriptSig spending a pay to
+// script hash output. The ScriptSig may only push data and must end
+// with a SCRIPT
+func redeemScript(unlocking Stack) (Stack, error) {
+	for i, op := range unlocking.Contents {
+		if !isPush(op) {
+			return Stack{}, scriptError(ErrSigPushOnly, i,
+				fmt.Sprintf("%s at operand %d in a pay to script hash ScriptSig", op.Name(), i))
+		}
+	}
+	last, err := unlocking.Top()
+	if err != nil {
+		return Stack{}, scriptError(ErrStackUnderflow, -1, "Pay to script hash ScriptSig has no redeem script")
+	}
+	push, ok := last.(SCRIPT)
+	if !ok {
+		index := len(unlocking.Contents) - 1
+		return Stack{}, scriptError(ErrInvalidType, index,
+			fmt.Sprintf("Expected a %s at operand %d, got %s", SCRIPT{}.Name(), index, last.Name()))
+	}
+	redeem, err := Marshall(bytes.NewBuffer(push.Data()))
+	if err != nil {
+		return Stack{}, scriptError(ErrMalformedScript, -1, fmt.Sprintf("Invalid redeem script: %s", err))
+	}
+	return redeem, nil
+}
+
+// Stack The stack as the scripts left it
+func (e *Engine) Stack() Stack {
+	return e.stack
+}
+
+// Execute Run the scripts. Returns a *ScriptError saying which
+// operand failed and why
+func (e *Engine) Execute() error {
+	index := 0
+	for _, script := range e.scripts {
+		for _, op := range script.Contents {
+			if err := e.step(op, index); err != nil {
+				return err
+			}
+			index++
+		}
+		if len(e.conds) > 0 {
+			return scriptError(ErrUnbalancedConditional, -1,
+				fmt.Sprintf("Script ends inside %d OP_IF or OP_NOTIF", len(e.conds)))
+		}
+	}
+
+	top, err := e.stack.Top()
+	if err != nil {
+		return scriptError(ErrEvalFalse, -1, "Stack is empty after running the scripts")
+	}
+	if !asBool(top) {
+		return scriptError(ErrEvalFalse, -1, fmt.Sprintf("Scripts finished with false %s on the stack", top.Name()))
+	}
+	return nil
+}
+
+// step Run op, the operand at index. Only branch operands run inside
+// a branch which is not taken
+func (e *Engine) step(op Operand, index int) error {
+	if c, ok := op.(conditional); ok {
+		if err := c.branch(&e.stack, &e.conds); err != nil {
+			return operandError(op, index, err)
+		}
+		return nil
+	}
+	if !e.conds.executing() {
+		return nil
+	}
+
+	ok, err := op.Work(&e.stack, e.ctx)
+	if err != nil {
+		return operandError(op, index, err)
+	}
+	if !ok {
+		return scriptError(ErrVerify, index, fmt.Sprintf("%s at operand %d failed", op.Name(), index))
+	}
+	return nil
+}
+
+// operandError The ScriptError for err from op, the operand at index
+func operandError(op Operand, index int, err error) *ScriptError {
+	return scriptError(operandErrorCode(err), index,
+		fmt.Sprintf("%s at operand %d: %s", op.Name(), index, err))
+}
+
+// asBool The truth of a stack item. Data which is all zero bytes,
+// or all zero apart from the sign bit of the last byte, is false
+func asBool(op Operand) bool {
+	data := op.Data()
+	for i, b := range data {
+		if b != 0 {
+			// Negative zero
+			if i == len(data)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package script
+
+import (
+	"testing"
+)
+
+// runEngine Run unlocking then locking with a context which accepts
+// every signature and lock time
+func runEngine(t *testing.T, unlocking []Operand, locking []Operand) error {
+	t.Helper()
+	engine, err := NewEngine(&fakedScriptContext{}, Stack{unlocking}.Ser().Bytes(), Stack{locking}.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return engine.Execute()
+}
+
+func expectScriptError(t *testing.T, name string, err error, code ErrorCode, index int) {
+	t.Helper()
+	scriptErr, ok := err.(*ScriptError)
+	if !ok {
+		t.Errorf("%s: expected a ScriptError, got %v", name, err)
+		return
+	}
+	if scriptErr.Code != code || scriptErr.Index != index {
+		t.Errorf("%s: expected %s at %d, got %s at %d", name, code, index, scriptErr.Code, scriptErr.Index)
+	}
+}
+
+func TestEngineExecute(t *testing.T) {
+	key := PUB_KEY_V1{Key: []byte{1, 2, 3}}
+	if err := runEngine(t, []Operand{key}, []Operand{OP_DUP{}, OP_EQUALVERIFY{}, NewNumber(1)}); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	engine, _ := NewEngine(&fakedScriptContext{}, Stack{[]Operand{key}}.Ser().Bytes(), Stack{[]Operand{OP_DUP{}}}.Ser().Bytes())
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if stack := engine.Stack(); len(stack.Contents) != 2 {
+		t.Errorf("Expected 2 items left on the stack, got %d", len(stack.Contents))
+	}
+}
+
+func TestEngineErrors(t *testing.T) {
+	key := PUB_KEY_V1{Key: []byte{1, 2, 3}}
+	tests := []struct {
+		name      string
+		unlocking []Operand
+		locking   []Operand
+		code      ErrorCode
+		index     int
+	}{
+		{"underflow in the unlocking script", []Operand{OP_DUP{}}, []Operand{OP_DROP{}}, ErrStackUnderflow, 0},
+		{"underflow in the locking script", []Operand{key}, []Operand{OP_DROP{}, OP_DROP{}}, ErrStackUnderflow, 2},
+		{"equal verify underflow", []Operand{key}, []Operand{OP_EQUALVERIFY{}}, ErrStackUnderflow, 1},
+		{"checksig underflow", []Operand{}, []Operand{OP_CHECKSIG{}}, ErrStackUnderflow, 0},
+		{"not equal", []Operand{key, PUB_KEY_V1{Key: []byte{4}}}, []Operand{OP_EQUALVERIFY{}}, ErrVerify, 2},
+		{"hash of a signature", []Operand{SIG{Sig: []byte{1}}}, []Operand{OP_HASH_160{}}, ErrInvalidType, 1},
+		{"lock time of a key", []Operand{key}, []Operand{OP_CHECKLOCKTIMEVERIFY{}}, ErrInvalidType, 1},
+		{"empty final stack", []Operand{key}, []Operand{OP_DROP{}}, ErrEvalFalse, -1},
+		{"false final stack", []Operand{}, []Operand{NewNumber(0)}, ErrEvalFalse, -1},
+		{"negative zero final stack", []Operand{}, []Operand{NUMBER{Num: []byte{0x80}}}, ErrEvalFalse, -1},
+	}
+	for _, test := range tests {
+		err := runEngine(t, test.unlocking, test.locking)
+		expectScriptError(t, test.name, err, test.code, test.index)
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	locking := Stack{[]Operand{OP_DUP{}}}.Ser().Bytes()
+
+	_, err := NewEngine(&fakedScriptContext{}, []byte{0xff}, locking)
+	expectScriptError(t, "malformed ScriptSig", err, ErrMalformedScript, -1)
+
+	_, err = NewEngine(&fakedScriptContext{}, nil, []byte{SIG_BYTE})
+	expectScriptError(t, "malformed ScriptPubKey", err, ErrMalformedScript, -1)
+
+	_, err = NewEngine(&fakedScriptContext{}, locking, nil)
+	expectScriptError(t, "empty ScriptPubKey", err, ErrEmptyScript, -1)
+}
+
+func TestAsBool(t *testing.T) {
+	tests := []struct {
+		op       Operand
+		expected bool
+	}{
+		{NewNumber(0), false},
+		{NewNumber(1), true},
+		{NewNumber(-1), true},
+		{NUMBER{Num: []byte{0x00, 0x00}}, false},
+		{NUMBER{Num: []byte{0x00, 0x80}}, false},
+		{NUMBER{Num: []byte{0x80, 0x00}}, true},
+		{SIG{Sig: []byte{0x00, 0x01}}, true},
+	}
+	for _, test := range tests {
+		if asBool(test.op) != test.expected {
+			t.Errorf("Expected %v for %x", test.expected, test.op.Data())
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+  OP_IF and OP_NOTIF pop a condition and start a branch, OP_ELSE
+  switches to the other branch and OP_ENDIF ends it. Branches nest, so
+  the Engine keeps a condition for every OP_IF or OP_NOTIF it is inside
+  and only runs an operand when they are all true:
+
+   Unlocking: SIG NUMBER[1]             or  SIG NUMBER[0]
+   Locking:   OP_IF
+                PUB_KEY_V1 OP_CHECKSIG
+              OP_ELSE
+                NUMBER OP_CHECKLOCKTIMEVERIFY OP_DROP
+                PUB_KEY_V1 OP_CHECKSIG
+              OP_ENDIF
+
+  The branch operands always run, even inside a branch which is not
+  taken, so they can keep track of the nesting. Every OP_IF or OP_NOTIF
+  needs an OP_ENDIF in the same script.
+*/
+
+// condStack The conditions of the branches the Engine is inside,
+// innermost last
+type condStack []bool
+
+// executing True if every branch the Engine is inside is taken
+func (c condStack) executing() bool {
+	for _, cond := range c {
+		if !cond {
+			return false
+		}
+	}
+	return true
+}
+
+// conditional A branch operand, run by the Engine in place of Work
+type conditional interface {
+	Operand
+	branch(s *Stack, c *condStack) error
+}
+
+// branchOnly The error from Work of a branch operand, which only
+// the Engine can run
+func branchOnly(op Operand) error {
+	return &ConditionalError{fmt.Sprintf("%s can only be run by the Engine", op.Name())}
+}
+
+// startBranch Start a branch taken when the top stack item is want.
+// Inside a branch which is not taken nothing is popped
+func startBranch(s *Stack, c *condStack, want bool) error {
+	cond := false
+	if c.executing() {
+		top, err := s.Pop()
+		if err != nil {
+			return err
+		}
+		cond = asBool(top) == want
+	}
+	*c = append(*c, cond)
+	return nil
+}
+
+// OP_IF Runs the operands up to the matching OP_ELSE or OP_ENDIF if
+// the top stack value is true. The top stack value is removed
+type OP_IF struct{}
+
+func (op OP_IF) Work(s *Stack, w ScriptContext) (bool, error) {
+	return false, branchOnly(op)
+}
+func (OP_IF) branch(s *Stack, c *condStack) error {
+	return startBranch(s, c, true)
+}
+func (OP_IF) AsByte() byte { return OP_IF_BYTE }
+func (OP_IF) LenData() int { return 0 }
+func (OP_IF) Data() []byte { return []byte{0x00} }
+func (OP_IF) Name() string { return "OP_IF" }
+func (OP_IF) Copy() Operand {
+	return OP_IF{}
+}
+
+// OP_NOTIF OP_IF taken when the top stack value is false
+type OP_NOTIF struct{}
+
+func (op OP_NOTIF) Work(s *Stack, w ScriptContext) (bool, error) {
+	return false, branchOnly(op)
+}
+func (OP_NOTIF) branch(s *Stack, c *condStack) error {
+	return startBranch(s, c, false)
+}
+func (OP_NOTIF) AsByte() byte { return OP_NOTIF_BYTE }
+func (OP_NOTIF) LenData() int { return 0 }
+func (OP_NOTIF) Data() []byte { return []byte{0x00} }
+func (OP_NOTIF) Name() string { return "OP_NOTIF" }
+func (OP_NOTIF) Copy() Operand {
+	return OP_NOTIF{}
+}
+
+// OP_ELSE Runs the operands up to OP_ENDIF if the branch before it
+// was not taken
+type OP_ELSE struct{}
+
+func (op OP_ELSE) Work(s *Stack, w ScriptContext) (bool, error) {
+	return false, branchOnly(op)
+}
+func (op OP_ELSE) branch(s *Stack, c *condStack) error {
+	if len(*c) == 0 {
+		return &ConditionalError{fmt.Sprintf("%s without OP_IF or OP_NOTIF", op.Name())}
+	}
+	(*c)[len(*c)-1] = !(*c)[len(*c)-1]
+	return nil
+}
+func (OP_ELSE) AsByte() byte { return OP_ELSE_BYTE }
+func (OP_ELSE) LenData() int { return 0 }
+func (OP_ELSE) Data() []byte { return []byte{0x00} }
+func (OP_ELSE) Name() string { return "OP_ELSE" }
+func (OP_ELSE) Copy() Operand {
+	return OP_ELSE{}
+}
+
+// OP_ENDIF Ends the branch of the last OP_IF or OP_NOTIF
+type OP_ENDIF struct{}
+
+func (op OP_ENDIF) Work(s *Stack, w ScriptContext) (bool, error) {
+	return false, branchOnly(op)
+}
+func (op OP_ENDIF) branch(s *Stack, c *condStack) error {
+	if len(*c) == 0 {
+		return &ConditionalError{fmt.Sprintf("%s without OP_IF or OP_NOTIF", op.Name())}
+	}
+	*c = (*c)[:len(*c)-1]
+	return nil
+}
+func (OP_ENDIF) AsByte() byte { return OP_ENDIF_BYTE }
+func (OP_ENDIF) LenData() int { return 0 }
+func (OP_ENDIF) Data() []byte { return []byte{0x00} }
+func (OP_ENDIF) Name() string { return "OP_ENDIF" }
+func (OP_ENDIF) Copy() Operand {
+	return OP_ENDIF{}
+}
+
+// OP_VERIFY Marks transaction as invalid if top stack value is not
+// true. The top stack value is removed
+type OP_VERIFY struct{}
+
+func (OP_VERIFY) Work(s *Stack, w ScriptContext) (bool, error) {
+	top, err := s.Pop()
+	if err != nil {
+		return false, err
+	}
+	if !asBool(top) {
+		return false, &VerifyError{fmt.Sprintf("Top stack item %s is false", top.Name())}
+	}
+	return true, nil
+}
+func (OP_VERIFY) AsByte() byte { return OP_VERIFY_BYTE }
+func (OP_VERIFY) LenData() int { return 0 }
+func (OP_VERIFY) Data() []byte { return []byte{0x00} }
+func (OP_VERIFY) Name() string { return "OP_VERIFY" }
+func (OP_VERIFY) Copy() Operand {
+	return OP_VERIFY{}
+}
+
+// OP_RETURN Marks transaction as invalid. An output whose locking
+// script starts with OP_RETURN can never be spent, so it can carry
+// data which is not a script
+type OP_RETURN struct{}
+
+func (op OP_RETURN) Work(s *Stack, w ScriptContext) (bool, error) {
+	return false, &EarlyReturnError{fmt.Sprintf("%s reached", op.Name())}
+}
+func (OP_RETURN) AsByte() byte { return OP_RETURN_BYTE }
+func (OP_RETURN) LenData() int { return 0 }
+func (OP_RETURN) Data() []byte { return []byte{0x00} }
+func (OP_RETURN) Name() string { return "OP_RETURN" }
+func (OP_RETURN) Copy() Operand {
+	return OP_RETURN{}
+}
+
+// OP_EQUAL Returns 1 if the inputs are exactly equal, 0 otherwise.
+// The inputs are replaced by the result
+type OP_EQUAL struct{}
+
+func (OP_EQUAL) Work(s *Stack, w ScriptContext) (bool, error) {
+	first, err := s.Top()
+	if err != nil {
+		return false, err
+	}
+	second, err := s.Second()
+	if err != nil {
+		return false, err
+	}
+	equal := bytes.Equal(first.Data(), second.Data())
+	if err := s.PopTwo(); err != nil {
+		return false, err
+	}
+	if equal {
+		s.Push(NewNumber(1))
+	} else {
+		s.Push(NewNumber(0))
+	}
+	return true, nil
+}
+func (OP_EQUAL) AsByte() byte { return OP_EQUAL_BYTE }
+func (OP_EQUAL) LenData() int { return 0 }
+func (OP_EQUAL) Data() []byte { return []byte{0x00} }
+func (OP_EQUAL) Name() string { return "OP_EQUAL" }
+func (OP_EQUAL) Copy() Operand {
+	return OP_EQUAL{}
+}
+
+// IsUnspendable True if the locking script b starts with OP_RETURN,
+// so no input can spend it. Anything may follow the OP_RETURN
+func IsUnspendable(b []byte) bool {
+	return len(b) > 0 && b[0] == OP_RETURN_BYTE
+}
@@ -0,0 +1,116 @@
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+// runFinalStack Run unlocking then locking and return the stack left
+func runFinalStack(t *testing.T, unlocking []Operand, locking []Operand) ([]Operand, error) {
+	t.Helper()
+	engine, err := NewEngine(&fakedScriptContext{}, Stack{unlocking}.Ser().Bytes(), Stack{locking}.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	err = engine.Execute()
+	return engine.Stack().Contents, err
+}
+
+func TestConditionals(t *testing.T) {
+	one, two, three := NewNumber(1), NewNumber(2), NewNumber(3)
+	tests := []struct {
+		name      string
+		unlocking []Operand
+		locking   []Operand
+		top       NUMBER
+	}{
+		{"if taken", []Operand{one}, []Operand{OP_IF{}, two, OP_ELSE{}, three, OP_ENDIF{}}, two},
+		{"else taken", []Operand{NewNumber(0)}, []Operand{OP_IF{}, two, OP_ELSE{}, three, OP_ENDIF{}}, three},
+		{"notif taken", []Operand{NewNumber(0)}, []Operand{OP_NOTIF{}, two, OP_ELSE{}, three, OP_ENDIF{}}, two},
+		{"notif not taken", []Operand{one}, []Operand{OP_NOTIF{}, two, OP_ENDIF{}, three}, three},
+		{"nested", []Operand{one, one}, []Operand{
+			OP_IF{}, OP_IF{}, two, OP_ELSE{}, three, OP_ENDIF{}, OP_ELSE{}, three, OP_ENDIF{},
+		}, two},
+		{"nested not taken", []Operand{one}, []Operand{
+			OP_NOTIF{}, OP_IF{}, three, OP_ELSE{}, three, OP_ENDIF{}, OP_ELSE{}, two, OP_ENDIF{},
+		}, two},
+		{"return not taken", []Operand{NewNumber(0)}, []Operand{OP_IF{}, OP_RETURN{}, OP_ENDIF{}, two}, two},
+		{"else twice", []Operand{NewNumber(0)}, []Operand{OP_IF{}, two, OP_ELSE{}, three, OP_ELSE{}, one, OP_ENDIF{}}, three},
+	}
+	for _, test := range tests {
+		stack, err := runFinalStack(t, test.unlocking, test.locking)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+		if len(stack) != 1 || !bytes.Equal(stack[0].Data(), test.top.Data()) {
+			t.Errorf("%s: expected only %v on the stack, got %v", test.name, test.top, stack)
+		}
+	}
+}
+
+func TestConditionalErrors(t *testing.T) {
+	one := NewNumber(1)
+	tests := []struct {
+		name      string
+		unlocking []Operand
+		locking   []Operand
+		code      ErrorCode
+		index     int
+	}{
+		{"if without endif", []Operand{one}, []Operand{OP_IF{}, one}, ErrUnbalancedConditional, -1},
+		{"endif without if", []Operand{one}, []Operand{OP_ENDIF{}}, ErrUnbalancedConditional, 1},
+		{"else without if", []Operand{one}, []Operand{OP_ELSE{}, OP_ENDIF{}}, ErrUnbalancedConditional, 1},
+		{"if across scripts", []Operand{one, OP_IF{}}, []Operand{OP_ENDIF{}, one}, ErrUnbalancedConditional, -1},
+		{"if underflow", []Operand{}, []Operand{OP_IF{}, OP_ENDIF{}}, ErrStackUnderflow, 0},
+		{"return", []Operand{one}, []Operand{OP_RETURN{}}, ErrEarlyReturn, 1},
+		{"return taken", []Operand{one}, []Operand{OP_IF{}, OP_RETURN{}, OP_ENDIF{}}, ErrEarlyReturn, 2},
+		{"verify false", []Operand{one, NewNumber(0)}, []Operand{OP_VERIFY{}}, ErrVerify, 2},
+		{"verify underflow", []Operand{}, []Operand{OP_VERIFY{}}, ErrStackUnderflow, 0},
+		{"equal underflow", []Operand{one}, []Operand{OP_EQUAL{}}, ErrStackUnderflow, 1},
+	}
+	for _, test := range tests {
+		err := runEngine(t, test.unlocking, test.locking)
+		expectScriptError(t, test.name, err, test.code, test.index)
+	}
+}
+
+func TestVerifyAndEqual(t *testing.T) {
+	key := PUB_KEY_V1{Key: []byte{1, 2, 3}}
+	other := PUB_KEY_V1{Key: []byte{4}}
+
+	stack, err := runFinalStack(t, []Operand{key, key}, []Operand{OP_EQUAL{}})
+	if err != nil || len(stack) != 1 || !asBool(stack[0]) {
+		t.Errorf("Expected equal items to leave true, got %v %v", stack, err)
+	}
+	stack, _ = runFinalStack(t, []Operand{key, other}, []Operand{OP_EQUAL{}})
+	if len(stack) != 1 || asBool(stack[0]) {
+		t.Errorf("Expected different items to leave false, got %v", stack)
+	}
+
+	// OP_VERIFY removes a true item
+	stack, err = runFinalStack(t, []Operand{NewNumber(1), NewNumber(1)}, []Operand{OP_VERIFY{}})
+	if err != nil || len(stack) != 1 {
+		t.Errorf("Expected OP_VERIFY to leave one item, got %v %v", stack, err)
+	}
+}
+
+func TestIsUnspendable(t *testing.T) {
+	unspendable := Stack{[]Operand{OP_RETURN{}, NUMBER{Num: []byte("data")}}}
+	if !IsUnspendable(unspendable.Ser().Bytes()) {
+		t.Errorf("Expected a script starting with OP_RETURN to be unspendable")
+	}
+	spendable := Stack{[]Operand{NewNumber(1), OP_RETURN{}}}
+	if IsUnspendable(spendable.Ser().Bytes()) || IsUnspendable(nil) {
+		t.Errorf("Expected only scripts starting with OP_RETURN to be unspendable")
+	}
+}
+
+func TestBranchOperandWork(t *testing.T) {
+	for _, op := range []Operand{OP_IF{}, OP_NOTIF{}, OP_ELSE{}, OP_ENDIF{}} {
+		s := Stack{[]Operand{NewNumber(1)}}
+		if _, err := op.Work(&s, &fakedScriptContext{}); err == nil {
+			t.Errorf("Expected %s to only run in the Engine", op.Name())
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+  An m-of-n script needs m signatures from n public keys:
+
+   Unlocking: SIG_1 ... SIG_m
+   Locking:   OP_m PUB_KEY_V1_1 ... PUB_KEY_V1_n OP_n OP_CHECKMULTISIG
+
+  The signatures must be in the same order as their keys. Each one is
+  checked against the keys in turn until one matches, so a key can't
+  sign twice.
+*/
+
+// MaxMultiSigKeys The most public keys an m-of-n script can have
+const MaxMultiSigKeys = 15
+
+// checkMultiSig Pop the key count, the public keys, the signature count
+// and the signatures of an OP_CHECKMULTISIG and check every signature
+// is by one of the keys
+func checkMultiSig(s *Stack, w ScriptContext) error {
+	n, err := popInt(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > MaxMultiSigKeys {
+		return &MultiSigError{fmt.Sprintf("%d public keys, the maximum is %d", n, MaxMultiSigKeys)}
+	}
+	pubKeys := make([]Operand, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = s.Pop(); err != nil {
+			return err
+		}
+	}
+
+	m, err := popInt(s)
+	if err != nil {
+		return err
+	}
+	if m < 0 || m > n {
+		return &MultiSigError{fmt.Sprintf("%d signatures needed from %d public keys", m, n)}
+	}
+	sigs := make([]Operand, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = s.Pop(); err != nil {
+			return err
+		}
+	}
+
+	keyIndex := 0
+	for i, sig := range sigs {
+		for {
+			// Every signature left needs a key of its own
+			if len(sigs)-i > len(pubKeys)-keyIndex {
+				return &SigValidationError{fmt.Sprintf("Only %d of %d signatures are valid", i, len(sigs))}
+			}
+			verify, err := checkSig(sig, pubKeys[keyIndex], w)
+			// A key which doesn't parse just doesn't match
+			if _, ok := err.(*PubKeyParseError); ok {
+				verify, err = false, nil
+			}
+			if err != nil {
+				return err
+			}
+			keyIndex++
+			if verify {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// OP_CHECKMULTISIG Checks m signatures against n public keys, as
+// described above. If they are all valid the counts, keys and
+// signatures are replaced by true, otherwise the script fails
+type OP_CHECKMULTISIG struct{}
+
+func (OP_CHECKMULTISIG) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := checkMultiSig(s, w); err != nil {
+		return false, err
+	}
+	s.Push(NewNumber(1))
+	return true, nil
+}
+func (OP_CHECKMULTISIG) AsByte() byte { return OP_CHECKMULTISIG_BYTE }
+func (OP_CHECKMULTISIG) LenData() int { return 0 }
+func (OP_CHECKMULTISIG) Data() []byte { return []byte{0x00} }
+func (OP_CHECKMULTISIG) Name() string { return "OP_CHECKMULTISIG" }
+func (OP_CHECKMULTISIG) Copy() Operand {
+	return OP_CHECKMULTISIG{}
+}
+
+// OP_CHECKMULTISIGVERIFY OP_CHECKMULTISIG without pushing the result
+type OP_CHECKMULTISIGVERIFY struct{}
+
+func (OP_CHECKMULTISIGVERIFY) Work(s *Stack, w ScriptContext) (bool, error) {
+	if err := checkMultiSig(s, w); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_CHECKMULTISIGVERIFY) AsByte() byte { return OP_CHECKMULTISIGVERIFY_BYTE }
+func (OP_CHECKMULTISIGVERIFY) LenData() int { return 0 }
+func (OP_CHECKMULTISIGVERIFY) Data() []byte { return []byte{0x00} }
+func (OP_CHECKMULTISIGVERIFY) Name() string { return "OP_CHECKMULTISIGVERIFY" }
+func (OP_CHECKMULTISIGVERIFY) Copy() Operand {
+	return OP_CHECKMULTISIGVERIFY{}
+}
+
+// MultiSigScript The locking script needing m signatures from
+// pubKeys, which are compressed public keys
+func MultiSigScript(m int, pubKeys [][]byte) (Stack, error) {
+	n := len(pubKeys)
+	if n < 1 || n > MaxMultiSigKeys {
+		return Stack{}, &MultiSigError{fmt.Sprintf("%d public keys, expected 1 to %d", n, MaxMultiSigKeys)}
+	}
+	if m < 1 || m > n {
+		return Stack{}, &MultiSigError{fmt.Sprintf("%d signatures needed from %d public keys", m, n)}
+	}
+
+	opM, _ := NewSmallInt(m)
+	opN, _ := NewSmallInt(n)
+	ret := Stack{[]Operand{opM}}
+	for _, pubKey := range pubKeys {
+		ret.Push(PUB_KEY_V1{Key: append([]byte{}, pubKey...)})
+	}
+	ret.Push(opN)
+	ret.Push(OP_CHECKMULTISIG{})
+	return ret, nil
+}
+
+// MultiSigUnlockingScript The unlocking script for an m-of-n script.
+// sigs must be in the same order as their public keys
+func MultiSigUnlockingScript(sigs [][]byte) Stack {
+	ret := Stack{[]Operand{}}
+	for _, sig := range sigs {
+		ret.Push(SIG{Sig: append([]byte{}, sig...)})
+	}
+	return ret
+}
+
+// ParseMultiSigScript The number of signatures needed and the public
+// keys of the m-of-n locking script in b
+func ParseMultiSigScript(b []byte) (int, [][]byte, error) {
+	stack, err := Marshall(bytes.NewBuffer(b))
+	if err != nil {
+		return 0, nil, err
+	}
+	ops := stack.Contents
+	if len(ops) < 4 {
+		return 0, nil, &MultiSigError{"Script is too short to be m-of-n"}
+	}
+	if _, ok := ops[len(ops)-1].(OP_CHECKMULTISIG); !ok {
+		return 0, nil, &MultiSigError{"Script does not end with OP_CHECKMULTISIG"}
+	}
+	opM, okM := ops[0].(OP_N)
+	opN, okN := ops[len(ops)-2].(OP_N)
+	if !okM || !okN {
+		return 0, nil, &MultiSigError{"Script does not give the counts with OP_N"}
+	}
+
+	pubKeys := [][]byte{}
+	for _, op := range ops[1 : len(ops)-2] {
+		pubKey, ok := op.(PUB_KEY_V1)
+		if !ok {
+			return 0, nil, &MultiSigError{fmt.Sprintf("Expected %s, got %s", PUB_KEY_V1{}.Name(), op.Name())}
+		}
+		pubKeys = append(pubKeys, pubKey.Key)
+	}
+
+	m, n := int(opM.N), int(opN.N)
+	if n != len(pubKeys) || n > MaxMultiSigKeys || m > n {
+		return 0, nil, &MultiSigError{fmt.Sprintf("%d of %d script has %d public keys", m, n, len(pubKeys))}
+	}
+	return m, pubKeys, nil
+}
@@ -0,0 +1,168 @@
+package script_test
+
+import (
+	"spchain/chain"
+	"spchain/key"
+	"spchain/script"
+	"strings"
+	"testing"
+)
+
+// multiSigTest A transaction spending an output locked by a 2-of-3 script
+type multiSigTest struct {
+	keys    []key.Key
+	tx      chain.Tx
+	prevOut chain.OutputTx
+}
+
+func newMultiSigTest(t *testing.T) *multiSigTest {
+	m := &multiSigTest{
+		keys: []key.Key{key.NewKey(), key.NewKey(), key.NewKey()},
+		tx: chain.Tx{
+			Version: 1,
+			TxInNo:  1,
+			TxOutNo: 1,
+			Vin:     []chain.InputTx{createTxInput()},
+			Vout:    []chain.OutputTx{createTxOutput()},
+		},
+	}
+	pubKeys := [][]byte{}
+	for _, k := range m.keys {
+		pubKeys = append(pubKeys, k.PublicKey.SerializeCompressed())
+	}
+	locking, err := script.MultiSigScript(2, pubKeys)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	m.prevOut = chain.OutputTx{Value: 20000, ScriptPubKey: locking.Ser().Bytes()}
+	return m
+}
+
+// run Spend the output with signatures by the keys at indexes
+func (m *multiSigTest) run(t *testing.T, indexes ...int) error {
+	sigs := [][]byte{}
+	for _, i := range indexes {
+		sig, err := m.tx.SignInput(0, m.keys[i].PrivateKey, &m.prevOut)
+		if err != nil {
+			t.Fatalf("Unable to sign %s", err)
+		}
+		sigs = append(sigs, sig)
+	}
+	unlocking := script.MultiSigUnlockingScript(sigs)
+
+	ctxt := chain.SigContext{Tx: &m.tx, InputIndex: 0, PrevOut: &m.prevOut}
+	engine, err := script.NewEngine(&ctxt, unlocking.Ser().Bytes(), m.prevOut.ScriptPubKey)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return engine.Execute()
+}
+
+func TestCheckMultiSig(t *testing.T) {
+	m := newMultiSigTest(t)
+	for _, indexes := range [][]int{{0, 1}, {0, 2}, {1, 2}} {
+		if err := m.run(t, indexes...); err != nil {
+			t.Errorf("Signed by %v: unexpected error %s", indexes, err)
+		}
+	}
+
+	expectErrorCode(t, "out of order", m.run(t, 2, 0), script.ErrSigValidation)
+	expectErrorCode(t, "same key twice", m.run(t, 1, 1), script.ErrSigValidation)
+	expectErrorCode(t, "one signature", m.run(t, 1), script.ErrStackUnderflow)
+}
+
+func TestCheckMultiSigVerify(t *testing.T) {
+	m := newMultiSigTest(t)
+	_, pubKeys, err := script.ParseMultiSigScript(m.prevOut.ScriptPubKey)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	locking := script.Stack{[]script.Operand{
+		script.OP_N{N: 1},
+		script.PUB_KEY_V1{Key: pubKeys[0]},
+		script.OP_N{N: 1},
+		script.OP_CHECKMULTISIGVERIFY{},
+		script.OP_N{N: 1},
+	}}
+	m.prevOut.ScriptPubKey = locking.Ser().Bytes()
+
+	if err := m.run(t, 0); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	expectErrorCode(t, "wrong key", m.run(t, 1), script.ErrSigValidation)
+}
+
+func TestCheckMultiSigBadPubKey(t *testing.T) {
+	m := newMultiSigTest(t)
+	badKey := make([]byte, 33)
+	badKey[0] = 0x05
+	locking := script.Stack{[]script.Operand{
+		script.OP_N{N: 1},
+		script.PUB_KEY_V1{Key: badKey},
+		script.PUB_KEY_V1{Key: m.keys[0].PublicKey.SerializeCompressed()},
+		script.OP_N{N: 2},
+		script.OP_CHECKMULTISIG{},
+	}}
+	m.prevOut.ScriptPubKey = locking.Ser().Bytes()
+
+	// The key which doesn't parse is skipped like any other non-match
+	if err := m.run(t, 0); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	expectErrorCode(t, "no valid key", m.run(t, 1), script.ErrSigValidation)
+}
+
+func TestMultiSigScript(t *testing.T) {
+	pubKeys := [][]byte{}
+	for i := 0; i < script.MaxMultiSigKeys+1; i++ {
+		pubKeys = append(pubKeys, key.NewKey().PublicKey.SerializeCompressed())
+	}
+
+	locking, err := script.MultiSigScript(2, pubKeys[:3])
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	asm, _ := script.Disassemble(locking.Ser().Bytes())
+	if !strings.HasPrefix(asm, "OP_2 PUB_KEY_V1[") || !strings.HasSuffix(asm, "] OP_3 OP_CHECKMULTISIG") {
+		t.Errorf("Unexpected script %s", asm)
+	}
+
+	m, parsed, err := script.ParseMultiSigScript(locking.Ser().Bytes())
+	if err != nil || m != 2 || len(parsed) != 3 || string(parsed[2]) != string(pubKeys[2]) {
+		t.Errorf("Expected 2 of the 3 keys, got %d %d %v", m, len(parsed), err)
+	}
+
+	if _, err := script.MultiSigScript(15, pubKeys[:15]); err != nil {
+		t.Errorf("Unexpected error for 15 of 15 %s", err)
+	}
+	bad := []struct {
+		m       int
+		pubKeys [][]byte
+	}{
+		{0, pubKeys[:3]},
+		{4, pubKeys[:3]},
+		{1, nil},
+		{1, pubKeys},
+	}
+	for _, test := range bad {
+		if _, err := script.MultiSigScript(test.m, test.pubKeys); err == nil {
+			t.Errorf("Expected an error for %d of %d", test.m, len(test.pubKeys))
+		}
+	}
+}
+
+func TestParseMultiSigScriptRejects(t *testing.T) {
+	pubKey := script.PUB_KEY_V1{Key: key.NewKey().PublicKey.SerializeCompressed()}
+	scripts := []script.Stack{
+		{[]script.Operand{script.OP_DUP{}, script.OP_HASH_160{}, pubKey, script.OP_EQUALVERIFY{}, script.OP_CHECKSIG{}}},
+		{[]script.Operand{script.OP_N{N: 1}, pubKey, script.OP_N{N: 2}, script.OP_CHECKMULTISIG{}}},
+		{[]script.Operand{script.OP_N{N: 2}, pubKey, script.OP_N{N: 1}, script.OP_CHECKMULTISIG{}}},
+		{[]script.Operand{script.OP_N{N: 1}, script.SIG{Sig: []byte{1}}, script.OP_N{N: 1}, script.OP_CHECKMULTISIG{}}},
+		{[]script.Operand{script.NewNumber(1), pubKey, script.OP_N{N: 1}, script.OP_CHECKMULTISIG{}}},
+	}
+	for _, s := range scripts {
+		if _, _, err := script.ParseMultiSigScript(s.Ser().Bytes()); err == nil {
+			t.Errorf("Expected an error for %v", s.ListTypes())
+		}
+	}
+}
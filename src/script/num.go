@@ -0,0 +1,142 @@
+package script
+
+import (
+	"fmt"
+)
+
+/*
+Numbers are pushed with NUMBER. The data is little endian with the sign
+in the top bit of the last byte, as in Bitcoin script. Zero is no bytes
+and the encoding must be minimal, so there is only one way to push each
+number.
+*/
+
+// maxLockTimeNumLen Lock times can use 5 bytes to reach the full
+// unsigned 32 bit range
+const maxLockTimeNumLen = 5
+
+// encodeNum The minimal encoding of n
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+
+	ret := []byte{}
+	for abs > 0 {
+		ret = append(ret, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	// The top bit of the last byte is the sign. Add a byte for it
+	// when the magnitude already uses that bit
+	if ret[len(ret)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		ret = append(ret, extra)
+	} else if negative {
+		ret[len(ret)-1] |= 0x80
+	}
+	return ret
+}
+
+// decodeNum Decode a minimally encoded number of at most maxLen bytes
+func decodeNum(data []byte, maxLen int) (int64, error) {
+	if len(data) > maxLen {
+		return 0, &NumberError{fmt.Sprintf("Number is %d bytes, the maximum is %d", len(data), maxLen)}
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	// The last byte may only be a bare sign byte if the byte before
+	// it needs its top bit for the magnitude
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, &NumberError{fmt.Sprintf("Number 0x%x is not minimally encoded", data)}
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << uint(8*i)
+	}
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << uint(8*(len(data)-1))
+		return -n, nil
+	}
+	return n, nil
+}
+
+// NUMBER A number pushed on the stack
+type NUMBER struct{ Num []byte }
+
+// NewNumber The NUMBER which pushes n
+func NewNumber(n int64) NUMBER {
+	return NUMBER{Num: encodeNum(n)}
+}
+
+func (p NUMBER) Work(s *Stack, w ScriptContext) (bool, error) {
+	s.Push(p.Copy())
+	return true, nil
+}
+func (NUMBER) AsByte() byte    { return NUMBER_BYTE }
+func (op NUMBER) LenData() int { return len(op.Num) }
+func (op NUMBER) Data() []byte { return append([]byte{}, op.Num...) }
+func (NUMBER) Name() string    { return "NUMBER" }
+func (op NUMBER) Copy() Operand {
+	return NUMBER{Num: append([]byte{}, op.Num...)}
+}
+
+// Int64 The value of the number if it is minimally encoded in at
+// most maxLen bytes
+func (op NUMBER) Int64(maxLen int) (int64, error) {
+	return decodeNum(op.Num, maxLen)
+}
+
+// maxScriptNumLen Numbers used by operands, such as the counts of
+// OP_CHECKMULTISIG, are at most 4 bytes
+const maxScriptNumLen = 4
+
+// OP_N Pushes the NUMBER N, from 1 to 16, with a single op code
+type OP_N struct{ N byte }
+
+// NewSmallInt The OP_N pushing n. n must be from 1 to 16
+func NewSmallInt(n int) (OP_N, error) {
+	if n < 1 || n > 16 {
+		return OP_N{}, &NumberError{fmt.Sprintf("%d can't be pushed with OP_N, it must be from 1 to 16", n)}
+	}
+	return OP_N{N: byte(n)}, nil
+}
+
+func (op OP_N) Work(s *Stack, w ScriptContext) (bool, error) {
+	s.Push(NewNumber(int64(op.N)))
+	return true, nil
+}
+func (op OP_N) AsByte() byte  { return OP_1_BYTE + op.N - 1 }
+func (OP_N) LenData() int     { return 0 }
+func (OP_N) Data() []byte     { return []byte{0x00} }
+func (op OP_N) Name() string  { return fmt.Sprintf("OP_%d", op.N) }
+func (op OP_N) Copy() Operand { return OP_N{N: op.N} }
+
+// popInt Pop the NUMBER on top of the stack as an integer of at most
+// maxScriptNumLen bytes
+func popInt(s *Stack) (int64, error) {
+	top, err := s.Pop()
+	if err != nil {
+		return 0, err
+	}
+	num, ok := top.(NUMBER)
+	if !ok {
+		return 0, &InvalidType{
+			fmt.Sprintf("Invalid type. Expected %s, got %s", NUMBER{}.Name(), top.Name()),
+		}
+	}
+	return num.Int64(maxScriptNumLen)
+}
@@ -0,0 +1,78 @@
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNumberEncoding(t *testing.T) {
+	tests := []struct {
+		n   int64
+		enc []byte
+	}{
+		{0, []byte{}},
+		{1, []byte{0x01}},
+		{-1, []byte{0x81}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{-128, []byte{0x80, 0x80}},
+		{255, []byte{0xff, 0x00}},
+		{256, []byte{0x00, 0x01}},
+		{500000000, []byte{0x00, 0x65, 0xcd, 0x1d}},
+		{0xffffffff, []byte{0xff, 0xff, 0xff, 0xff, 0x00}},
+	}
+	for _, test := range tests {
+		num := NewNumber(test.n)
+		if !bytes.Equal(num.Num, test.enc) {
+			t.Errorf("%d: expected encoding %x, got %x", test.n, test.enc, num.Num)
+		}
+		n, err := num.Int64(maxLockTimeNumLen)
+		if err != nil || n != test.n {
+			t.Errorf("%d: decoded %d, %v", test.n, n, err)
+		}
+	}
+}
+
+func TestNumberDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"zero byte", []byte{0x00}},
+		{"negative zero", []byte{0x80}},
+		{"padded", []byte{0x01, 0x00}},
+		{"padded negative", []byte{0x01, 0x80}},
+		{"too long", []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}},
+	}
+	for _, test := range tests {
+		_, err := NUMBER{test.data}.Int64(maxLockTimeNumLen)
+		if _, ok := err.(*NumberError); !ok {
+			t.Errorf("%s: expected NumberError, got %v", test.name, err)
+		}
+	}
+}
+
+func TestSmallInt(t *testing.T) {
+	for _, n := range []int{0, 17, -1} {
+		if _, err := NewSmallInt(n); err == nil {
+			t.Errorf("Expected an error for %d", n)
+		}
+	}
+
+	one, _ := NewSmallInt(1)
+	sixteen, _ := NewSmallInt(16)
+	ops := Stack{[]Operand{one, sixteen}}
+	ser := ops.Ser().Bytes()
+	if ser[0] != OP_1_BYTE || ser[2] != OP_16_BYTE {
+		t.Errorf("Unexpected op codes %x", ser)
+	}
+	if asm, err := Disassemble(ser); err != nil || asm != "OP_1 OP_16" {
+		t.Errorf("Expected OP_1 OP_16, got %q %v", asm, err)
+	}
+
+	stack := Stack{}
+	sixteen.Work(&stack, &fakedScriptContext{})
+	if n, err := popInt(&stack); err != nil || n != 16 {
+		t.Errorf("Expected 16 on the stack, got %d %v", n, err)
+	}
+}
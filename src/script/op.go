@@ -25,6 +25,47 @@ var (
 	PUB_KEY_V1_BYTE     = byte(0x02)
 	PUB_KEY_HASH_BYTE   = byte(0x03)
 	OP_HASH_160_BYTE    = byte(0xa9)
+	NUMBER_BYTE         = byte(0x04)
+	OP_DROP_BYTE        = byte(0x75)
+
+	OP_CHECKLOCKTIMEVERIFY_BYTE = byte(0xb1)
+	OP_CHECKSEQUENCEVERIFY_BYTE = byte(0xb2)
+
+	OP_CHECKMULTISIG_BYTE       = byte(0xae)
+	OP_CHECKMULTISIGVERIFY_BYTE = byte(0xaf)
+
+	SCRIPT_BYTE      = byte(0x05)
+	SCRIPT_HASH_BYTE = byte(0x06)
+
+	OP_IF_BYTE     = byte(0x63)
+	OP_NOTIF_BYTE  = byte(0x64)
+	OP_ELSE_BYTE   = byte(0x67)
+	OP_ENDIF_BYTE  = byte(0x68)
+	OP_VERIFY_BYTE = byte(0x69)
+	OP_RETURN_BYTE = byte(0x6a)
+	OP_EQUAL_BYTE  = byte(0x87)
+
+	OP_1ADD_BYTE           = byte(0x8b)
+	OP_1SUB_BYTE           = byte(0x8c)
+	OP_NEGATE_BYTE         = byte(0x8f)
+	OP_ABS_BYTE            = byte(0x90)
+	OP_NOT_BYTE            = byte(0x91)
+	OP_0NOTEQUAL_BYTE      = byte(0x92)
+	OP_ADD_BYTE            = byte(0x93)
+	OP_SUB_BYTE            = byte(0x94)
+	OP_BOOLAND_BYTE        = byte(0x9a)
+	OP_BOOLOR_BYTE         = byte(0x9b)
+	OP_NUMEQUAL_BYTE       = byte(0x9c)
+	OP_NUMEQUALVERIFY_BYTE = byte(0x9d)
+	OP_LESSTHAN_BYTE       = byte(0x9f)
+	OP_GREATERTHAN_BYTE    = byte(0xa0)
+	OP_MIN_BYTE            = byte(0xa3)
+	OP_MAX_BYTE            = byte(0xa4)
+	OP_WITHIN_BYTE         = byte(0xa5)
+
+	// OP_1_BYTE to OP_16_BYTE The op codes of OP_N pushing 1 to 16
+	OP_1_BYTE  = byte(0x51)
+	OP_16_BYTE = byte(0x60)
 )
 
 // sha256 of the byte buffer followed by ripemd160
@@ -38,14 +79,22 @@ func ripe160sha256(b []byte) []byte {
 // ScriptContext Context which the operands can use when doing
 // their operations
 type ScriptContext interface {
-	SerialiseForSign() *bytes.Buffer
+	// SigHash The message signed by a signature with hashType, the
+	// last byte of the signature
+	SigHash(hashType byte) ([]byte, error)
+	// CheckLockTime Error unless the transaction LockTime has
+	// reached lockTime
+	CheckLockTime(lockTime int64) error
+	// CheckSequence Error unless the relative lock time of the input
+	// has reached sequence
+	CheckSequence(sequence int64) error
 }
 
 // ByteRepresentation Interface for OP_CODES to be represented
 // as bytes
 type ByteRepresentation interface {
 	AsByte() byte
-	LenData() byte
+	LenData() int
 	Data() []byte
 }
 
@@ -66,13 +115,15 @@ type Operand interface {
 type OP_DUP struct{}
 
 func (OP_DUP) Work(s *Stack, w ScriptContext) (bool, error) {
-	s.DuplicateTop()
+	if err := s.DuplicateTop(); err != nil {
+		return false, err
+	}
 	return true, nil
 }
-func (OP_DUP) AsByte() byte  { return OP_DUP_BYTE }
-func (OP_DUP) LenData() byte { return 0x00 }
-func (OP_DUP) Data() []byte  { return []byte{0x00} }
-func (OP_DUP) Name() string  { return "OP_DUP" }
+func (OP_DUP) AsByte() byte { return OP_DUP_BYTE }
+func (OP_DUP) LenData() int { return 0 }
+func (OP_DUP) Data() []byte { return []byte{0x00} }
+func (OP_DUP) Name() string { return "OP_DUP" }
 func (OP_DUP) Copy() Operand {
 	return OP_DUP{}
 }
@@ -83,22 +134,24 @@ func (OP_DUP) Copy() Operand {
 type OP_EQUALVERIFY struct{}
 
 func (OP_EQUALVERIFY) Work(s *Stack, w ScriptContext) (bool, error) {
-	first := s.Top()
-	second := s.Second()
-	firstT, _ := first.(ByteRepresentation)
-	secondT, _ := second.(ByteRepresentation)
-
-	if bytes.Equal(firstT.Data(), secondT.Data()) {
-		s.PopTwo()
-		return true, nil
-	} else {
-		return false, nil
-	}
-}
-func (OP_EQUALVERIFY) AsByte() byte  { return OP_EQUALVERIFY_BYTE }
-func (OP_EQUALVERIFY) LenData() byte { return 0x00 }
-func (OP_EQUALVERIFY) Data() []byte  { return []byte{0x00} }
-func (OP_EQUALVERIFY) Name() string  { return "OP_EQUALVERIFY" }
+	first, err := s.Top()
+	if err != nil {
+		return false, err
+	}
+	second, err := s.Second()
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(first.Data(), second.Data()) {
+		return false, &VerifyError{"The top two stack items are not equal"}
+	}
+	return true, s.PopTwo()
+}
+func (OP_EQUALVERIFY) AsByte() byte { return OP_EQUALVERIFY_BYTE }
+func (OP_EQUALVERIFY) LenData() int { return 0 }
+func (OP_EQUALVERIFY) Data() []byte { return []byte{0x00} }
+func (OP_EQUALVERIFY) Name() string { return "OP_EQUALVERIFY" }
 func (s OP_EQUALVERIFY) Copy() Operand {
 	return OP_EQUALVERIFY{}
 }
@@ -106,14 +159,41 @@ func (s OP_EQUALVERIFY) Copy() Operand {
 // OP_CHECKSIG The entire transaction's outputs, inputs, and script
 // (from the most recently-executed OP_CODESEPARATOR to the end) are hashed.
 // The signature used by OP_OP_CHECKSIG must be a valid signature for this hash and public key.
-// If it is, 1 is returned, 0 otherwise.
-// We assume all sigs to be chcked as SIGH_HASH_ALL
+// If it is, the public key and signature are replaced by true,
+// otherwise the script fails.
+// The last byte of the signature is the sighash type which decides
+// which parts of the transaction were signed
 type OP_CHECKSIG struct{}
 
 func (OP_CHECKSIG) Work(s *Stack, w ScriptContext) (bool, error) {
-	txHash := w.SerialiseForSign()
+	pubKey, err := s.Top()
+	if err != nil {
+		return false, err
+	}
+	sig, err := s.Second()
+	if err != nil {
+		return false, err
+	}
+
+	verify, err := checkSig(sig, pubKey, w)
+	if err != nil {
+		return false, err
+	}
+	if !verify {
+		return false, &SigValidationError{"Signature validation error"}
+	}
 
-	pubKey := s.Top()
+	if err := s.PopTwo(); err != nil {
+		return false, err
+	}
+	s.Push(NewNumber(1))
+	return true, nil
+}
+
+// checkSig True if sig is a signature by pubKey of the message w gives
+// for the sighash type of sig. Items of the wrong type and keys or
+// signatures which don't parse are errors
+func checkSig(sig Operand, pubKey Operand, w ScriptContext) (bool, error) {
 	if _, ok := pubKey.(PUB_KEY_V1); !ok {
 		return false, &InvalidType{
 			fmt.Sprintf("Invalid type. Expected %s, got %s", PUB_KEY_V1{}.Name(), pubKey.Name()),
@@ -127,32 +207,35 @@ func (OP_CHECKSIG) Work(s *Stack, w ScriptContext) (bool, error) {
 	}
 
 	// Parse the signature
-	sig := s.Second()
 	if _, ok := sig.(SIG); !ok {
 		return false, &InvalidType{
 			fmt.Sprintf("Invalid type. Expected %s, got %s", SIG{}.Name(), sig.Name()),
 		}
 	}
-	parsedSig, parseSigError := btcec.ParseDERSignature(sig.Data(), btcec.S256())
+	sigData := sig.Data()
+	if len(sigData) == 0 {
+		return false, &SigParseError{"Empty signature"}
+	}
+	hashType := sigData[len(sigData)-1]
+	parsedSig, parseSigError := btcec.ParseDERSignature(sigData[:len(sigData)-1], btcec.S256())
 	if parseSigError != nil {
 		return false, &SigParseError{
 			fmt.Sprintf("%s --- %s", "Error parsing signature", parseSigError.Error()),
 		}
 	}
 
-	// Verify the signature
-	verify := parsedSig.Verify(txHash.Bytes(), pubKeyParsed)
-
-	if !verify {
-		return false, &SigValidationError{"Signature validation error"}
+	txHash, err := w.SigHash(hashType)
+	if err != nil {
+		return false, &SigValidationError{fmt.Sprintf("Unable to build signed message: %s", err)}
 	}
 
-	return true, nil
+	// Verify the signature
+	return parsedSig.Verify(txHash, pubKeyParsed), nil
 }
-func (OP_CHECKSIG) AsByte() byte  { return OP_CHECKSIG_BYTE }
-func (OP_CHECKSIG) LenData() byte { return 0x00 }
-func (OP_CHECKSIG) Data() []byte  { return []byte{0x00} }
-func (OP_CHECKSIG) Name() string  { return "OP_CHECKSIG" }
+func (OP_CHECKSIG) AsByte() byte { return OP_CHECKSIG_BYTE }
+func (OP_CHECKSIG) LenData() int { return 0 }
+func (OP_CHECKSIG) Data() []byte { return []byte{0x00} }
+func (OP_CHECKSIG) Name() string { return "OP_CHECKSIG" }
 func (s OP_CHECKSIG) Copy() Operand {
 	return OP_CHECKSIG{}
 }
@@ -164,10 +247,10 @@ func (p SIG) Work(s *Stack, w ScriptContext) (bool, error) {
 	s.Push(p.Copy())
 	return true, nil
 }
-func (SIG) AsByte() byte     { return SIG_BYTE }
-func (op SIG) LenData() byte { return byte(len(op.Sig)) }
-func (op SIG) Data() []byte  { return op.Sig }
-func (SIG) Name() string     { return "SIG" }
+func (SIG) AsByte() byte    { return SIG_BYTE }
+func (op SIG) LenData() int { return len(op.Sig) }
+func (op SIG) Data() []byte { return op.Sig }
+func (SIG) Name() string    { return "SIG" }
 func (s SIG) Copy() Operand {
 	return SIG{Sig: append([]byte{}, s.Sig...)}
 }
@@ -179,10 +262,10 @@ func (p PUB_KEY_V1) Work(s *Stack, w ScriptContext) (bool, error) {
 	s.Push(p.Copy())
 	return true, nil
 }
-func (PUB_KEY_V1) AsByte() byte     { return PUB_KEY_V1_BYTE }
-func (op PUB_KEY_V1) LenData() byte { return byte(len(op.Key)) }
-func (op PUB_KEY_V1) Data() []byte  { return append([]byte{}, op.Key[:]...) }
-func (PUB_KEY_V1) Name() string     { return "PUB_KEY_V1" }
+func (PUB_KEY_V1) AsByte() byte    { return PUB_KEY_V1_BYTE }
+func (op PUB_KEY_V1) LenData() int { return len(op.Key) }
+func (op PUB_KEY_V1) Data() []byte { return append([]byte{}, op.Key[:]...) }
+func (PUB_KEY_V1) Name() string    { return "PUB_KEY_V1" }
 func (op PUB_KEY_V1) Copy() Operand {
 	return PUB_KEY_V1{Key: append([]byte{}, op.Key...)}
 }
@@ -194,35 +277,161 @@ func (p PUB_KEY_HASH) Work(s *Stack, w ScriptContext) (bool, error) {
 	s.Push(p.Copy())
 	return true, nil
 }
-func (PUB_KEY_HASH) AsByte() byte     { return PUB_KEY_HASH_BYTE }
-func (op PUB_KEY_HASH) LenData() byte { return byte(len(op.Key)) }
-func (op PUB_KEY_HASH) Data() []byte  { return append([]byte{}, op.Key[:]...) }
-func (PUB_KEY_HASH) Name() string     { return "PUB_KEY_HASH" }
+func (PUB_KEY_HASH) AsByte() byte    { return PUB_KEY_HASH_BYTE }
+func (op PUB_KEY_HASH) LenData() int { return len(op.Key) }
+func (op PUB_KEY_HASH) Data() []byte { return append([]byte{}, op.Key[:]...) }
+func (PUB_KEY_HASH) Name() string    { return "PUB_KEY_HASH" }
 func (op PUB_KEY_HASH) Copy() Operand {
 	return PUB_KEY_HASH{Key: append([]byte{}, op.Key...)}
 }
 
+// SCRIPT A serialised redeem script, the last push of a ScriptSig
+// spending a pay to script hash output
+type SCRIPT struct{ Script []byte }
+
+func (p SCRIPT) Work(s *Stack, w ScriptContext) (bool, error) {
+	s.Push(p.Copy())
+	return true, nil
+}
+func (SCRIPT) AsByte() byte    { return SCRIPT_BYTE }
+func (op SCRIPT) LenData() int { return len(op.Script) }
+func (op SCRIPT) Data() []byte { return append([]byte{}, op.Script...) }
+func (SCRIPT) Name() string    { return "SCRIPT" }
+func (op SCRIPT) Copy() Operand {
+	return SCRIPT{Script: append([]byte{}, op.Script...)}
+}
+
+// SCRIPT_HASH The sha256 followed by ripemd160 hash of a SCRIPT
+type SCRIPT_HASH struct{ Hash []byte }
+
+func (p SCRIPT_HASH) Work(s *Stack, w ScriptContext) (bool, error) {
+	s.Push(p.Copy())
+	return true, nil
+}
+func (SCRIPT_HASH) AsByte() byte    { return SCRIPT_HASH_BYTE }
+func (op SCRIPT_HASH) LenData() int { return len(op.Hash) }
+func (op SCRIPT_HASH) Data() []byte { return append([]byte{}, op.Hash...) }
+func (SCRIPT_HASH) Name() string    { return "SCRIPT_HASH" }
+func (op SCRIPT_HASH) Copy() Operand {
+	return SCRIPT_HASH{Hash: append([]byte{}, op.Hash...)}
+}
+
 // OP_HASH_160 We use the 25 byte btc address representation
 // Take the top element, then do sha256, followed by ripemd160 hash
-// We check that it is an operand of type PUB_KEY_V1
+// We check that it is an operand of type PUB_KEY_V1, which hashes to
+// a PUB_KEY_HASH, or a SCRIPT, which hashes to a SCRIPT_HASH
 type OP_HASH_160 struct{}
 
 func (OP_HASH_160) Work(s *Stack, w ScriptContext) (bool, error) {
-	top := s.Top().Data()
-	_, ok := s.Top().(PUB_KEY_V1)
-	if !ok {
-		return false, nil
+	top, err := s.Pop()
+	if err != nil {
+		return false, err
+	}
+	switch top.(type) {
+	case PUB_KEY_V1:
+		s.Push(PUB_KEY_HASH{ripe160sha256(top.Data())})
+	case SCRIPT:
+		s.Push(SCRIPT_HASH{ripe160sha256(top.Data())})
+	default:
+		return false, &InvalidType{
+			fmt.Sprintf("Invalid type. Expected %s or %s, got %s", PUB_KEY_V1{}.Name(), SCRIPT{}.Name(), top.Name()),
+		}
 	}
-
-	hash := ripe160sha256(top)
-	s.Pop()
-	s.Push(PUB_KEY_HASH{hash})
 	return true, nil
 }
 func (OP_HASH_160) AsByte() byte    { return OP_HASH_160_BYTE }
-func (OP_HASH_160) LenData() byte   { return 25 }
+func (OP_HASH_160) LenData() int    { return 25 }
 func (op OP_HASH_160) Data() []byte { return []byte{0x00} }
 func (OP_HASH_160) Name() string    { return "OP_HASH_160" }
 func (op OP_HASH_160) Copy() Operand {
 	return OP_HASH_160{}
 }
+
+// OP_DROP Removes the top stack item
+type OP_DROP struct{}
+
+func (OP_DROP) Work(s *Stack, w ScriptContext) (bool, error) {
+	if _, err := s.Pop(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (OP_DROP) AsByte() byte { return OP_DROP_BYTE }
+func (OP_DROP) LenData() int { return 0 }
+func (OP_DROP) Data() []byte { return []byte{0x00} }
+func (OP_DROP) Name() string { return "OP_DROP" }
+func (OP_DROP) Copy() Operand {
+	return OP_DROP{}
+}
+
+// lockTimeArg The non negative NUMBER on top of the stack used as a
+// lock time by op
+func lockTimeArg(s *Stack, op Operand) (int64, error) {
+	top, err := s.Top()
+	if err != nil {
+		return 0, err
+	}
+	num, ok := top.(NUMBER)
+	if !ok {
+		return 0, &InvalidType{
+			fmt.Sprintf("Invalid type. Expected %s, got %s", NUMBER{}.Name(), top.Name()),
+		}
+	}
+	value, err := num.Int64(maxLockTimeNumLen)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 {
+		return 0, &LockTimeError{fmt.Sprintf("%s with negative lock time %d", op.Name(), value)}
+	}
+	return value, nil
+}
+
+// OP_CHECKLOCKTIMEVERIFY Marks the transaction as invalid if the top
+// stack item is greater than the transaction LockTime, or is a height
+// when the LockTime is a time or the other way round. The input must
+// not be final or the LockTime would be ignored.
+// The top stack item is left on the stack
+type OP_CHECKLOCKTIMEVERIFY struct{}
+
+func (op OP_CHECKLOCKTIMEVERIFY) Work(s *Stack, w ScriptContext) (bool, error) {
+	lockTime, err := lockTimeArg(s, op)
+	if err != nil {
+		return false, err
+	}
+	if err := w.CheckLockTime(lockTime); err != nil {
+		return false, &LockTimeError{err.Error()}
+	}
+	return true, nil
+}
+func (OP_CHECKLOCKTIMEVERIFY) AsByte() byte { return OP_CHECKLOCKTIMEVERIFY_BYTE }
+func (OP_CHECKLOCKTIMEVERIFY) LenData() int { return 0 }
+func (OP_CHECKLOCKTIMEVERIFY) Data() []byte { return []byte{0x00} }
+func (OP_CHECKLOCKTIMEVERIFY) Name() string { return "OP_CHECKLOCKTIMEVERIFY" }
+func (OP_CHECKLOCKTIMEVERIFY) Copy() Operand {
+	return OP_CHECKLOCKTIMEVERIFY{}
+}
+
+// OP_CHECKSEQUENCEVERIFY Marks the transaction as invalid if the
+// relative lock time of the input is less than the top stack item.
+// Does nothing if the top stack item has the disable flag set.
+// The top stack item is left on the stack
+type OP_CHECKSEQUENCEVERIFY struct{}
+
+func (op OP_CHECKSEQUENCEVERIFY) Work(s *Stack, w ScriptContext) (bool, error) {
+	sequence, err := lockTimeArg(s, op)
+	if err != nil {
+		return false, err
+	}
+	if err := w.CheckSequence(sequence); err != nil {
+		return false, &LockTimeError{err.Error()}
+	}
+	return true, nil
+}
+func (OP_CHECKSEQUENCEVERIFY) AsByte() byte { return OP_CHECKSEQUENCEVERIFY_BYTE }
+func (OP_CHECKSEQUENCEVERIFY) LenData() int { return 0 }
+func (OP_CHECKSEQUENCEVERIFY) Data() []byte { return []byte{0x00} }
+func (OP_CHECKSEQUENCEVERIFY) Name() string { return "OP_CHECKSEQUENCEVERIFY" }
+func (OP_CHECKSEQUENCEVERIFY) Copy() Operand {
+	return OP_CHECKSEQUENCEVERIFY{}
+}
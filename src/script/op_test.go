@@ -2,13 +2,21 @@ package script
 
 import (
 	"encoding/hex"
-	"bytes"
 	"testing"
 )
 
-type fakedScriptContext struct {}
-func (f *fakedScriptContext) SerialiseForSign() *bytes.Buffer {
-	return &bytes.Buffer{}
+type fakedScriptContext struct{}
+
+func (f *fakedScriptContext) SigHash(hashType byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (f *fakedScriptContext) CheckLockTime(lockTime int64) error {
+	return nil
+}
+
+func (f *fakedScriptContext) CheckSequence(sequence int64) error {
+	return nil
 }
 
 func TestPubKeyV1(t *testing.T) {
@@ -28,11 +36,11 @@ func TestPubKeyV1(t *testing.T) {
 		opResult, err := s.Work(&stack, &ctxt)
 		result = result && opResult
 		if err != nil {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		}
 	}
 
-	if _, ok := stack.Top().(PUB_KEY_V1); !ok {
+	if _, ok := top(t, &stack).(PUB_KEY_V1); !ok {
 		t.Errorf("Expected type: %#v", PUB_KEY_V1{})
 	}
 
@@ -59,15 +67,15 @@ func TestOpDup(t *testing.T) {
 		opResult, err := s.Work(&stack, &ctxt)
 		result = result && opResult
 		if err != nil {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		}
 	}
 
-	if _, ok := stack.Top().(PUB_KEY_V1); !ok {
+	if _, ok := top(t, &stack).(PUB_KEY_V1); !ok {
 		t.Errorf("Expected type: %#v", PUB_KEY_V1{})
 	}
 
-	if _, ok := stack.Second().(PUB_KEY_V1); !ok {
+	if _, ok := second(t, &stack).(PUB_KEY_V1); !ok {
 		t.Errorf("Expected type: %#v", PUB_KEY_V1{})
 	}
 
@@ -95,7 +103,7 @@ func TestOpEqualVerify(t *testing.T) {
 		opResult, err := s.Work(&stack, &ctxt)
 		result = result && opResult
 		if err != nil {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		}
 	}
 
@@ -127,7 +135,7 @@ func TestOpHash160(t *testing.T) {
 		opResult, err := s.Work(&stack, &ctxt)
 		result = result && opResult
 		if err != nil {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		}
 	}
 
@@ -139,7 +147,7 @@ func TestOpHash160(t *testing.T) {
 		t.Errorf("Expected 1 items in stack")
 	}
 
-	opHashResult := hex.EncodeToString(stack.Top().Data())
+	opHashResult := hex.EncodeToString(top(t, &stack).Data())
 	expected := "f54a5851e9372b87810a8e60cdd2e7cfd80b6e31"
 	if expected != opHashResult {
 		t.Errorf("Expected %s, got %s", expected, opHashResult)
@@ -1,17 +1,16 @@
-package script
+package script_test
 
 import (
 	"spchain/chain"
+	"spchain/chainhash"
 	"spchain/key"
-	"strconv"
+	"spchain/script"
 	"testing"
 )
 
 func createTxInput() chain.InputTx {
-	hexString := "029a"
-	txid, _ := strconv.ParseUint(hexString, 16, 32)
 	return chain.InputTx{
-		Txid:      int32(txid),
+		Txid:      chainhash.Hash{0x02, 0x9a},
 		OutInx:    0,
 		ScriptSig: []byte{0},
 		Sequence:  0,
@@ -37,26 +36,30 @@ func TestCheckSig(t *testing.T) {
 
 	privKeyHexString := "18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"
 	key := key.ImportFromPrivKeyHexString(privKeyHexString)
+	prevOut := createTxOutput()
 
-	txHash := tx.SerialiseForSign().Bytes()
-	sig, _ := key.PrivateKey.Sign(txHash)
+	sig, err := tx.SignInput(0, key.PrivateKey, &prevOut)
+	if err != nil {
+		t.Fatalf("Unable to sign %s", err)
+	}
 
-	script := Stack{
-		[]Operand{
-			SIG{sig.Serialize()},
-			PUB_KEY_V1{key.PublicKey.SerializeCompressed()},
-			OP_CHECKSIG{},
+	ops := script.Stack{
+		[]script.Operand{
+			script.SIG{sig},
+			script.PUB_KEY_V1{key.PublicKey.SerializeCompressed()},
+			script.OP_CHECKSIG{},
 		},
 	}
 
-	stack := Stack{}
+	stack := script.Stack{}
+	ctxt := chain.SigContext{Tx: &tx, InputIndex: 0, PrevOut: &prevOut}
 
 	result := true
-	for _, s := range script.Contents {
-		opResult, err := s.Work(&stack, &tx)
+	for _, s := range ops.Contents {
+		opResult, err := s.Work(&stack, &ctxt)
 		result = result && opResult
 		if err != nil {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		}
 	}
 
@@ -64,3 +67,40 @@ func TestCheckSig(t *testing.T) {
 		t.Errorf("Expected true result")
 	}
 }
+
+func TestCheckSigHashTypeMismatch(t *testing.T) {
+	tx := chain.Tx{
+		Version:  10,
+		TxInNo:   1,
+		TxOutNo:  1,
+		Vin:      []chain.InputTx{createTxInput()},
+		Vout:     []chain.OutputTx{createTxOutput()},
+		LockTime: 10,
+	}
+
+	privKeyHexString := "18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"
+	key := key.ImportFromPrivKeyHexString(privKeyHexString)
+	prevOut := createTxOutput()
+
+	sig, _ := tx.SignInputWithType(0, key.PrivateKey, &prevOut, chain.SigHashNone)
+	ctxt := chain.SigContext{Tx: &tx, InputIndex: 0, PrevOut: &prevOut}
+	pubKey := script.PUB_KEY_V1{key.PublicKey.SerializeCompressed()}
+
+	stack := script.Stack{[]script.Operand{script.SIG{sig}, pubKey}}
+	if ok, err := (script.OP_CHECKSIG{}).Work(&stack, &ctxt); !ok || err != nil {
+		t.Errorf("Expected a SIGHASH_NONE signature to verify, got %v", err)
+	}
+
+	// Relabelling the signature as another type changes the digest
+	relabelled := append(append([]byte{}, sig[:len(sig)-1]...), byte(chain.SigHashAll))
+	stack = script.Stack{[]script.Operand{script.SIG{relabelled}, pubKey}}
+	if ok, _ := (script.OP_CHECKSIG{}).Work(&stack, &ctxt); ok {
+		t.Errorf("Expected a relabelled signature to fail")
+	}
+
+	unknown := append(append([]byte{}, sig[:len(sig)-1]...), 0x04)
+	stack = script.Stack{[]script.Operand{script.SIG{unknown}, pubKey}}
+	if ok, _ := (script.OP_CHECKSIG{}).Work(&stack, &ctxt); ok {
+		t.Errorf("Expected an unknown sighash type to fail")
+	}
+}
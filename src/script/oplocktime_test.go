@@ -0,0 +1,152 @@
+package script_test
+
+import (
+	"spchain/chain"
+	"spchain/key"
+	"spchain/script"
+	"testing"
+)
+
+// runLockedP2PKH Run a P2PKH script behind lockOp with the lock time n
+// for an input with sequence in a transaction with lockTime
+func runLockedP2PKH(t *testing.T, lockOp script.Operand, n int64, lockTime int32, sequence int32) error {
+	input := createTxInput()
+	input.Sequence = sequence
+	tx := chain.Tx{
+		Version:  chain.TxVersionSequenceLock,
+		TxInNo:   1,
+		TxOutNo:  1,
+		Vin:      []chain.InputTx{input},
+		Vout:     []chain.OutputTx{createTxOutput()},
+		LockTime: lockTime,
+	}
+
+	key := key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725")
+	prevOut := createTxOutput()
+	sig, err := tx.SignInput(0, key.PrivateKey, &prevOut)
+	if err != nil {
+		t.Fatalf("Unable to sign %s", err)
+	}
+
+	unlocking := script.Stack{[]script.Operand{script.SIG{sig}, script.PUB_KEY_V1{key.PublicKey.SerializeCompressed()}}}
+	locking := script.Stack{[]script.Operand{
+		script.NewNumber(n),
+		lockOp,
+		script.OP_DROP{},
+		script.OP_DUP{},
+		script.OP_HASH_160{},
+		script.PUB_KEY_V1{key.PublicKeyHash},
+		script.OP_EQUALVERIFY{},
+		script.OP_CHECKSIG{},
+	}}
+
+	ctxt := chain.SigContext{Tx: &tx, InputIndex: 0, PrevOut: &prevOut}
+	engine, err := script.NewEngine(&ctxt, unlocking.Ser().Bytes(), locking.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return engine.Execute()
+}
+
+// expectErrorCode Fail unless err is a *ScriptError with code
+func expectErrorCode(t *testing.T, name string, err error, code script.ErrorCode) {
+	t.Helper()
+	scriptErr, ok := err.(*script.ScriptError)
+	if !ok || scriptErr.Code != code {
+		t.Errorf("%s: expected %s, got %v", name, code, err)
+	}
+}
+
+func TestCheckLockTimeVerify(t *testing.T) {
+	if err := runLockedP2PKH(t, script.OP_CHECKLOCKTIMEVERIFY{}, 100, 100, 0); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		n        int64
+		lockTime int32
+		sequence int32
+	}{
+		{"lock time not reached", 101, 100, 0},
+		{"final input", 100, 100, -1},
+		{"negative lock time", -1, 100, 0},
+	}
+	for _, test := range tests {
+		err := runLockedP2PKH(t, script.OP_CHECKLOCKTIMEVERIFY{}, test.n, test.lockTime, test.sequence)
+		expectErrorCode(t, test.name, err, script.ErrLockTime)
+	}
+}
+
+func TestCheckSequenceVerify(t *testing.T) {
+	if err := runLockedP2PKH(t, script.OP_CHECKSEQUENCEVERIFY{}, 10, 0, 10); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	err := runLockedP2PKH(t, script.OP_CHECKSEQUENCEVERIFY{}, 11, 0, 10)
+	expectErrorCode(t, "relative lock time not reached", err, script.ErrLockTime)
+}
+
+func TestLockTimeNeedsNumber(t *testing.T) {
+	stack := script.Stack{[]script.Operand{script.PUB_KEY_V1{Key: []byte{1}}}}
+	_, err := script.OP_CHECKLOCKTIMEVERIFY{}.Work(&stack, &chain.SigContext{})
+	if _, ok := err.(*script.InvalidType); !ok {
+		t.Errorf("Expected InvalidType, got %v", err)
+	}
+}
+
+// runOwnerOrRecovery Spend an output which the owner key can spend at
+// any time, and the recovery key after lock time 100. The ScriptSig
+// picks the path with a NUMBER, 1 for the owner
+func runOwnerOrRecovery(t *testing.T, signer key.Key, path int64, lockTime int32) error {
+	owner := key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725")
+	recovery := key.ImportFromPrivKeyHexString("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+	locking := script.Stack{[]script.Operand{
+		script.OP_IF{},
+		script.PUB_KEY_V1{owner.PublicKey.SerializeCompressed()},
+		script.OP_ELSE{},
+		script.NewNumber(100),
+		script.OP_CHECKLOCKTIMEVERIFY{},
+		script.OP_DROP{},
+		script.PUB_KEY_V1{recovery.PublicKey.SerializeCompressed()},
+		script.OP_ENDIF{},
+		script.OP_CHECKSIG{},
+	}}
+
+	input := createTxInput()
+	tx := chain.Tx{
+		Version:  1,
+		TxInNo:   1,
+		TxOutNo:  1,
+		Vin:      []chain.InputTx{input},
+		Vout:     []chain.OutputTx{createTxOutput()},
+		LockTime: lockTime,
+	}
+	prevOut := chain.OutputTx{Value: 20000, ScriptPubKey: locking.Ser().Bytes()}
+	sig, err := tx.SignInput(0, signer.PrivateKey, &prevOut)
+	if err != nil {
+		t.Fatalf("Unable to sign %s", err)
+	}
+	unlocking := script.Stack{[]script.Operand{script.SIG{sig}, script.NewNumber(path)}}
+
+	ctxt := chain.SigContext{Tx: &tx, InputIndex: 0, PrevOut: &prevOut}
+	engine, err := script.NewEngine(&ctxt, unlocking.Ser().Bytes(), prevOut.ScriptPubKey)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return engine.Execute()
+}
+
+func TestOwnerOrRecovery(t *testing.T) {
+	owner := key.ImportFromPrivKeyHexString("18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725")
+	recovery := key.ImportFromPrivKeyHexString("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+
+	if err := runOwnerOrRecovery(t, owner, 1, 0); err != nil {
+		t.Errorf("Owner: unexpected error %s", err)
+	}
+	if err := runOwnerOrRecovery(t, recovery, 0, 100); err != nil {
+		t.Errorf("Recovery after the timeout: unexpected error %s", err)
+	}
+	expectErrorCode(t, "Recovery before the timeout", runOwnerOrRecovery(t, recovery, 0, 99), script.ErrLockTime)
+	expectErrorCode(t, "Recovery key on the owner path", runOwnerOrRecovery(t, recovery, 1, 100), script.ErrSigValidation)
+}
@@ -1,8 +1,9 @@
-package script
+package script_test
 
 import (
 	"spchain/chain"
 	"spchain/key"
+	"spchain/script"
 	"testing"
 )
 
@@ -19,34 +20,49 @@ func TestP2PKH(t *testing.T) {
 
 	privKeyHexString := "18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"
 	key := key.ImportFromPrivKeyHexString(privKeyHexString)
+	prevOut := createTxOutput()
 
-	txHash := tx.SerialiseForSign().Bytes()
-	sig, _ := key.PrivateKey.Sign(txHash)
+	sig, err := tx.SignInput(0, key.PrivateKey, &prevOut)
+	if err != nil {
+		t.Fatalf("Unable to sign %s", err)
+	}
 
-	script := Stack{
-		[]Operand{
-			SIG{sig.Serialize()},
-			PUB_KEY_V1{key.PublicKey.SerializeCompressed()},
-			OP_DUP{},
-			OP_HASH_160{},
-			PUB_KEY_V1{key.PublicKeyHash},
-			OP_EQUALVERIFY{},
-			OP_CHECKSIG{},
+	unlocking := script.Stack{
+		[]script.Operand{
+			script.SIG{sig},
+			script.PUB_KEY_V1{key.PublicKey.SerializeCompressed()},
+		},
+	}
+	locking := script.Stack{
+		[]script.Operand{
+			script.OP_DUP{},
+			script.OP_HASH_160{},
+			script.PUB_KEY_V1{key.PublicKeyHash},
+			script.OP_EQUALVERIFY{},
+			script.OP_CHECKSIG{},
 		},
 	}
 
-	stack := Stack{}
-
-	result := true
-	for _, s := range script.Contents {
-		opResult, err := s.Work(&stack, &tx)
-		result = result && opResult
-		if err != nil {
-			t.Errorf(err.Error())
-		}
+	ctxt := chain.SigContext{Tx: &tx, InputIndex: 0, PrevOut: &prevOut}
+	engine, err := script.NewEngine(&ctxt, unlocking.Ser().Bytes(), locking.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := engine.Execute(); err != nil {
+		t.Errorf("Unexpected error %s", err)
 	}
 
-	if !result {
-		t.Errorf("Expected true result")
+	// Another public key does not match the hash
+	other := script.Stack{[]script.Operand{
+		script.SIG{sig},
+		script.PUB_KEY_V1{key.PublicKeyHash},
+	}}
+	engine, err = script.NewEngine(&ctxt, other.Ser().Bytes(), locking.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	err = engine.Execute()
+	if scriptErr, ok := err.(*script.ScriptError); !ok || scriptErr.Code != script.ErrVerify || scriptErr.Index != 5 {
+		t.Errorf("Expected ErrVerify at operand 5, got %v", err)
 	}
 }
@@ -0,0 +1,77 @@
+package script
+
+import (
+	"bytes"
+)
+
+/*
+  A pay to script hash output locks to the hash of a redeem script
+  instead of the script itself:
+
+   Unlocking: <pushes> SCRIPT
+   Locking:   OP_HASH_160 SCRIPT_HASH OP_EQUALVERIFY
+
+  The ScriptSig may only push data. After the locking script has
+  checked SCRIPT hashes to SCRIPT_HASH, the Engine runs the redeem
+  script in SCRIPT on the pushes left on the stack.
+*/
+
+// ScriptHashLen The length of a SCRIPT_HASH in a pay to script hash
+// locking script
+const ScriptHashLen = 20
+
+// ScriptHash The hash of redeemScript which a pay to script hash
+// output locks to
+func ScriptHash(redeemScript []byte) []byte {
+	return ripe160sha256(redeemScript)
+}
+
+// PayToScriptHash The locking script of an output paying to the hash
+// of redeemScript
+func PayToScriptHash(redeemScript []byte) Stack {
+	return Stack{[]Operand{
+		OP_HASH_160{},
+		SCRIPT_HASH{ScriptHash(redeemScript)},
+		OP_EQUALVERIFY{},
+	}}
+}
+
+// PayToScriptHashUnlockingScript The unlocking script spending a pay
+// to script hash output. unlocking are the pushes redeemScript needs
+func PayToScriptHashUnlockingScript(unlocking Stack, redeemScript []byte) Stack {
+	ret := Stack{[]Operand{}}
+	for _, op := range unlocking.Contents {
+		ret.Push(op.Copy())
+	}
+	ret.Push(SCRIPT{Script: append([]byte{}, redeemScript...)})
+	return ret
+}
+
+// IsPayToScriptHash True if the locking script b pays to a script hash
+func IsPayToScriptHash(b []byte) bool {
+	stack, err := Marshall(bytes.NewBuffer(append([]byte{}, b...)))
+	if err != nil {
+		return false
+	}
+	return isPayToScriptHash(stack)
+}
+
+func isPayToScriptHash(s Stack) bool {
+	ops := s.Contents
+	if len(ops) != 3 {
+		return false
+	}
+	_, okHash160 := ops[0].(OP_HASH_160)
+	hash, okHash := ops[1].(SCRIPT_HASH)
+	_, okEqual := ops[2].(OP_EQUALVERIFY)
+	return okHash160 && okHash && okEqual && len(hash.Hash) == ScriptHashLen
+}
+
+// isPush True if op only pushes data onto the stack
+func isPush(op Operand) bool {
+	switch op.(type) {
+	case SIG, PUB_KEY_V1, PUB_KEY_HASH, NUMBER, OP_N, SCRIPT, SCRIPT_HASH:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package script_test
+
+import (
+	"spchain/chain"
+	"spchain/key"
+	"spchain/script"
+	"strings"
+	"testing"
+)
+
+// p2shTest A transaction spending an output paying to the hash of a
+// 2-of-2 script
+type p2shTest struct {
+	keys    []key.Key
+	redeem  []byte
+	tx      chain.Tx
+	prevOut chain.OutputTx
+}
+
+func newP2SHTest(t *testing.T) *p2shTest {
+	p := &p2shTest{
+		keys: []key.Key{key.NewKey(), key.NewKey()},
+		tx: chain.Tx{
+			Version: 1,
+			TxInNo:  1,
+			TxOutNo: 1,
+			Vin:     []chain.InputTx{createTxInput()},
+			Vout:    []chain.OutputTx{createTxOutput()},
+		},
+	}
+	redeem, err := script.MultiSigScript(2, [][]byte{
+		p.keys[0].PublicKey.SerializeCompressed(),
+		p.keys[1].PublicKey.SerializeCompressed(),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	p.redeem = redeem.Ser().Bytes()
+	locking := script.PayToScriptHash(p.redeem)
+	p.prevOut = chain.OutputTx{Value: 20000, ScriptPubKey: locking.Ser().Bytes()}
+	return p
+}
+
+// sigs Signatures by both keys
+func (p *p2shTest) sigs(t *testing.T) [][]byte {
+	sigs := [][]byte{}
+	for _, k := range p.keys {
+		sig, err := p.tx.SignInput(0, k.PrivateKey, &p.prevOut)
+		if err != nil {
+			t.Fatalf("Unable to sign %s", err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+func (p *p2shTest) run(t *testing.T, unlocking script.Stack) error {
+	ctxt := chain.SigContext{Tx: &p.tx, InputIndex: 0, PrevOut: &p.prevOut}
+	engine, err := script.NewEngine(&ctxt, unlocking.Ser().Bytes(), p.prevOut.ScriptPubKey)
+	if err != nil {
+		return err
+	}
+	return engine.Execute()
+}
+
+func TestP2SH(t *testing.T) {
+	p := newP2SHTest(t)
+	if !script.IsPayToScriptHash(p.prevOut.ScriptPubKey) {
+		t.Fatalf("Expected a pay to script hash locking script")
+	}
+	if script.IsPayToScriptHash(p.redeem) {
+		t.Errorf("A multisig script does not pay to a script hash")
+	}
+
+	unlocking := script.PayToScriptHashUnlockingScript(script.MultiSigUnlockingScript(p.sigs(t)), p.redeem)
+	if err := p.run(t, unlocking); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	// The redeem script still has to be satisfied
+	sigs := p.sigs(t)
+	unlocking = script.PayToScriptHashUnlockingScript(script.MultiSigUnlockingScript(sigs[:1]), p.redeem)
+	expectErrorCode(t, "One signature", p.run(t, unlocking), script.ErrStackUnderflow)
+	unlocking = script.PayToScriptHashUnlockingScript(script.MultiSigUnlockingScript([][]byte{sigs[1], sigs[0]}), p.redeem)
+	expectErrorCode(t, "Signatures out of order", p.run(t, unlocking), script.ErrSigValidation)
+}
+
+func TestP2SHWrongScript(t *testing.T) {
+	p := newP2SHTest(t)
+	other, _ := script.MultiSigScript(1, [][]byte{p.keys[0].PublicKey.SerializeCompressed()})
+	unlocking := script.PayToScriptHashUnlockingScript(script.MultiSigUnlockingScript(p.sigs(t)[:1]), other.Ser().Bytes())
+
+	// The hash is checked by the OP_EQUALVERIFY after the two pushes
+	err := p.run(t, unlocking)
+	if scriptErr, ok := err.(*script.ScriptError); !ok || scriptErr.Code != script.ErrVerify || scriptErr.Index != 4 {
+		t.Errorf("Expected ErrVerify at operand 4, got %v", err)
+	}
+}
+
+func TestP2SHScriptSig(t *testing.T) {
+	p := newP2SHTest(t)
+	sigs := script.MultiSigUnlockingScript(p.sigs(t))
+
+	notPush := script.PayToScriptHashUnlockingScript(sigs, p.redeem)
+	notPush.Contents = append([]script.Operand{script.OP_DUP{}}, notPush.Contents...)
+	expectErrorCode(t, "OP_DUP in ScriptSig", p.run(t, notPush), script.ErrSigPushOnly)
+
+	expectErrorCode(t, "No redeem script", p.run(t, sigs), script.ErrInvalidType)
+	expectErrorCode(t, "Empty ScriptSig", p.run(t, script.Stack{}), script.ErrStackUnderflow)
+
+	malformed := script.PayToScriptHashUnlockingScript(sigs, []byte{0xff})
+	expectErrorCode(t, "Malformed redeem script", p.run(t, malformed), script.ErrMalformedScript)
+}
+
+func TestP2SHDisassemble(t *testing.T) {
+	p := newP2SHTest(t)
+	asm, err := script.Disassemble(p.prevOut.ScriptPubKey)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !strings.HasPrefix(asm, "OP_HASH_160 SCRIPT_HASH[") || !strings.HasSuffix(asm, "] OP_EQUALVERIFY") {
+		t.Errorf("Unexpected asm %s", asm)
+	}
+}
@@ -31,3 +31,208 @@ type InvalidType struct {
 func (p *InvalidType) Error() string {
 	return p.Msg
 }
+
+// MarshallError Bytes which are not a valid script
+type MarshallError struct {
+	Msg string
+}
+
+func (p *MarshallError) Error() string {
+	return p.Msg
+}
+
+// NumberError A NUMBER which is too long or not minimally encoded
+type NumberError struct {
+	Msg string
+}
+
+func (p *NumberError) Error() string {
+	return p.Msg
+}
+
+// LockTimeError A lock time or relative lock time which has not
+// been reached
+type LockTimeError struct {
+	Msg string
+}
+
+func (p *LockTimeError) Error() string {
+	return p.Msg
+}
+
+// StackUnderflowError An operand needs more items than are on the stack
+type StackUnderflowError struct {
+	Msg string
+}
+
+func (p *StackUnderflowError) Error() string {
+	return p.Msg
+}
+
+// VerifyError A verify operand found its condition false
+type VerifyError struct {
+	Msg string
+}
+
+func (p *VerifyError) Error() string {
+	return p.Msg
+}
+
+// MultiSigError An m-of-n script or OP_CHECKMULTISIG with counts
+// out of range
+type MultiSigError struct {
+	Msg string
+}
+
+func (p *MultiSigError) Error() string {
+	return p.Msg
+}
+
+// ConditionalError An OP_ELSE or OP_ENDIF without an OP_IF or
+// OP_NOTIF, or an OP_IF or OP_NOTIF without an OP_ENDIF
+type ConditionalError struct {
+	Msg string
+}
+
+func (p *ConditionalError) Error() string {
+	return p.Msg
+}
+
+// EarlyReturnError An OP_RETURN was run
+type EarlyReturnError struct {
+	Msg string
+}
+
+func (p *EarlyReturnError) Error() string {
+	return p.Msg
+}
+
+// ErrorCode Identifies why a script failed
+type ErrorCode int
+
+const (
+	// ErrMalformedScript The ScriptSig or ScriptPubKey bytes are not
+	// a valid script
+	ErrMalformedScript ErrorCode = iota
+
+	// ErrEmptyScript The ScriptPubKey has no operands
+	ErrEmptyScript
+
+	// ErrStackUnderflow An operand needs more items than are on
+	// the stack
+	ErrStackUnderflow
+
+	// ErrInvalidType A stack item is not the type an operand expects
+	ErrInvalidType
+
+	// ErrVerify A verify operand found its condition false
+	ErrVerify
+
+	// ErrPubKeyParse A public key could not be parsed
+	ErrPubKeyParse
+
+	// ErrSigParse A signature could not be parsed
+	ErrSigParse
+
+	// ErrSigValidation A signature does not sign the transaction
+	ErrSigValidation
+
+	// ErrNumber A NUMBER is too long or not minimally encoded
+	ErrNumber
+
+	// ErrLockTime A lock time or relative lock time has not been reached
+	ErrLockTime
+
+	// ErrEvalFalse The scripts finished with an empty stack or a
+	// false item on top
+	ErrEvalFalse
+
+	// ErrMultiSig OP_CHECKMULTISIG was given key or signature counts
+	// out of range
+	ErrMultiSig
+
+	// ErrSigPushOnly A ScriptSig spending a pay to script hash output
+	// does more than push data
+	ErrSigPushOnly
+
+	// ErrUnbalancedConditional An OP_ELSE or OP_ENDIF has no OP_IF or
+	// OP_NOTIF, or a script ends inside an OP_IF or OP_NOTIF
+	ErrUnbalancedConditional
+
+	// ErrEarlyReturn An OP_RETURN was run
+	ErrEarlyReturn
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrMalformedScript:       "ErrMalformedScript",
+	ErrEmptyScript:           "ErrEmptyScript",
+	ErrStackUnderflow:        "ErrStackUnderflow",
+	ErrInvalidType:           "ErrInvalidType",
+	ErrVerify:                "ErrVerify",
+	ErrPubKeyParse:           "ErrPubKeyParse",
+	ErrSigParse:              "ErrSigParse",
+	ErrSigValidation:         "ErrSigValidation",
+	ErrNumber:                "ErrNumber",
+	ErrLockTime:              "ErrLockTime",
+	ErrEvalFalse:             "ErrEvalFalse",
+	ErrMultiSig:              "ErrMultiSig",
+	ErrSigPushOnly:           "ErrSigPushOnly",
+	ErrUnbalancedConditional: "ErrUnbalancedConditional",
+	ErrEarlyReturn:           "ErrEarlyReturn",
+}
+
+// String The name of the error code
+func (e ErrorCode) String() string {
+	if s, ok := errorCodeStrings[e]; ok {
+		return s
+	}
+	return "Unknown ErrorCode"
+}
+
+// ScriptError Running a script failed. Code says why and Index is
+// the operand which failed, counting the ScriptSig operands, the
+// ScriptPubKey operands, then any redeem script operands. Index is -1
+// when the failure is not down to a single operand
+type ScriptError struct {
+	Code  ErrorCode
+	Index int
+	Msg   string
+}
+
+func (e *ScriptError) Error() string {
+	return e.Msg
+}
+
+// scriptError Create a ScriptError
+func scriptError(code ErrorCode, index int, msg string) *ScriptError {
+	return &ScriptError{Code: code, Index: index, Msg: msg}
+}
+
+// operandErrorCode The ErrorCode for an error returned by Operand.Work
+func operandErrorCode(err error) ErrorCode {
+	switch e := err.(type) {
+	case *StackUnderflowError:
+		return ErrStackUnderflow
+	case *InvalidType:
+		return ErrInvalidType
+	case *PubKeyParseError:
+		return ErrPubKeyParse
+	case *SigParseError:
+		return ErrSigParse
+	case *SigValidationError:
+		return ErrSigValidation
+	case *NumberError:
+		return ErrNumber
+	case *LockTimeError:
+		return ErrLockTime
+	case *MultiSigError:
+		return ErrMultiSig
+	case *ConditionalError:
+		return ErrUnbalancedConditional
+	case *EarlyReturnError:
+		return ErrEarlyReturn
+	case *ScriptError:
+		return e.Code
+	}
+	return ErrVerify
+}
@@ -3,30 +3,56 @@ package script
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"spchain/varint"
+	"strings"
 )
 
 type Stack struct {
 	Contents []Operand
 }
 
+// underflow The error for an operation needing n items on s
+func (s *Stack) underflow(n int) error {
+	return &StackUnderflowError{
+		fmt.Sprintf("Stack has %d items, %d needed", len(s.Contents), n),
+	}
+}
+
 // Top Return reference to the top item of the stack
-func (s *Stack) Top() Operand {
-	return s.Contents[len(s.Contents)-1]
+func (s *Stack) Top() (Operand, error) {
+	if len(s.Contents) < 1 {
+		return nil, s.underflow(1)
+	}
+	return s.Contents[len(s.Contents)-1], nil
 }
 
 // Second Return reference to the second item from the stack top
-func (s *Stack) Second() Operand {
-	return s.Contents[len(s.Contents)-2]
+func (s *Stack) Second() (Operand, error) {
+	if len(s.Contents) < 2 {
+		return nil, s.underflow(2)
+	}
+	return s.Contents[len(s.Contents)-2], nil
 }
 
-// Pop Pops one item of the stack
-func (s *Stack) Pop() {
+// Pop Pops one item of the stack and returns it
+func (s *Stack) Pop() (Operand, error) {
+	top, err := s.Top()
+	if err != nil {
+		return nil, err
+	}
 	s.Contents = s.Contents[:len(s.Contents)-1]
+	return top, nil
 }
 
 // PopTwo Pops two items of the stack
-func (s *Stack) PopTwo() {
+func (s *Stack) PopTwo() error {
+	if len(s.Contents) < 2 {
+		return s.underflow(2)
+	}
 	s.Contents = s.Contents[:len(s.Contents)-2]
+	return nil
 }
 
 func (s *Stack) Push(item Operand) {
@@ -35,15 +61,25 @@ func (s *Stack) Push(item Operand) {
 
 // DuplicateTop duplicates the top items of the
 // stack and pushes it on top
-func (s *Stack) DuplicateTop() {
-	top := s.Top()
-	switch v := top.(type) {
-	case PUB_KEY_V1:
-		s.Push(PUB_KEY_V1{Key: append([]byte{}, v.Key...)})
-	default:
-		panic("Unexpected duplicating top stack item %T!\n")
+func (s *Stack) DuplicateTop() error {
+	top, err := s.Top()
+	if err != nil {
+		return err
+	}
+	s.Push(top.Copy())
+	return nil
+}
 
+// oneByteLen True for the pushes of the original script format. Their
+// length is still written as a single byte so existing scripts decode
+// the same, which is never too short for a signature, public key or
+// public key hash. Other lengths are CompactSize
+func oneByteLen(op Operand) bool {
+	switch op.(type) {
+	case SIG, PUB_KEY_V1, PUB_KEY_HASH:
+		return true
 	}
+	return false
 }
 
 // Ser Serialise a Stack
@@ -51,8 +87,12 @@ func (s Stack) Ser() *bytes.Buffer {
 	var ret bytes.Buffer
 	for _, op := range s.Contents {
 		binary.Write(&ret, littleEndian, op.AsByte())
-		binary.Write(&ret, littleEndian, op.LenData())
-		if op.LenData() > 0x00 {
+		if oneByteLen(op) {
+			ret.WriteByte(byte(op.LenData()))
+		} else {
+			varint.Write(&ret, uint64(op.LenData()))
+		}
+		if op.LenData() > 0 {
 			binary.Write(&ret, littleEndian, op.Data())
 		}
 	}
@@ -68,63 +108,209 @@ func (s *Stack) ListTypes() []string {
 	return ret
 }
 
-// consumeByte Consume a byte from a buffer
-func consumeByte(b *bytes.Buffer) {
-	var lenToRead = byte(0)
-	binary.Read(b, littleEndian, lenToRead)
+// readNoData Read the length of an operand which carries no data.
+// Ser writes LenData followed by Data when LenData is not zero, so
+// OP_HASH_160 is written as a length of 25 and a single zero byte.
+// Only exactly what Ser writes is accepted
+func readNoData(b *bytes.Buffer, op Operand) error {
+	length, err := varint.Read(b)
+	if err != nil {
+		return &MarshallError{fmt.Sprintf("Unable to read the length of %s: %s", op.Name(), err)}
+	}
+	if length != uint64(op.LenData()) {
+		return &MarshallError{fmt.Sprintf("%s has length %d, expected %d", op.Name(), length, op.LenData())}
+	}
+	if length == 0 {
+		return nil
+	}
+	data := op.Data()
+	if !bytes.Equal(b.Next(len(data)), data) {
+		return &MarshallError{fmt.Sprintf("%s is followed by unexpected data", op.Name())}
+	}
+	return nil
+}
+
+// readData Read the length Ser writes for op followed by that many
+// bytes
+func readData(b *bytes.Buffer, op Operand) ([]byte, error) {
+	name := op.Name()
+	var lenToRead uint64
+	if oneByteLen(op) {
+		n, err := b.ReadByte()
+		if err != nil {
+			return nil, &MarshallError{fmt.Sprintf("Unable to read the length of %s: %s", name, err)}
+		}
+		lenToRead = uint64(n)
+	} else {
+		n, err := varint.Read(b)
+		if err != nil {
+			return nil, &MarshallError{fmt.Sprintf("Unable to read the length of %s: %s", name, err)}
+		}
+		lenToRead = n
+	}
+	if lenToRead > uint64(b.Len()) {
+		return nil, &MarshallError{
+			fmt.Sprintf("%s length %d is more than the %d bytes left", name, lenToRead, b.Len()),
+		}
+	}
+	var buffer []byte
+	return append(buffer, b.Next(int(lenToRead))...), nil
 }
 
-// Marshall Given a bytes.Buffer marshall to a Stack
-// TODO: Test marshalling!
-func Marshall(b *bytes.Buffer) Stack {
+// Marshall Given a bytes.Buffer marshall to a Stack.
+// Unknown op codes and truncated data are errors
+func Marshall(b *bytes.Buffer) (Stack, error) {
 	ret := []Operand{}
 	for b.Len() > 0 {
-		var readByte byte
-		binary.Read(b, littleEndian, &readByte)
-		switch readByte {
+		opByte, _ := b.ReadByte()
+
+		var op Operand
+		switch opByte {
 		case OP_EQUALVERIFY{}.AsByte():
-			consumeByte(b)
-			ret = append(ret, OP_EQUALVERIFY{})
+			op = OP_EQUALVERIFY{}
 		case OP_CHECKSIG{}.AsByte():
-			consumeByte(b)
-			ret = append(ret, OP_CHECKSIG{})
+			op = OP_CHECKSIG{}
 		case OP_DUP{}.AsByte():
-			consumeByte(b)
-			ret = append(ret, OP_DUP{})
+			op = OP_DUP{}
 		case OP_HASH_160{}.AsByte():
-			consumeByte(b)
-			ret = append(ret, OP_HASH_160{})
+			op = OP_HASH_160{}
+		case OP_DROP{}.AsByte():
+			op = OP_DROP{}
+		case OP_CHECKLOCKTIMEVERIFY{}.AsByte():
+			op = OP_CHECKLOCKTIMEVERIFY{}
+		case OP_CHECKSEQUENCEVERIFY{}.AsByte():
+			op = OP_CHECKSEQUENCEVERIFY{}
+		case OP_CHECKMULTISIG{}.AsByte():
+			op = OP_CHECKMULTISIG{}
+		case OP_CHECKMULTISIGVERIFY{}.AsByte():
+			op = OP_CHECKMULTISIGVERIFY{}
+		case OP_IF{}.AsByte():
+			op = OP_IF{}
+		case OP_NOTIF{}.AsByte():
+			op = OP_NOTIF{}
+		case OP_ELSE{}.AsByte():
+			op = OP_ELSE{}
+		case OP_ENDIF{}.AsByte():
+			op = OP_ENDIF{}
+		case OP_VERIFY{}.AsByte():
+			op = OP_VERIFY{}
+		case OP_RETURN{}.AsByte():
+			op = OP_RETURN{}
+		case OP_EQUAL{}.AsByte():
+			op = OP_EQUAL{}
+		case OP_1ADD{}.AsByte():
+			op = OP_1ADD{}
+		case OP_1SUB{}.AsByte():
+			op = OP_1SUB{}
+		case OP_NEGATE{}.AsByte():
+			op = OP_NEGATE{}
+		case OP_ABS{}.AsByte():
+			op = OP_ABS{}
+		case OP_NOT{}.AsByte():
+			op = OP_NOT{}
+		case OP_0NOTEQUAL{}.AsByte():
+			op = OP_0NOTEQUAL{}
+		case OP_ADD{}.AsByte():
+			op = OP_ADD{}
+		case OP_SUB{}.AsByte():
+			op = OP_SUB{}
+		case OP_BOOLAND{}.AsByte():
+			op = OP_BOOLAND{}
+		case OP_BOOLOR{}.AsByte():
+			op = OP_BOOLOR{}
+		case OP_NUMEQUAL{}.AsByte():
+			op = OP_NUMEQUAL{}
+		case OP_NUMEQUALVERIFY{}.AsByte():
+			op = OP_NUMEQUALVERIFY{}
+		case OP_LESSTHAN{}.AsByte():
+			op = OP_LESSTHAN{}
+		case OP_GREATERTHAN{}.AsByte():
+			op = OP_GREATERTHAN{}
+		case OP_MIN{}.AsByte():
+			op = OP_MIN{}
+		case OP_MAX{}.AsByte():
+			op = OP_MAX{}
+		case OP_WITHIN{}.AsByte():
+			op = OP_WITHIN{}
+		case NUMBER{}.AsByte():
+			data, err := readData(b, NUMBER{})
+			if err != nil {
+				return Stack{}, err
+			}
+			ret = append(ret, NUMBER{data})
+			continue
 		case PUB_KEY_HASH{}.AsByte():
-			var lenToRead = byte(0)
-			binary.Read(b, littleEndian, &lenToRead)
-			var buffer []byte
-			for i := byte(0); i < lenToRead; i++ {
-				var read byte
-				binary.Read(b, littleEndian, &read)
-				buffer = append(buffer, read)
+			data, err := readData(b, PUB_KEY_HASH{})
+			if err != nil {
+				return Stack{}, err
 			}
-			ret = append(ret, PUB_KEY_HASH{buffer})
+			ret = append(ret, PUB_KEY_HASH{data})
+			continue
 		case SIG{}.AsByte():
-			var lenToRead = byte(0)
-			binary.Read(b, littleEndian, &lenToRead)
-			var buffer []byte
-			for i := byte(0); i < lenToRead; i++ {
-				var read byte
-				binary.Read(b, littleEndian, &read)
-				buffer = append(buffer, read)
+			data, err := readData(b, SIG{})
+			if err != nil {
+				return Stack{}, err
 			}
-			ret = append(ret, SIG{buffer})
+			ret = append(ret, SIG{data})
+			continue
 		case PUB_KEY_V1{}.AsByte():
-			var lenToRead = byte(0)
-			binary.Read(b, littleEndian, &lenToRead)
-			var buffer []byte
-			for i := byte(0); i < lenToRead; i++ {
-				var read byte
-				binary.Read(b, littleEndian, &read)
-				buffer = append(buffer, read)
+			data, err := readData(b, PUB_KEY_V1{})
+			if err != nil {
+				return Stack{}, err
+			}
+			ret = append(ret, PUB_KEY_V1{data})
+			continue
+		case SCRIPT{}.AsByte():
+			data, err := readData(b, SCRIPT{})
+			if err != nil {
+				return Stack{}, err
+			}
+			ret = append(ret, SCRIPT{data})
+			continue
+		case SCRIPT_HASH{}.AsByte():
+			data, err := readData(b, SCRIPT_HASH{})
+			if err != nil {
+				return Stack{}, err
+			}
+			ret = append(ret, SCRIPT_HASH{data})
+			continue
+		default:
+			if opByte < OP_1_BYTE || opByte > OP_16_BYTE {
+				return Stack{}, &MarshallError{fmt.Sprintf("Unknown op code 0x%02x", opByte)}
+			}
+			op = OP_N{N: opByte - OP_1_BYTE + 1}
+		}
+
+		if err := readNoData(b, op); err != nil {
+			return Stack{}, err
+		}
+		ret = append(ret, op)
+	}
+	return Stack{ret}, nil
+}
+
+// Disassemble The script in b as op code names separated by spaces.
+// Pushed data follows the name in brackets, in hex or for NUMBER in
+// decimal, e.g. "NUMBER[100] OP_CHECKLOCKTIMEVERIFY OP_DROP"
+func Disassemble(b []byte) (string, error) {
+	stack, err := Marshall(bytes.NewBuffer(b))
+	if err != nil {
+		return "", err
+	}
+	ops := []string{}
+	for _, op := range stack.Contents {
+		switch v := op.(type) {
+		case NUMBER:
+			if n, err := v.Int64(8); err == nil {
+				ops = append(ops, fmt.Sprintf("%s[%d]", v.Name(), n))
+			} else {
+				ops = append(ops, fmt.Sprintf("%s[%s]", v.Name(), hex.EncodeToString(v.Num)))
 			}
-			ret = append(ret, PUB_KEY_V1{buffer})
+		case SIG, PUB_KEY_V1, PUB_KEY_HASH, SCRIPT, SCRIPT_HASH:
+			ops = append(ops, fmt.Sprintf("%s[%s]", v.Name(), hex.EncodeToString(v.Data())))
+		default:
+			ops = append(ops, v.Name())
 		}
 	}
-	return Stack{ret}
+	return strings.Join(ops, " "), nil
 }
@@ -1,16 +1,37 @@
 package script
 
 import (
+	"bytes"
 	"spchain/key"
 	"testing"
 )
 
+// top The top item of s, failing the test if there is none
+func top(t *testing.T, s *Stack) Operand {
+	t.Helper()
+	op, err := s.Top()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return op
+}
+
+// second The second item of s, failing the test if there is none
+func second(t *testing.T, s *Stack) Operand {
+	t.Helper()
+	op, err := s.Second()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return op
+}
+
 func TestTop(t *testing.T) {
 	stack := Stack{
 		[]Operand{OP_DUP{}},
 	}
 
-	if _, ok := stack.Top().(OP_DUP); !ok {
+	if _, ok := top(t, &stack).(OP_DUP); !ok {
 		t.Errorf("Expected type: %#v", OP_DUP{})
 	}
 }
@@ -23,11 +44,11 @@ func TestSecond(t *testing.T) {
 		},
 	}
 
-	if _, ok := stack.Second().(OP_DUP); !ok {
+	if _, ok := second(t, &stack).(OP_DUP); !ok {
 		t.Errorf("Expected type: %#v", OP_DUP{})
 	}
 
-	if _, ok := stack.Top().(OP_HASH_160); !ok {
+	if _, ok := top(t, &stack).(OP_HASH_160); !ok {
 		t.Errorf("Expected type: %#v", OP_HASH_160{})
 	}
 }
@@ -42,20 +63,20 @@ func TestDuplicateTop(t *testing.T) {
 	}
 	stack.DuplicateTop()
 
-	if _, ok := stack.Top().(PUB_KEY_V1); !ok {
+	if _, ok := top(t, &stack).(PUB_KEY_V1); !ok {
 		t.Errorf("Expected type: %#v", PUB_KEY_V1{})
 	}
 
-	if _, ok := stack.Second().(PUB_KEY_V1); !ok {
+	if _, ok := second(t, &stack).(PUB_KEY_V1); !ok {
 		t.Errorf("Expected type: %#v", PUB_KEY_V1{})
 	}
 
 	// Make sure we copy memory bytes instead of just
 	// referencing. Change a value and make sure
 	// it is not duplicated
-	topV, _ := stack.Top().(PUB_KEY_V1)
+	topV, _ := top(t, &stack).(PUB_KEY_V1)
 	topV.Key[0] = 99
-	sTopV, _ := stack.Second().(PUB_KEY_V1)
+	sTopV, _ := second(t, &stack).(PUB_KEY_V1)
 
 	if topV.Key[0] != 99 {
 		t.Errorf("Expected %#v, got %#v", 1, topV.Key)
@@ -73,7 +94,7 @@ func TestPush(t *testing.T) {
 
 	stack.Push(OP_DUP{})
 
-	if _, ok := stack.Top().(OP_DUP); !ok {
+	if _, ok := top(t, &stack).(OP_DUP); !ok {
 		t.Errorf("Expected type: %#v", OP_DUP{})
 	}
 }
@@ -90,11 +111,36 @@ func TestPopTwo(t *testing.T) {
 
 	stack.PopTwo()
 
-	if _, ok := stack.Top().(PUB_KEY_V1); !ok {
+	if _, ok := top(t, &stack).(PUB_KEY_V1); !ok {
 		t.Errorf("Expected type: %#v", PUB_KEY_V1{})
 	}
 }
 
+func TestStackUnderflow(t *testing.T) {
+	stack := Stack{[]Operand{OP_DUP{}}}
+
+	if _, err := stack.Second(); err == nil {
+		t.Errorf("Expected an error for Second with one item")
+	}
+	if err := stack.PopTwo(); err == nil {
+		t.Errorf("Expected an error for PopTwo with one item")
+	}
+	if _, err := stack.Pop(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	if _, err := stack.Top(); err == nil {
+		t.Errorf("Expected an error for Top on an empty stack")
+	}
+	if _, err := stack.Pop(); err == nil {
+		t.Errorf("Expected an error for Pop on an empty stack")
+	}
+	err := stack.DuplicateTop()
+	if _, ok := err.(*StackUnderflowError); !ok {
+		t.Errorf("Expected StackUnderflowError, got %v", err)
+	}
+}
+
 // Test serialization and deserialization
 func TestSerDer(t *testing.T) {
 	privKeyHexString := "18e14a7b6a307f426a94f8114701e7c8e774e7f9a47e2c2035db29a206321725"
@@ -111,13 +157,100 @@ func TestSerDer(t *testing.T) {
 	}
 
 	ser := stack.Ser()
-	newStack := Marshall(ser)
+	newStack, err := Marshall(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if _, ok := top(t, &newStack).(PUB_KEY_V1); !ok {
+		t.Errorf("Expected type: %#v, got %#v", PUB_KEY_V1{}, top(t, &newStack))
+	}
+
+	if _, ok := second(t, &newStack).(OP_DUP); !ok {
+		t.Errorf("Expected type: %#v, got %#v", OP_DUP{}, top(t, &newStack))
+	}
+}
 
-	if _, ok := newStack.Top().(PUB_KEY_V1); !ok {
-		t.Errorf("Expected type: %#v, got %#v", PUB_KEY_V1{}, newStack.Top())
+func TestSerDerLongPush(t *testing.T) {
+	redeem := bytes.Repeat([]byte{0x05}, 300)
+	stack := Stack{[]Operand{SCRIPT{redeem}, OP_CHECKSIG{}}}
+
+	ser := stack.Ser()
+	// SCRIPT, 3 byte CompactSize length, data, OP_CHECKSIG and its length
+	if ser.Len() != 1+3+300+2 {
+		t.Errorf("Expected %d bytes, got %d", 1+3+300+2, ser.Len())
+	}
+
+	newStack, err := Marshall(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(newStack.Contents) != 2 || !bytes.Equal(second(t, &newStack).Data(), redeem) {
+		t.Errorf("Expected the long push to round trip, got %v", newStack.ListTypes())
+	}
+}
+
+func TestSerDerOneByteLen(t *testing.T) {
+	// 0xfd would start a 3 byte CompactSize length
+	sig := bytes.Repeat([]byte{0x05}, 253)
+	stack := Stack{[]Operand{SIG{sig}, OP_CHECKSIG{}}}
+
+	ser := stack.Ser()
+	expected := append([]byte{SIG{}.AsByte(), 0xfd}, sig...)
+	expected = append(expected, OP_CHECKSIG{}.AsByte(), 0x00)
+	if !bytes.Equal(ser.Bytes(), expected) {
+		t.Errorf("Expected the original single length byte for SIG")
+	}
+
+	newStack, err := Marshall(ser)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(newStack.Contents) != 2 || !bytes.Equal(second(t, &newStack).Data(), sig) {
+		t.Errorf("Expected the SIG to round trip, got %v", newStack.ListTypes())
+	}
+}
+
+func TestMarshallErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ser  []byte
+	}{
+		{"unknown op code", []byte{0xff, 0x00}},
+		{"missing length", []byte{SIG_BYTE}},
+		{"push longer than script", []byte{SIG_BYTE, 0x05, 0x01, 0x02}},
+		{"no data op with a length", []byte{OP_DUP_BYTE, 0x01, 0x00}},
+		{"OP_HASH_160 without its zero byte", []byte{OP_HASH_160_BYTE, 25}},
+	}
+	for _, test := range tests {
+		_, err := Marshall(bytes.NewBuffer(test.ser))
+		if _, ok := err.(*MarshallError); !ok {
+			t.Errorf("%s: expected MarshallError, got %v", test.name, err)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	locking := Stack{[]Operand{
+		NewNumber(100),
+		OP_CHECKLOCKTIMEVERIFY{},
+		OP_DROP{},
+		OP_DUP{},
+		OP_HASH_160{},
+		PUB_KEY_V1{[]byte{0xab, 0xcd}},
+		OP_EQUALVERIFY{},
+		OP_CHECKSIG{},
+	}}
+	asm, err := Disassemble(locking.Ser().Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := "NUMBER[100] OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH_160 PUB_KEY_V1[abcd] OP_EQUALVERIFY OP_CHECKSIG"
+	if asm != expected {
+		t.Errorf("Expected %q, got %q", expected, asm)
 	}
 
-	if _, ok := newStack.Second().(OP_DUP); !ok {
-		t.Errorf("Expected type: %#v, got %#v", OP_DUP{}, newStack.Top())
+	if _, err := Disassemble([]byte{0xff}); err == nil {
+		t.Errorf("Expected an error for an unknown op code")
 	}
 }
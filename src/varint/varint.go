@@ -0,0 +1,112 @@
+package varint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+/*
+  CompactSize variable length integers, as used by Bitcoin.
+
+  Values below 0xfd are a single byte. Larger values are a marker
+  byte followed by the value in little endian:
+    0xfd followed by 2 bytes
+    0xfe followed by 4 bytes
+    0xff followed by 8 bytes
+
+  Values below 0xfd encode the same as a single length byte so
+  the encoding can replace a byte length without changing existing
+  data which fits in one.
+*/
+
+var littleEndian = binary.LittleEndian
+
+// NonCanonicalError A value was encoded with more bytes than it needs
+type NonCanonicalError struct {
+	Msg string
+}
+
+func (e *NonCanonicalError) Error() string {
+	return e.Msg
+}
+
+// Size The number of bytes n encodes to
+func Size(n uint64) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	case n <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// Write Write n to w as a CompactSize
+func Write(w io.Writer, n uint64) error {
+	var err error
+	switch {
+	case n < 0xfd:
+		_, err = w.Write([]byte{byte(n)})
+	case n <= 0xffff:
+		buff := make([]byte, 3)
+		buff[0] = 0xfd
+		littleEndian.PutUint16(buff[1:], uint16(n))
+		_, err = w.Write(buff)
+	case n <= 0xffffffff:
+		buff := make([]byte, 5)
+		buff[0] = 0xfe
+		littleEndian.PutUint32(buff[1:], uint32(n))
+		_, err = w.Write(buff)
+	default:
+		buff := make([]byte, 9)
+		buff[0] = 0xff
+		littleEndian.PutUint64(buff[1:], n)
+		_, err = w.Write(buff)
+	}
+	return err
+}
+
+// Read Read a CompactSize from r. Values which could have been
+// encoded in fewer bytes are rejected so every value has a single
+// encoding
+func Read(r io.Reader) (uint64, error) {
+	var marker [1]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return 0, err
+	}
+
+	var n, min uint64
+	switch marker[0] {
+	case 0xfd:
+		var buff [2]byte
+		if _, err := io.ReadFull(r, buff[:]); err != nil {
+			return 0, err
+		}
+		n, min = uint64(littleEndian.Uint16(buff[:])), 0xfd
+	case 0xfe:
+		var buff [4]byte
+		if _, err := io.ReadFull(r, buff[:]); err != nil {
+			return 0, err
+		}
+		n, min = uint64(littleEndian.Uint32(buff[:])), 0x10000
+	case 0xff:
+		var buff [8]byte
+		if _, err := io.ReadFull(r, buff[:]); err != nil {
+			return 0, err
+		}
+		n, min = littleEndian.Uint64(buff[:]), 0x100000000
+	default:
+		return uint64(marker[0]), nil
+	}
+
+	if n < min {
+		return 0, &NonCanonicalError{
+			fmt.Sprintf("CompactSize %d encoded with marker 0x%x is not canonical", n, marker[0]),
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,58 @@
+package varint
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		size int
+	}{
+		{0, 1},
+		{0xfc, 1},
+		{0xfd, 3},
+		{0xffff, 3},
+		{0x10000, 5},
+		{0xffffffff, 5},
+		{0x100000000, 9},
+		{0xffffffffffffffff, 9},
+	}
+	for _, test := range tests {
+		var buff bytes.Buffer
+		if err := Write(&buff, test.n); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if buff.Len() != test.size || Size(test.n) != test.size {
+			t.Errorf("%d: expected %d bytes, wrote %d, Size %d", test.n, test.size, buff.Len(), Size(test.n))
+		}
+		got, err := Read(&buff)
+		if err != nil || got != test.n {
+			t.Errorf("%d: read back %d %v", test.n, got, err)
+		}
+	}
+}
+
+func TestSingleByteMatchesByteLength(t *testing.T) {
+	var buff bytes.Buffer
+	Write(&buff, 72)
+	if !bytes.Equal(buff.Bytes(), []byte{72}) {
+		t.Errorf("Expected a single byte, got %x", buff.Bytes())
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	if _, err := Read(bytes.NewBuffer([]byte{})); err != io.EOF {
+		t.Errorf("Expected %s, got %v", io.EOF, err)
+	}
+	if _, err := Read(bytes.NewBuffer([]byte{0xfe, 0x01})); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected %s, got %v", io.ErrUnexpectedEOF, err)
+	}
+	if _, err := Read(bytes.NewBuffer([]byte{0xfd, 0x10, 0x00})); err == nil {
+		t.Errorf("Expected an error reading a non canonical value")
+	} else if _, ok := err.(*NonCanonicalError); !ok {
+		t.Errorf("Expected NonCanonicalError, got %T", err)
+	}
+}